@@ -1,12 +1,21 @@
 package cli
 
 import (
+	"errors"
 	"fmt"
+	"math"
 	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
 
+	"github.com/sokinpui/itf.go/internal/config"
 	"github.com/sokinpui/itf.go/internal/tui"
 	"github.com/sokinpui/itf.go/itf"
+	"github.com/sokinpui/itf.go/model"
 	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
 )
 
 // Config holds all the command-line flag values.
@@ -14,15 +23,35 @@ type Config struct {
 	Buffer        bool
 	OutputTool    bool
 	OutputDiffFix bool
+	DryRun        bool
+	Interactive   bool
 	Undo          bool
 	Redo          bool
 	NoAnimation   bool
 	Extensions    []string
+	Backend       string
+	Feedback      string
+	Fuzzy         float64
+	Partial       bool
+	MergeGo       bool
+	Validate      string
+	Validators    []string
+	Hooks         []string
+	FileHooks     []string
+	Include       []string
+	Exclude       []string
+	PathHints     []string
+	Output        string
 	Completion    string
+	To            int
 }
 
 var cfg = &Config{}
 
+// ErrFailed is returned when a command ran but some of its changes or hooks
+// failed. The failures have already been reported, so it carries no detail.
+var ErrFailed = errors.New("some changes failed")
+
 var rootCmd = &cobra.Command{
 	Use:   "itf",
 	Short: "Parse content from stdin or clipboard to update files.",
@@ -45,10 +74,61 @@ Example: pbpaste | itf -e py`,
 			}
 		}
 
+		file, err := applyConfigFile(cmd.Flags())
+		if err != nil {
+			return err
+		}
+
 		// Validate mutually exclusive flags
 		if cfg.Undo && cfg.Redo {
 			return fmt.Errorf("error: --undo and --redo are mutually exclusive")
 		}
+		if cfg.Fuzzy < 0 || cfg.Fuzzy > 1 {
+			return fmt.Errorf("error: --fuzzy must be between 0 and 1")
+		}
+		if cfg.Validate != itf.ValidateSkip && cfg.Validate != itf.ValidateWarn && cfg.Validate != itf.ValidateOff {
+			return fmt.Errorf("error: --validate must be skip, warn or off")
+		}
+		for _, hint := range cfg.PathHints {
+			switch hint {
+			case itf.PathHintInfo, itf.PathHintParagraph, itf.PathHintHeading, itf.PathHintComment:
+			default:
+				return fmt.Errorf("error: invalid --path-hints source %q, expected info, paragraph, heading or comment", hint)
+			}
+		}
+		validators, err := parseValidators(cfg.Validators)
+		if err != nil {
+			return err
+		}
+		for ext, command := range file.Validators {
+			if ext != "" && ext[0] != '.' {
+				ext = "." + ext
+			}
+			if _, found := validators[ext]; !found {
+				validators[ext] = command
+			}
+		}
+		hooks, err := parseHooks(cfg.Hooks, cfg.FileHooks)
+		if err != nil {
+			return err
+		}
+		if !cmd.Flags().Changed("hook") && !cmd.Flags().Changed("file-hook") {
+			for _, hook := range file.Hooks {
+				hooks = append(hooks, itf.Hook{Pattern: hook.Pattern, Command: hook.Command})
+			}
+		}
+		if cfg.Feedback == itf.FeedbackStdout && cfg.Interactive {
+			return fmt.Errorf("error: --interactive requires --feedback=clipboard")
+		}
+		if err := validateOutput(); err != nil {
+			return err
+		}
+		if cfg.Output != itf.OutputText && cfg.Feedback == itf.FeedbackStdout {
+			return fmt.Errorf("error: --output %s requires --feedback=clipboard", cfg.Output)
+		}
+		if cfg.Output != itf.OutputText && cfg.Interactive {
+			return fmt.Errorf("error: --interactive cannot be used with --output %s", cfg.Output)
+		}
 
 		// Normalize extensions
 		for i, ext := range cfg.Extensions {
@@ -58,34 +138,299 @@ Example: pbpaste | itf -e py`,
 		}
 
 		itfCfg := &itf.Config{
-			Buffer:        cfg.Buffer,
-			OutputTool:    cfg.OutputTool,
-			OutputDiffFix: cfg.OutputDiffFix,
-			Undo:          cfg.Undo,
-			Redo:          cfg.Redo,
-			Extensions:    cfg.Extensions,
+			Buffer:         cfg.Buffer,
+			OutputTool:     cfg.OutputTool,
+			OutputDiffFix:  cfg.OutputDiffFix,
+			DryRun:         cfg.DryRun,
+			Interactive:    cfg.Interactive,
+			Undo:           cfg.Undo,
+			Redo:           cfg.Redo,
+			Extensions:     cfg.Extensions,
+			Backend:        backendName(),
+			Feedback:       cfg.Feedback,
+			FuzzyThreshold: cfg.Fuzzy,
+			Partial:        cfg.Partial,
+			MergeGo:        cfg.MergeGo,
+			Validate:       cfg.Validate,
+			Validators:     validators,
+			Hooks:          hooks,
+			Include:        cfg.Include,
+			Exclude:        cfg.Exclude,
+			PathHints:      cfg.PathHints,
+			Output:         cfg.Output,
 		}
 		app, err := itf.New(itfCfg)
 		if err != nil {
 			return fmt.Errorf("failed to initialize application: %w", err)
 		}
 
+		if cfg.Output != itf.OutputText {
+			return runMachineOutput(cmd, app)
+		}
+
 		// Flags that print to stdout and should not run the TUI.
-		if cfg.OutputDiffFix || cfg.OutputTool {
-			if _, err := app.Execute(); err != nil {
+		if cfg.OutputDiffFix || cfg.OutputTool || cfg.DryRun || cfg.Feedback == itf.FeedbackStdout {
+			summary, err := app.Execute()
+			if err != nil {
 				return fmt.Errorf("error: %w", err)
 			}
-			return nil
+			return checkFailures(cmd, summary)
+		}
+
+		ui := tui.New(app, cfg.NoAnimation, cfg.Interactive)
+		summary, err := ui.Run()
+		if err != nil {
+			return err
 		}
+		return checkFailures(cmd, summary)
+	},
+}
 
-		ui := tui.New(app, cfg.NoAnimation)
-		if err := ui.Run(); err != nil {
+var historyCmd = &cobra.Command{
+	Use:   "history",
+	Short: "List recorded operations, most recent first.",
+	Args:  cobra.NoArgs,
+	// main reports the error, so cobra should not print it again.
+	SilenceErrors: true,
+	SilenceUsage:  true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if _, err := applyConfigFile(cmd.Flags()); err != nil {
 			return err
 		}
+		if err := validateOutput(); err != nil {
+			return err
+		}
+		app, err := itf.New(&itf.Config{})
+		if err != nil {
+			return fmt.Errorf("failed to initialize application: %w", err)
+		}
+		if cfg.Output != itf.OutputText {
+			return itf.WriteHistory(os.Stdout, cfg.Output, app.History())
+		}
+		fmt.Print(tui.RenderHistory(app.History()))
 		return nil
 	},
 }
 
+var undoCmd = &cobra.Command{
+	Use:           "undo [N]",
+	Short:         "Undo the last N operations, or back to a history entry with --to.",
+	Args:          cobra.MaximumNArgs(1),
+	SilenceErrors: true,
+	SilenceUsage:  true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return runHistoryStep(cmd, args, true)
+	},
+}
+
+var redoCmd = &cobra.Command{
+	Use:           "redo [N]",
+	Short:         "Redo the next N undone operations, or up to a history entry with --to.",
+	Args:          cobra.MaximumNArgs(1),
+	SilenceErrors: true,
+	SilenceUsage:  true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return runHistoryStep(cmd, args, false)
+	},
+}
+
+// runHistoryStep runs the undo and redo subcommands.
+func runHistoryStep(cmd *cobra.Command, args []string, undo bool) error {
+	if _, err := applyConfigFile(cmd.Flags()); err != nil {
+		return err
+	}
+	if err := validateOutput(); err != nil {
+		return err
+	}
+	itfCfg := &itf.Config{
+		Undo:    undo,
+		Redo:    !undo,
+		Backend: backendName(),
+		Output:  cfg.Output,
+	}
+
+	toSet := cmd.Flags().Changed("to")
+	if len(args) > 0 {
+		if toSet {
+			return fmt.Errorf("error: a step count and --to are mutually exclusive")
+		}
+		steps, err := strconv.Atoi(args[0])
+		if err != nil || steps < 1 {
+			return fmt.Errorf("error: invalid number of steps: %s", args[0])
+		}
+		itfCfg.Steps = steps
+	}
+	if toSet {
+		switch {
+		case cfg.To < 0:
+			return fmt.Errorf("error: invalid history entry: %d", cfg.To)
+		case cfg.To == 0 && undo:
+			// Entry 0 is the state before any recorded operation.
+			itfCfg.Steps = math.MaxInt
+		case cfg.To == 0:
+			return fmt.Errorf("error: cannot redo to entry 0")
+		default:
+			itfCfg.ToEntry = cfg.To
+		}
+	}
+
+	app, err := itf.New(itfCfg)
+	if err != nil {
+		return fmt.Errorf("failed to initialize application: %w", err)
+	}
+	if cfg.Output != itf.OutputText {
+		return runMachineOutput(cmd, app)
+	}
+	summary, err := tui.New(app, cfg.NoAnimation, false).Run()
+	if err != nil {
+		return err
+	}
+	return checkFailures(cmd, summary)
+}
+
+// runMachineOutput runs the app without the TUI and writes its results in
+// the JSON or NDJSON format. Tool blocks, corrected diffs and plans are
+// written by the app itself; the summary of any other run is written here.
+func runMachineOutput(cmd *cobra.Command, app *itf.App) error {
+	if cfg.Output == itf.OutputNDJSON {
+		app.SetProgressCallback(func(current, total int) {
+			itf.WriteProgress(os.Stdout, current, total)
+		})
+	}
+	summary, err := app.Execute()
+	if err != nil {
+		return fmt.Errorf("error: %w", err)
+	}
+	if !cfg.OutputTool && !cfg.OutputDiffFix && !cfg.DryRun {
+		if err := itf.WriteSummary(os.Stdout, cfg.Output, summary); err != nil {
+			return fmt.Errorf("error: %w", err)
+		}
+	}
+	return checkFailures(cmd, summary)
+}
+
+// checkFailures returns ErrFailed if anything in the summary failed, so that
+// the process exits with a non-zero status. The failures were already
+// reported, so cobra is told not to print the error or the usage.
+func checkFailures(cmd *cobra.Command, summary model.Summary) error {
+	if !summary.HasFailures() {
+		return nil
+	}
+	cmd.SilenceErrors = true
+	cmd.SilenceUsage = true
+	return ErrFailed
+}
+
+// validateOutput checks the --output flag.
+func validateOutput() error {
+	switch cfg.Output {
+	case itf.OutputText, itf.OutputJSON, itf.OutputNDJSON:
+		return nil
+	}
+	return fmt.Errorf("error: --output must be text, json or ndjson")
+}
+
+// applyConfigFile loads the configuration files and uses their settings for
+// the flags that were not given on the command line. Validators and hooks
+// are returned for the caller to merge with their flags.
+func applyConfigFile(flags *pflag.FlagSet) (config.File, error) {
+	file, err := config.Load()
+	if err != nil {
+		return config.File{}, fmt.Errorf("error: %w", err)
+	}
+
+	unset := func(name string) bool {
+		return flags.Lookup(name) != nil && !flags.Changed(name)
+	}
+	if unset("extension") && file.Extensions != nil {
+		cfg.Extensions = slices.Clone(file.Extensions)
+	}
+	if unset("backend") && file.Backend != "" {
+		cfg.Backend = file.Backend
+	}
+	if unset("include") && file.Include != nil {
+		cfg.Include = file.Include
+	}
+	if unset("exclude") && file.Exclude != nil {
+		cfg.Exclude = file.Exclude
+	}
+	if unset("path-hints") && file.PathHints != nil {
+		cfg.PathHints = file.PathHints
+	}
+	if unset("fuzzy") && file.Fuzzy != nil {
+		cfg.Fuzzy = *file.Fuzzy
+	}
+	if unset("partial") && file.Partial != nil {
+		cfg.Partial = *file.Partial
+	}
+	if unset("merge-go") && file.MergeGo != nil {
+		cfg.MergeGo = *file.MergeGo
+	}
+	if unset("validate") && file.Validate != "" {
+		cfg.Validate = file.Validate
+	}
+	if unset("feedback") && file.Feedback != "" {
+		cfg.Feedback = file.Feedback
+	}
+	if unset("output") && file.Output != "" {
+		cfg.Output = file.Output
+	}
+	if unset("no-animation") && file.NoAnimation != nil {
+		cfg.NoAnimation = *file.NoAnimation
+	}
+	return file, nil
+}
+
+// parseValidators parses --validator flags of the form "EXT=COMMAND" into
+// commands by extension.
+func parseValidators(flags []string) (map[string]string, error) {
+	validators := make(map[string]string, len(flags))
+	for _, flag := range flags {
+		ext, command, found := strings.Cut(flag, "=")
+		ext, command = strings.TrimSpace(ext), strings.TrimSpace(command)
+		if !found || ext == "" || command == "" {
+			return nil, fmt.Errorf("error: invalid --validator %q, expected EXT=COMMAND", flag)
+		}
+		if ext[0] != '.' {
+			ext = "." + ext
+		}
+		validators[ext] = command
+	}
+	return validators, nil
+}
+
+// parseHooks parses --hook flags, run once per run, and --file-hook flags
+// of the form "PATTERN=COMMAND", run for each written file matching
+// PATTERN. Hooks run in the order they are given, per-run hooks last.
+func parseHooks(runHooks, fileHooks []string) ([]itf.Hook, error) {
+	var hooks []itf.Hook
+	for _, flag := range fileHooks {
+		pattern, command, found := strings.Cut(flag, "=")
+		pattern, command = strings.TrimSpace(pattern), strings.TrimSpace(command)
+		if !found || pattern == "" || command == "" {
+			return nil, fmt.Errorf("error: invalid --file-hook %q, expected PATTERN=COMMAND", flag)
+		}
+		if _, err := filepath.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("error: invalid --file-hook pattern %q: %w", pattern, err)
+		}
+		hooks = append(hooks, itf.Hook{Pattern: pattern, Command: command})
+	}
+	for _, command := range runHooks {
+		if command = strings.TrimSpace(command); command != "" {
+			hooks = append(hooks, itf.Hook{Command: command})
+		}
+	}
+	return hooks, nil
+}
+
+// backendName maps the --backend flag to an itf backend name.
+func backendName() string {
+	if cfg.Backend == "auto" {
+		return itf.BackendAuto
+	}
+	return cfg.Backend
+}
+
 func init() {
 	rootCmd.Flags().StringVar(&cfg.Completion,
 		"completion",
@@ -93,11 +438,31 @@ func init() {
 	rootCmd.Flags().BoolVarP(&cfg.Buffer, "buffer", "b", false, "Update buffers in Neovim without saving them to disk (changes are saved by default).")
 	rootCmd.Flags().BoolVarP(&cfg.OutputTool, "output-tool", "t", false, "Print the content of tool blocks.")
 	rootCmd.Flags().BoolVarP(&cfg.OutputDiffFix, "output-diff-fix", "o", false, "Print the diff that corrected start and count.")
-	rootCmd.Flags().BoolVar(&cfg.NoAnimation, "no-animation", false, "Disable loading spinner and progress updates.")
+	rootCmd.Flags().BoolVar(&cfg.DryRun, "dry-run", false, "Print the planned changes as diffs without applying them.")
+	rootCmd.Flags().StringVar(&cfg.Feedback, "feedback", "", "Write a markdown report of failed hunks for the model (stdout|clipboard).")
+	rootCmd.Flags().Lookup("feedback").NoOptDefVal = itf.FeedbackStdout
+	rootCmd.Flags().Float64Var(&cfg.Fuzzy, "fuzzy", 0, "Minimum similarity (0-1) to place a diff hunk whose lines are not found verbatim, e.g., 0.8. 0 disables fuzzy matching.")
+	rootCmd.Flags().BoolVar(&cfg.Partial, "partial", false, "Apply the hunks of a diff that match and write the others to .itf/rejects/<path>.rej.")
+	rootCmd.Flags().BoolVar(&cfg.MergeGo, "merge-go", false, "Merge .go file blocks into the existing file by declaration instead of replacing it. Declarations cannot be removed in this mode.")
+	rootCmd.Flags().StringVar(&cfg.Validate, "validate", itf.ValidateSkip, "What to do with changes that fail syntax validation (skip|warn|off).")
+	rootCmd.Flags().StringArrayVar(&cfg.Validators, "validator", nil, "Validator command for an extension, e.g., 'py=python -m py_compile {}'. Can be repeated.")
+	rootCmd.Flags().StringArrayVar(&cfg.FileHooks, "file-hook", nil, "Command run for each written file matching a pattern, e.g., '*.go=gofmt -w {file}'. Can be repeated.")
+	rootCmd.Flags().StringArrayVar(&cfg.Hooks, "hook", nil, "Command run once after the changes are saved, e.g., 'go build ./...'. Can be repeated.")
+	rootCmd.Flags().StringArrayVar(&cfg.Include, "include", nil, "Only change files matching this glob, e.g., 'src/**'. Can be repeated.")
+	rootCmd.Flags().StringArrayVar(&cfg.Exclude, "exclude", nil, "Never change files matching this glob, e.g., 'vendor'. Can be repeated.")
+	rootCmd.Flags().StringSliceVar(&cfg.PathHints, "path-hints", nil, "Where to look for the paths of file blocks, in order of precedence (info,paragraph,heading,comment). Defaults to info,paragraph,comment.")
+	rootCmd.Flags().BoolVarP(&cfg.Interactive, "interactive", "i", false, "Review and select the changes to apply, file by file and hunk by hunk.")
+	rootCmd.PersistentFlags().StringVar(&cfg.Output, "output", itf.OutputText, "Format of the printed results (text|json|ndjson).")
+	rootCmd.PersistentFlags().BoolVar(&cfg.NoAnimation, "no-animation", false, "Disable loading spinner and progress updates.")
 	rootCmd.Flags().StringSliceVarP(&cfg.Extensions, "extension", "e", []string{}, "Filter by extension. Use 'diff' to process only diff blocks (e.g., 'py', 'js', 'diff').")
+	rootCmd.PersistentFlags().StringVar(&cfg.Backend, "backend", "auto", "Backend used to write files (auto|nvim|fs). 'auto' uses Neovim if available.")
 	rootCmd.Flags().BoolVarP(&cfg.Undo, "undo", "u", false, "Undo the last operation.")
 	rootCmd.Flags().BoolVarP(&cfg.Redo, "redo", "r", false, "Redo the last undone operation.")
 
+	undoCmd.Flags().IntVar(&cfg.To, "to", 0, "Undo back to the history entry with this ID (0 undoes everything).")
+	redoCmd.Flags().IntVar(&cfg.To, "to", 0, "Redo up to and including the history entry with this ID.")
+	rootCmd.AddCommand(historyCmd, undoCmd, redoCmd)
+
 	// Disable the default help command to prefer the --help flag
 	rootCmd.SetHelpCommand(&cobra.Command{
 		Use:    "no-help",
@@ -0,0 +1,236 @@
+package backend
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/sokinpui/itf.go/internal/fs"
+	"github.com/sokinpui/itf.go/internal/state"
+	"github.com/sokinpui/itf.go/model"
+)
+
+// Errors reported when undoing or redoing an operation is unsafe.
+var (
+	ErrChanged    = errors.New("file changed since the operation")
+	ErrExists     = errors.New("destination already exists")
+	ErrNoSnapshot = errors.New("no snapshot of the previous content")
+)
+
+// Backend writes planned file changes and reverts recorded operations.
+type Backend interface {
+	// ApplyChanges writes the content of each change.
+	ApplyChanges(changes []model.FileChange, progressCb func(int)) (updated []string, failed []model.Failure)
+	// SaveAllBuffers persists changes that were applied but not yet saved.
+	SaveAllBuffers() error
+	// ReloadFiles updates the backend's view of files that were changed on
+	// disk by other programs, such as formatters.
+	ReloadFiles(paths []string) (failed []model.Failure)
+	// UndoFiles reverts a set of operations.
+	UndoFiles(ops []state.Operation, stateDir string, progressCb func(int)) (undone []string, failed []model.Failure)
+	// RedoFiles redoes a set of operations.
+	RedoFiles(ops []state.Operation, stateDir string, progressCb func(int)) (redone []string, failed []model.Failure)
+	// Close releases any resources held by the backend.
+	Close()
+}
+
+// ProcessSequentially is a generic helper function to run a set of jobs
+// sequentially. Items whose job returns an error fail at the given stage.
+func ProcessSequentially[T any](
+	items []T,
+	stage model.FailureStage,
+	processFn func(item T) (path string, err error),
+	progressCb func(int),
+) (succeeded []string, failed []model.Failure) {
+	numItems := len(items)
+	if numItems == 0 {
+		return nil, nil
+	}
+
+	for i, item := range items {
+		path, err := processFn(item)
+		if err == nil {
+			succeeded = append(succeeded, path)
+		} else {
+			failed = append(failed, model.Failure{Path: path, Stage: stage, Err: err})
+		}
+		if progressCb != nil {
+			progressCb(i + 1)
+		}
+	}
+
+	return succeeded, failed
+}
+
+// UndoDelete restores a deleted file from the trash.
+func UndoDelete(op state.Operation, stateDir string) error {
+	trashPath := filepath.Join(stateDir, state.TrashDir)
+	wd, _ := os.Getwd()
+	if err := fs.RestoreFileFromTrash(op.Path, trashPath, wd); err != nil {
+		return err
+	}
+	// Safety check: after restoring, does hash match?
+	restoredHash, err := fs.GetFileSHA256(op.Path)
+	if err != nil || restoredHash != op.ContentHash {
+		// Something is wrong. Maybe move it back to trash? For now, fail.
+		os.Remove(op.Path) // cleanup
+		return fmt.Errorf("restored file does not match the deleted one")
+	}
+	return nil
+}
+
+// UndoRename renames a file back to its original path, restoring its
+// previous content and mode if the rename also changed them.
+func UndoRename(op state.Operation, stateDir string) error {
+	// Undo rename is renaming NewPath back to OldPath (op.Path)
+	if err := checkHash(op.NewPath, op.ContentHash); err != nil {
+		return err
+	}
+	if _, err := os.Stat(op.Path); !os.IsNotExist(err) {
+		// Don't overwrite an existing file at the original path.
+		return ErrExists
+	}
+	if err := os.Rename(op.NewPath, op.Path); err != nil {
+		return err
+	}
+	if op.PrevHash != "" {
+		if err := state.RestoreObject(stateDir, op.PrevHash, op.Path); err != nil {
+			return err
+		}
+	}
+	return SetMode(op.Path, op.OldMode)
+}
+
+// UndoCreate removes a created file, along with its parent directory if it
+// is left empty.
+func UndoCreate(op state.Operation) error {
+	currentHash, err := fs.GetFileSHA256(op.Path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			// If the file doesn't exist, the undo of a 'create' is successful.
+			return nil
+		}
+		return err
+	}
+
+	// Core safety check: if the file has been changed, abort the undo for this file.
+	if currentHash != op.ContentHash {
+		return ErrChanged
+	}
+
+	if err := os.Remove(op.Path); err != nil {
+		return err
+	}
+
+	// Attempt to remove parent directory if it's empty
+	parentDir := filepath.Dir(op.Path)
+	if isEmpty, _ := fs.IsEmpty(parentDir); isEmpty {
+		if err := os.Remove(parentDir); err == nil {
+			// Successfully removed empty parent, no need to log.
+		}
+	}
+	return nil
+}
+
+// CheckUndoModify checks that a modified file is unchanged since the
+// operation. Operations recorded before snapshots were taken have no
+// PrevHash; backends that cannot undo them otherwise return ErrNoSnapshot.
+func CheckUndoModify(op state.Operation) error {
+	// Core safety check: if the file has been changed, abort the undo for this file.
+	return checkHash(op.Path, op.ContentHash)
+}
+
+// CheckRedoWrite checks that a created or modified file is still as undoing
+// the operation left it.
+func CheckRedoWrite(op state.Operation) error {
+	if op.Action == "create" {
+		if _, err := os.Stat(op.Path); !os.IsNotExist(err) {
+			return ErrExists
+		}
+		return nil
+	}
+	if op.PrevHash == "" {
+		return ErrNoSnapshot
+	}
+	return checkHash(op.Path, op.PrevHash)
+}
+
+// RedoRename renames a file to its new path again, along with any change
+// of content and mode.
+func RedoRename(op state.Operation, stateDir string) error {
+	// Redo rename is renaming OldPath (op.Path) to NewPath
+	expectedHash := op.ContentHash
+	if op.PrevHash != "" {
+		expectedHash = op.PrevHash
+	}
+	if err := checkHash(op.Path, expectedHash); err != nil {
+		return err
+	}
+	if _, err := os.Stat(op.NewPath); !os.IsNotExist(err) {
+		// Don't overwrite an existing file at the new path.
+		return ErrExists
+	}
+
+	if err := os.Rename(op.Path, op.NewPath); err != nil {
+		return err
+	}
+	if op.PrevHash != "" {
+		if err := state.RestoreObject(stateDir, op.ContentHash, op.NewPath); err != nil {
+			return err
+		}
+	}
+	return SetMode(op.NewPath, op.NewMode)
+}
+
+// RedoDelete moves a file to the trash again.
+func RedoDelete(op state.Operation, stateDir string) error {
+	// Safety check: does the file on disk match the hash we have?
+	if err := checkHash(op.Path, op.ContentHash); err != nil {
+		// File is not what we expect. Don't touch it.
+		return err
+	}
+
+	trashPath := filepath.Join(stateDir, state.TrashDir)
+	wd, _ := os.Getwd()
+	return fs.TrashFile(op.Path, trashPath, wd)
+}
+
+// UndoChmod restores the previous mode of a file whose content is unchanged
+// since the operation.
+func UndoChmod(op state.Operation) error {
+	if err := checkHash(op.Path, op.ContentHash); err != nil {
+		return err
+	}
+	return SetMode(op.Path, op.OldMode)
+}
+
+// RedoChmod sets the mode of a file again.
+func RedoChmod(op state.Operation) error {
+	if err := checkHash(op.Path, op.ContentHash); err != nil {
+		return err
+	}
+	return SetMode(op.Path, op.NewMode)
+}
+
+// SetMode sets the permission bits of a file. A zero mode leaves them
+// unchanged.
+func SetMode(path string, mode os.FileMode) error {
+	if mode == 0 {
+		return nil
+	}
+	return os.Chmod(path, mode)
+}
+
+// checkHash returns ErrChanged if the content of a file does not have the
+// expected hash.
+func checkHash(path, expected string) error {
+	currentHash, err := fs.GetFileSHA256(path)
+	if err != nil {
+		return err
+	}
+	if currentHash != expected {
+		return ErrChanged
+	}
+	return nil
+}
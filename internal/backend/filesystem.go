@@ -0,0 +1,113 @@
+package backend
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/sokinpui/itf.go/internal/fs"
+	"github.com/sokinpui/itf.go/internal/state"
+	"github.com/sokinpui/itf.go/model"
+)
+
+// Filesystem writes changes directly to disk, without Neovim.
+type Filesystem struct{}
+
+// NewFilesystem creates a new filesystem backend.
+func NewFilesystem() *Filesystem {
+	return &Filesystem{}
+}
+
+// ApplyChanges atomically writes the content of each change to disk.
+func (f *Filesystem) ApplyChanges(changes []model.FileChange, progressCb func(int)) (updated []string, failed []model.Failure) {
+	processFn := func(change model.FileChange) (string, error) {
+		return change.Path, fs.WriteFileAtomic(change.Path, joinLines(change.Content))
+	}
+	return ProcessSequentially(changes, model.StageApply, processFn, progressCb)
+}
+
+// SaveAllBuffers does nothing, since ApplyChanges already writes to disk.
+func (f *Filesystem) SaveAllBuffers() error { return nil }
+
+// ReloadFiles does nothing, as files are not held in memory.
+func (f *Filesystem) ReloadFiles(paths []string) []model.Failure { return nil }
+
+// UndoFiles reverts a set of operations.
+func (f *Filesystem) UndoFiles(ops []state.Operation, stateDir string, progressCb func(int)) (undone []string, failed []model.Failure) {
+	processFn := func(op state.Operation) (string, error) {
+		switch op.Action {
+		case "delete":
+			return op.Path, UndoDelete(op, stateDir)
+		case "rename":
+			return op.Path, UndoRename(op, stateDir)
+		case "create":
+			return op.Path, UndoCreate(op)
+		case "modify":
+			return op.Path, f.undoModify(op, stateDir)
+		case "chmod":
+			return op.Path, UndoChmod(op)
+		default:
+			return op.Path, fmt.Errorf("unknown action %q", op.Action)
+		}
+	}
+	return ProcessSequentially(ops, model.StageUndo, processFn, progressCb)
+}
+
+func (f *Filesystem) undoModify(op state.Operation, stateDir string) error {
+	if err := CheckUndoModify(op); err != nil {
+		return err
+	}
+	if op.PrevHash == "" {
+		return ErrNoSnapshot
+	}
+	if err := state.RestoreObject(stateDir, op.PrevHash, op.Path); err != nil {
+		return err
+	}
+	return SetMode(op.Path, op.OldMode)
+}
+
+// RedoFiles redoes a set of operations.
+func (f *Filesystem) RedoFiles(ops []state.Operation, stateDir string, progressCb func(int)) (redone []string, failed []model.Failure) {
+	processFn := func(op state.Operation) (string, error) {
+		switch op.Action {
+		case "delete":
+			return op.Path, RedoDelete(op, stateDir)
+		case "create", "modify":
+			return op.Path, f.redoWrite(op, stateDir)
+		case "rename":
+			return op.Path, RedoRename(op, stateDir)
+		case "chmod":
+			return op.Path, RedoChmod(op)
+		default:
+			return op.Path, fmt.Errorf("unknown action %q", op.Action)
+		}
+	}
+	return ProcessSequentially(ops, model.StageUndo, processFn, progressCb)
+}
+
+func (f *Filesystem) redoWrite(op state.Operation, stateDir string) error {
+	if err := CheckRedoWrite(op); err != nil {
+		return err
+	}
+	// Undoing a create may have removed the parent directory.
+	if err := os.MkdirAll(filepath.Dir(op.Path), 0755); err != nil {
+		return err
+	}
+	if err := state.RestoreObject(stateDir, op.ContentHash, op.Path); err != nil {
+		return err
+	}
+	return SetMode(op.Path, op.NewMode)
+}
+
+// Close does nothing for the filesystem backend.
+func (f *Filesystem) Close() {}
+
+// joinLines joins lines into file content with a trailing newline, the way
+// Neovim writes a buffer.
+func joinLines(lines []string) []byte {
+	if len(lines) == 0 {
+		return nil
+	}
+	return []byte(strings.Join(lines, "\n") + "\n")
+}
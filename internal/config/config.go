@@ -0,0 +1,179 @@
+// Package config loads settings from the user and project configuration
+// files.
+package config
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+
+	"github.com/sokinpui/itf.go/internal/state"
+)
+
+// Names of the configuration files, in order of preference. The project file
+// is looked for at the root of the git repository, and the user file in the
+// "itf" directory of the user's configuration directory.
+var (
+	projectFileNames = []string{".itf.toml", ".itf.yaml", ".itf.yml"}
+	userFileNames    = []string{"config.toml", "config.yaml", "config.yml"}
+)
+
+// File holds the settings of a configuration file. Settings that are not in
+// the file are left empty, so that files can be layered.
+type File struct {
+	Extensions  []string          `toml:"extensions" yaml:"extensions"`
+	Backend     string            `toml:"backend" yaml:"backend"`
+	Include     []string          `toml:"include" yaml:"include"`
+	Exclude     []string          `toml:"exclude" yaml:"exclude"`
+	PathHints   []string          `toml:"path_hints" yaml:"path_hints"`
+	Fuzzy       *float64          `toml:"fuzzy" yaml:"fuzzy"`
+	Partial     *bool             `toml:"partial" yaml:"partial"`
+	MergeGo     *bool             `toml:"merge_go" yaml:"merge_go"`
+	Validate    string            `toml:"validate" yaml:"validate"`
+	Validators  map[string]string `toml:"validators" yaml:"validators"`
+	Hooks       []Hook            `toml:"hooks" yaml:"hooks"`
+	Feedback    string            `toml:"feedback" yaml:"feedback"`
+	Output      string            `toml:"output" yaml:"output"`
+	NoAnimation *bool             `toml:"no_animation" yaml:"no_animation"`
+}
+
+// Hook is a command run after changes are saved. Pattern is empty for hooks
+// run once per run.
+type Hook struct {
+	Pattern string `toml:"pattern" yaml:"pattern"`
+	Command string `toml:"command" yaml:"command"`
+}
+
+// Load reads the user configuration file and then the project one, if they
+// exist, with the settings of the project file taking precedence.
+func Load() (File, error) {
+	var merged File
+	if dir, err := os.UserConfigDir(); err == nil {
+		user, err := loadFirst(filepath.Join(dir, "itf"), userFileNames)
+		if err != nil {
+			return File{}, err
+		}
+		merged = merged.merge(user)
+	}
+
+	root, err := state.FindGitRoot()
+	if err != nil {
+		if root, err = os.Getwd(); err != nil {
+			return File{}, fmt.Errorf("could not get current working directory: %w", err)
+		}
+	}
+	project, err := loadFirst(root, projectFileNames)
+	if err != nil {
+		return File{}, err
+	}
+	return merged.merge(project), nil
+}
+
+// loadFirst reads the first of the named files that exists in dir. It
+// returns an empty File if none does.
+func loadFirst(dir string, names []string) (File, error) {
+	for _, name := range names {
+		path := filepath.Join(dir, name)
+		data, err := os.ReadFile(path)
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return File{}, fmt.Errorf("failed to read config %s: %w", path, err)
+		}
+		file, err := parse(data, filepath.Ext(name))
+		if err != nil {
+			return File{}, fmt.Errorf("invalid config %s: %w", path, err)
+		}
+		return file, nil
+	}
+	return File{}, nil
+}
+
+// parse decodes a TOML or YAML configuration file, by its extension.
+// Unknown settings are an error, so that typos do not go unnoticed.
+func parse(data []byte, ext string) (File, error) {
+	var file File
+	if ext == ".toml" {
+		meta, err := toml.Decode(string(data), &file)
+		if err != nil {
+			return File{}, err
+		}
+		if undecoded := meta.Undecoded(); len(undecoded) > 0 {
+			keys := make([]string, len(undecoded))
+			for i, key := range undecoded {
+				keys[i] = key.String()
+			}
+			return File{}, fmt.Errorf("unknown settings: %s", strings.Join(keys, ", "))
+		}
+		return file, nil
+	}
+
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(&file); err != nil && !errors.Is(err, io.EOF) {
+		return File{}, err
+	}
+	return file, nil
+}
+
+// merge returns f with the settings that are set in other replacing its
+// own. Validators are merged by extension.
+func (f File) merge(other File) File {
+	if other.Extensions != nil {
+		f.Extensions = other.Extensions
+	}
+	if other.Backend != "" {
+		f.Backend = other.Backend
+	}
+	if other.Include != nil {
+		f.Include = other.Include
+	}
+	if other.Exclude != nil {
+		f.Exclude = other.Exclude
+	}
+	if other.PathHints != nil {
+		f.PathHints = other.PathHints
+	}
+	if other.Fuzzy != nil {
+		f.Fuzzy = other.Fuzzy
+	}
+	if other.Partial != nil {
+		f.Partial = other.Partial
+	}
+	if other.MergeGo != nil {
+		f.MergeGo = other.MergeGo
+	}
+	if other.Validate != "" {
+		f.Validate = other.Validate
+	}
+	if other.Validators != nil {
+		validators := maps.Clone(f.Validators)
+		if validators == nil {
+			validators = make(map[string]string)
+		}
+		maps.Copy(validators, other.Validators)
+		f.Validators = validators
+	}
+	if other.Hooks != nil {
+		f.Hooks = other.Hooks
+	}
+	if other.Feedback != "" {
+		f.Feedback = other.Feedback
+	}
+	if other.Output != "" {
+		f.Output = other.Output
+	}
+	if other.NoAnimation != nil {
+		f.NoAnimation = other.NoAnimation
+	}
+	return f
+}
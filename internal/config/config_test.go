@@ -0,0 +1,140 @@
+package config
+
+import (
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// setup creates a user configuration directory and a project directory
+// outside of any git repository, and makes the project the working
+// directory. files maps paths relative to the temporary directory, under
+// "user/itf" or "project", to their content.
+func setup(t *testing.T, files map[string]string) {
+	t.Helper()
+	dir := t.TempDir()
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	project := filepath.Join(dir, "project")
+	if err := os.MkdirAll(project, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("XDG_CONFIG_HOME", filepath.Join(dir, "user"))
+	t.Setenv("GIT_CEILING_DIRECTORIES", dir)
+	t.Chdir(project)
+}
+
+func TestLoadLayers(t *testing.T) {
+	setup(t, map[string]string{
+		"user/itf/config.toml": `
+extensions = ["go"]
+backend = "fs"
+fuzzy = 0.5
+partial = true
+[validators]
+py = "python3 -m py_compile {}"
+go = "gofmt -e {}"
+`,
+		"project/.itf.yaml": `
+backend: nvim
+partial: false
+merge_go: true
+validators:
+  py: ruff check {}
+`,
+	})
+
+	file, err := Load()
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if !slices.Equal(file.Extensions, []string{"go"}) {
+		t.Errorf("Extensions = %q, want the user setting", file.Extensions)
+	}
+	if file.Backend != "nvim" {
+		t.Errorf("Backend = %q, want the project setting", file.Backend)
+	}
+	if file.Fuzzy == nil || *file.Fuzzy != 0.5 {
+		t.Errorf("Fuzzy = %v, want the user setting", file.Fuzzy)
+	}
+	if file.Partial == nil || *file.Partial {
+		t.Errorf("Partial = %v, want the project's false over the user's true", file.Partial)
+	}
+	if file.MergeGo == nil || !*file.MergeGo {
+		t.Errorf("MergeGo = %v, want the project setting", file.MergeGo)
+	}
+	want := map[string]string{"py": "ruff check {}", "go": "gofmt -e {}"}
+	if !maps.Equal(file.Validators, want) {
+		t.Errorf("Validators = %v, want %v", file.Validators, want)
+	}
+}
+
+func TestLoadPreference(t *testing.T) {
+	setup(t, map[string]string{
+		"project/.itf.toml": `backend = "fs"`,
+		"project/.itf.yaml": `backend: nvim`,
+	})
+
+	file, err := Load()
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if file.Backend != "fs" {
+		t.Errorf("Backend = %q, want the setting of .itf.toml", file.Backend)
+	}
+}
+
+func TestLoadNoFiles(t *testing.T) {
+	setup(t, nil)
+
+	file, err := Load()
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if file.Backend != "" || file.Fuzzy != nil || file.Validators != nil {
+		t.Errorf("Load() = %+v, want no settings", file)
+	}
+}
+
+func TestLoadUnknownSettings(t *testing.T) {
+	tests := []struct {
+		name    string
+		files   map[string]string
+		wantErr string
+	}{
+		{
+			name:    "toml",
+			files:   map[string]string{"project/.itf.toml": "fuzz = 0.5\n"},
+			wantErr: "unknown settings: fuzz",
+		},
+		{
+			name:    "yaml",
+			files:   map[string]string{"project/.itf.yml": "fuzz: 0.5\n"},
+			wantErr: "field fuzz not found",
+		},
+		{
+			name:    "user file",
+			files:   map[string]string{"user/itf/config.toml": "[hooks]\ncmd = \"make\"\n"},
+			wantErr: "invalid config",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setup(t, tt.files)
+			if _, err := Load(); err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Load() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -6,7 +6,9 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"path"
 	"path/filepath"
+	"strings"
 )
 
 // GetFileSHA256 computes the SHA256 hash of a file's content.
@@ -24,6 +26,48 @@ func GetFileSHA256(path string) (string, error) {
 	return hex.EncodeToString(hash.Sum(nil)), nil
 }
 
+// ReadLines reads a file and splits its content into lines. A trailing
+// newline does not produce an extra empty line.
+func ReadLines(path string) ([]string, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if len(content) == 0 {
+		return []string{}, nil
+	}
+	return strings.Split(strings.TrimSuffix(string(content), "\n"), "\n"), nil
+}
+
+// WriteFileAtomic writes data to a temporary file next to path and renames it
+// into place, so readers never see a partially written file. An existing
+// file keeps its permissions.
+func WriteFileAtomic(path string, data []byte) error {
+	perm := os.FileMode(0644)
+	if info, err := os.Stat(path); err == nil {
+		perm = info.Mode().Perm()
+	}
+
+	tmpFile, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".itf-")
+	if err != nil {
+		return fmt.Errorf("could not create temp file: %w", err)
+	}
+	tmpPath := tmpFile.Name()
+	defer os.Remove(tmpPath) // No-op after a successful rename.
+
+	if _, err := tmpFile.Write(data); err != nil {
+		tmpFile.Close()
+		return fmt.Errorf("could not write temp file: %w", err)
+	}
+	if err := tmpFile.Close(); err != nil {
+		return fmt.Errorf("could not close temp file: %w", err)
+	}
+	if err := os.Chmod(tmpPath, perm); err != nil {
+		return fmt.Errorf("could not set file permissions: %w", err)
+	}
+	return os.Rename(tmpPath, path)
+}
+
 // IsEmpty checks if a directory is empty.
 func IsEmpty(name string) (bool, error) {
 	f, err := os.Open(name)
@@ -143,3 +187,51 @@ func RestoreFileFromTrash(originalPath string, trashPath string, wd string) erro
 
 	return os.Rename(srcPath, originalPath)
 }
+
+// MatchGlob reports whether a slash-separated relative path matches a glob
+// pattern. A pattern without a slash matches the name of the file or of any
+// directory it is in, e.g., "*.go" or "vendor". A pattern with a slash is
+// matched against the path from its start, where "**" matches any number of
+// directories, e.g., "internal/**/*.go". A pattern that matches a directory
+// matches every file in it.
+func MatchGlob(pattern, relPath string) bool {
+	pattern = strings.TrimSuffix(strings.TrimPrefix(pattern, "/"), "/")
+	segments := strings.Split(filepath.ToSlash(relPath), "/")
+	if !strings.Contains(pattern, "/") {
+		for _, segment := range segments {
+			if matched, _ := path.Match(pattern, segment); matched {
+				return true
+			}
+		}
+		return false
+	}
+
+	patternSegments := strings.Split(pattern, "/")
+	for n := len(segments); n > 0; n-- {
+		if matchSegments(patternSegments, segments[:n]) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchSegments matches path segments against pattern segments, where a
+// "**" segment matches any number of path segments.
+func matchSegments(pattern, segments []string) bool {
+	if len(pattern) == 0 {
+		return len(segments) == 0
+	}
+	if pattern[0] == "**" {
+		for i := 0; i <= len(segments); i++ {
+			if matchSegments(pattern[1:], segments[i:]) {
+				return true
+			}
+		}
+		return false
+	}
+	if len(segments) == 0 {
+		return false
+	}
+	matched, _ := path.Match(pattern[0], segments[0])
+	return matched && matchSegments(pattern[1:], segments[1:])
+}
@@ -1,6 +1,9 @@
 package nvim
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"fmt"
 	"os"
 	"os/exec"
@@ -10,7 +13,7 @@ import (
 
 	"github.com/neovim/go-client/nvim"
 
-	"github.com/sokinpui/itf.go/internal/fs"
+	"github.com/sokinpui/itf.go/internal/backend"
 	"github.com/sokinpui/itf.go/internal/state"
 	"github.com/sokinpui/itf.go/model"
 )
@@ -19,7 +22,10 @@ const (
 	undoDir = "~/.local/state/nvim/undo/"
 )
 
+var errNoHistory = errors.New("no change in Neovim's undo history")
+
 // Manager handles the connection and interaction with a Neovim instance.
+// It implements backend.Backend.
 type Manager struct {
 	nvim          *nvim.Nvim
 	isSelfStarted bool
@@ -74,7 +80,10 @@ func New() (*Manager, error) {
 	return m, nil
 }
 
-// configureTempInstance sets up undofile for persistent history.
+// configureTempInstance disables swap files for the temporary instance and
+// sets up undofile for persistent history. Undo and redo rely on the
+// snapshots in the state directory, except for files modified before
+// snapshots were taken, which are undone with Neovim's undo history.
 func (m *Manager) configureTempInstance() {
 	home, _ := os.UserHomeDir()
 	expandedUndoDir := strings.Replace(undoDir, "~", home, 1)
@@ -102,44 +111,18 @@ func (m *Manager) Close() {
 	}
 }
 
-// processSequentially is a generic helper function to run a set of jobs sequentially.
-func processSequentially[T any](
-	items []T,
-	processFn func(item T) (path string, success bool),
-	progressCb func(int),
-) (succeeded, failed []string) {
-	numItems := len(items)
-	if numItems == 0 {
-		return nil, nil
-	}
-
-	for i, item := range items {
-		path, success := processFn(item)
-		if success {
-			succeeded = append(succeeded, path)
-		} else {
-			failed = append(failed, path)
-		}
-		if progressCb != nil {
-			progressCb(i + 1)
-		}
-	}
-
-	return succeeded, failed
-}
-
 // ApplyChanges updates Neovim buffers with the provided file contents.
-func (m *Manager) ApplyChanges(changes []model.FileChange, progressCb func(int)) (updated, failed []string) {
-	processFn := func(change model.FileChange) (string, bool) {
+func (m *Manager) ApplyChanges(changes []model.FileChange, progressCb func(int)) (updated []string, failed []model.Failure) {
+	processFn := func(change model.FileChange) (string, error) {
 		return change.Path, m.updateBuffer(change.Path, change.Content)
 	}
-	return processSequentially(changes, processFn, progressCb)
+	return backend.ProcessSequentially(changes, model.StageApply, processFn, progressCb)
 }
 
-func (m *Manager) updateBuffer(filePath string, content []string) bool {
+func (m *Manager) updateBuffer(filePath string, content []string) error {
 	absPath, err := filepath.Abs(filePath)
 	if err != nil {
-		return false
+		return err
 	}
 
 	byteContent := make([][]byte, len(content))
@@ -151,152 +134,155 @@ func (m *Manager) updateBuffer(filePath string, content []string) bool {
 	b.Command(fmt.Sprintf("edit %s", absPath))
 	b.SetBufferLines(0, 0, -1, true, byteContent)
 
-	if err := b.Execute(); err != nil {
-		return false
-	}
-	return true
+	return b.Execute()
 }
 
 // SaveAllBuffers writes all modified buffers to disk.
-func (m *Manager) SaveAllBuffers() {
-	if err := m.nvim.Command("wa!"); err != nil {
-		// TODO: Propagate this error? For now, it's fire-and-forget.
+func (m *Manager) SaveAllBuffers() error {
+	return m.nvim.Command("wa!")
+}
+
+// ReloadFiles reloads the buffers of files changed on disk.
+func (m *Manager) ReloadFiles(paths []string) []model.Failure {
+	processFn := func(path string) (string, error) {
+		absPath, err := filepath.Abs(path)
+		if err != nil {
+			return path, err
+		}
+		return path, m.nvim.Command(fmt.Sprintf("edit! %s", absPath))
 	}
+	_, failed := backend.ProcessSequentially(paths, model.StageHook, processFn, nil)
+	return failed
 }
 
 // UndoFiles reverts a set of operations.
-func (m *Manager) UndoFiles(ops []state.Operation, stateDir string, progressCb func(int)) (undone, failed []string) {
-	processFn := func(op state.Operation) (string, bool) {
+func (m *Manager) UndoFiles(ops []state.Operation, stateDir string, progressCb func(int)) (undone []string, failed []model.Failure) {
+	processFn := func(op state.Operation) (string, error) {
 		return op.Path, m.undoFile(op, stateDir)
 	}
-	return processSequentially(ops, processFn, progressCb)
+	return backend.ProcessSequentially(ops, model.StageUndo, processFn, progressCb)
 }
 
-func (m *Manager) undoFile(op state.Operation, stateDir string) bool {
-	if op.Action == "delete" {
-		trashPath := filepath.Join(stateDir, state.TrashDir)
-		wd, _ := os.Getwd()
-		if err := fs.RestoreFileFromTrash(op.Path, trashPath, wd); err != nil {
-			return false
-		}
-		// Safety check: after restoring, does hash match?
-		restoredHash, err := fs.GetFileSHA256(op.Path)
-		if err != nil || restoredHash != op.ContentHash {
-			// Something is wrong. Maybe move it back to trash? For now, fail.
-			os.Remove(op.Path) // cleanup
-			return false
-		}
-		return true
-	}
-
-	if op.Action == "rename" {
-		// Undo rename is renaming NewPath back to OldPath (op.Path)
-		currentHash, err := fs.GetFileSHA256(op.NewPath)
-		if err != nil || currentHash != op.ContentHash {
-			return false
-		}
-		if _, err := os.Stat(op.Path); !os.IsNotExist(err) {
-			// Don't overwrite an existing file at the original path.
-			return false
-		}
-		return os.Rename(op.NewPath, op.Path) == nil
-	}
-
-	currentHash, err := fs.GetFileSHA256(op.Path)
-	if err != nil {
-		if os.IsNotExist(err) {
-			// If the file doesn't exist, the undo of a 'create' is successful.
-			return true
-		}
-		return false
+func (m *Manager) undoFile(op state.Operation, stateDir string) error {
+	switch op.Action {
+	case "delete":
+		return backend.UndoDelete(op, stateDir)
+	case "rename":
+		return backend.UndoRename(op, stateDir)
+	case "create":
+		return backend.UndoCreate(op)
+	case "chmod":
+		return backend.UndoChmod(op)
 	}
 
-	// Core safety check: if the file has been changed, abort the undo for this file.
-	if currentHash != op.ContentHash {
-		return false
+	// This is for "modify" action, since "create" is handled above.
+	if err := backend.CheckUndoModify(op); err != nil {
+		return err
 	}
-
-	// If hashes match, it's safe to proceed.
-	if op.Action == "create" {
-		if err := os.Remove(op.Path); err != nil {
-			return false
-		}
-
-		// Attempt to remove parent directory if it's empty
-		parentDir := filepath.Dir(op.Path)
-		if isEmpty, _ := fs.IsEmpty(parentDir); isEmpty {
-			if err := os.Remove(parentDir); err == nil {
-				// Successfully removed empty parent, no need to log.
+	if op.PrevHash == "" {
+		// Undoing must change the file, or Neovim had no change to undo.
+		return m.runHistoryCommand(op.Path, "undo", "redo", func(hash string) error {
+			if hash == op.ContentHash {
+				return errNoHistory
 			}
-		}
-		return true
+			return nil
+		})
 	}
-
-	// This is for "modify" action, since "create" is handled above.
-	absPath, _ := filepath.Abs(op.Path)
-	b := m.nvim.NewBatch()
-	b.Command(fmt.Sprintf("edit! %s", absPath))
-	b.Command("undo")
-	b.Command("write")
-	if err := b.Execute(); err != nil {
-		return false
+	if err := m.restoreObject(op.Path, op.PrevHash, stateDir); err != nil {
+		return err
 	}
-
-	return true
+	return backend.SetMode(op.Path, op.OldMode)
 }
 
 // RedoFiles redoes a set of operations.
-func (m *Manager) RedoFiles(ops []state.Operation, stateDir string, progressCb func(int)) (redone, failed []string) {
-	processFn := func(op state.Operation) (string, bool) {
+func (m *Manager) RedoFiles(ops []state.Operation, stateDir string, progressCb func(int)) (redone []string, failed []model.Failure) {
+	processFn := func(op state.Operation) (string, error) {
 		switch op.Action {
 		case "delete":
-			return op.Path, m.redoDelete(op, stateDir)
+			return op.Path, backend.RedoDelete(op, stateDir)
 		case "create", "modify":
-			return op.Path, m.redoFile(op.Path)
+			return op.Path, m.redoFile(op, stateDir)
 		case "rename":
-			return op.Path, m.redoRename(op)
+			return op.Path, backend.RedoRename(op, stateDir)
+		case "chmod":
+			return op.Path, backend.RedoChmod(op)
 		default:
-			return op.Path, false
+			return op.Path, fmt.Errorf("unknown action %q", op.Action)
 		}
 	}
-	return processSequentially(ops, processFn, progressCb)
+	return backend.ProcessSequentially(ops, model.StageUndo, processFn, progressCb)
 }
 
-func (m *Manager) redoRename(op state.Operation) bool {
-	// Redo rename is renaming OldPath (op.Path) to NewPath
-	currentHash, err := fs.GetFileSHA256(op.Path)
-	if err != nil || currentHash != op.ContentHash {
-		return false
+func (m *Manager) redoFile(op state.Operation, stateDir string) error {
+	if op.Action == "modify" && op.PrevHash == "" {
+		// What undoing left is not known, so check what redoing leads to.
+		return m.runHistoryCommand(op.Path, "redo", "undo", func(hash string) error {
+			if hash != op.ContentHash {
+				return backend.ErrChanged
+			}
+			return nil
+		})
 	}
-	if _, err := os.Stat(op.NewPath); !os.IsNotExist(err) {
-		// Don't overwrite an existing file at the new path.
-		return false
+	if err := backend.CheckRedoWrite(op); err != nil {
+		return err
 	}
-
-	return os.Rename(op.Path, op.NewPath) == nil
+	// Undoing a create may have removed the parent directory.
+	if err := os.MkdirAll(filepath.Dir(op.Path), 0755); err != nil {
+		return err
+	}
+	if err := m.restoreObject(op.Path, op.ContentHash, stateDir); err != nil {
+		return err
+	}
+	return backend.SetMode(op.Path, op.NewMode)
 }
 
-func (m *Manager) redoDelete(op state.Operation, stateDir string) bool {
-	// Safety check: does the file on disk match the hash we have?
-	currentHash, err := fs.GetFileSHA256(op.Path)
-	if err != nil || currentHash != op.ContentHash {
-		// File is not what we expect. Don't touch it.
-		return false
+// restoreObject writes a snapshot from the state directory to the file and
+// reloads its buffer, so the buffer matches the file on disk.
+func (m *Manager) restoreObject(filePath, hash, stateDir string) error {
+	if err := state.RestoreObject(stateDir, hash, filePath); err != nil {
+		return err
 	}
-
-	trashPath := filepath.Join(stateDir, state.TrashDir)
-	wd, _ := os.Getwd()
-	return fs.TrashFile(op.Path, trashPath, wd) == nil
+	absPath, _ := filepath.Abs(filePath)
+	return m.nvim.Command(fmt.Sprintf("edit! %s", absPath))
 }
 
-func (m *Manager) redoFile(filePath string) bool {
+// runHistoryCommand undoes or redoes the last change to a file with Neovim's
+// undo history, for operations recorded before snapshots were taken. check
+// is given the hash of the buffer after the command; if it returns an error,
+// the change is reverted with the inverse command and the file is not
+// written.
+func (m *Manager) runHistoryCommand(filePath, command, inverse string, check func(hash string) error) error {
 	absPath, _ := filepath.Abs(filePath)
+	var lines [][]byte
+	var eol, fixEOL bool
 	b := m.nvim.NewBatch()
 	b.Command(fmt.Sprintf("edit! %s", absPath))
-	b.Command("redo")
-	b.Command("write")
+	b.Command(command)
+	b.BufferLines(0, 0, -1, true, &lines)
+	b.BufferOption(0, "eol", &eol)
+	b.BufferOption(0, "fixeol", &fixEOL)
 	if err := b.Execute(); err != nil {
-		return false
+		return err
+	}
+	if err := check(bufferHash(lines, eol || fixEOL)); err != nil {
+		m.nvim.Command(inverse)
+		return err
+	}
+	return m.nvim.Command("write")
+}
+
+// bufferHash returns the SHA256 hash of the content Neovim writes for the
+// lines of a buffer.
+func bufferHash(lines [][]byte, eol bool) string {
+	hash := sha256.New()
+	for i, line := range lines {
+		if i > 0 {
+			hash.Write([]byte("\n"))
+		}
+		hash.Write(line)
+	}
+	if eol {
+		hash.Write([]byte("\n"))
 	}
-	return true
+	return hex.EncodeToString(hash.Sum(nil))
 }
@@ -0,0 +1,303 @@
+package parser
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/sokinpui/itf.go/internal/fs"
+	"github.com/sokinpui/itf.go/internal/patcher"
+	"github.com/sokinpui/itf.go/model"
+)
+
+// Markers of the apply_patch envelope used by coding agents, e.g.:
+//
+//	*** Begin Patch
+//	*** Update File: path/to/file.go
+//	@@ func main() {
+//	-	fmt.Println("old")
+//	+	fmt.Println("new")
+//	*** End Patch
+const (
+	beginPatchMarker = "*** Begin Patch"
+	endPatchMarker   = "*** End Patch"
+	addFileMarker    = "*** Add File: "
+	deleteFileMarker = "*** Delete File: "
+	updateFileMarker = "*** Update File: "
+	moveToMarker     = "*** Move to: "
+	endOfFileMarker  = "*** End of File"
+)
+
+// patchOp is a single file operation of an apply_patch envelope.
+type patchOp struct {
+	action   string // "add", "delete" or "update"
+	path     string
+	movePath string          // Only set for updates with "*** Move to:"
+	lines    []string        // Content of an added file
+	chunks   []patcher.Chunk // Changes of an updated file
+	raw      []string        // The lines of the operation, for RawBlock
+	err      error           // Set if the operation is malformed
+}
+
+// isApplyPatchBlock reports whether the content of a code block is an
+// apply_patch envelope, i.e., starts with "*** Begin Patch".
+func isApplyPatchBlock(content string) bool {
+	return firstNonBlank(strings.Split(content, "\n")) == beginPatchMarker
+}
+
+// firstNonBlank returns the first line of lines that is not blank, with its
+// surrounding whitespace trimmed, or "" if there is none.
+func firstNonBlank(lines []string) string {
+	for _, line := range lines {
+		if trimmed := strings.TrimSpace(line); trimmed != "" {
+			return trimmed
+		}
+	}
+	return ""
+}
+
+// parseApplyPatches finds the apply_patch envelopes of content and parses
+// their operations. An envelope can stand on its own or be a code block of
+// its own. Envelopes quoted in other code blocks, or in the body of one of
+// tags, are examples rather than operations, so they are skipped.
+func parseApplyPatches(content string, tags []tag) []patchOp {
+	var ops []patchOp
+	lines := strings.Split(content, "\n")
+	starts := make([]int, len(lines))
+	for i, pos := 0, 0; i < len(lines); i++ {
+		starts[i] = pos
+		pos += len(lines[i]) + 1
+		lines[i] = strings.TrimSuffix(lines[i], "\r")
+	}
+
+	var fence string // The opening fence of the code block being skipped
+	for i := 0; i < len(lines); i++ {
+		if inTagBody(tags, starts[i]) {
+			continue
+		}
+		if fence != "" {
+			if isClosingFence(lines[i], fence) {
+				fence = ""
+			}
+			continue
+		}
+		if match := fenceRegex.FindStringSubmatch(lines[i]); match != nil {
+			fence = match[1]
+			if firstNonBlank(lines[i+1:]) != beginPatchMarker {
+				continue
+			}
+			for i++; strings.TrimSpace(lines[i]) != beginPatchMarker; i++ {
+			}
+		} else if strings.TrimSpace(lines[i]) != beginPatchMarker {
+			continue
+		}
+		// Envelopes inside indented fences carry the fence's indentation.
+		indent := lines[i][:len(lines[i])-len(strings.TrimLeft(lines[i], " \t"))]
+
+		var body []string
+		for i++; i < len(lines); i++ {
+			line := strings.TrimPrefix(lines[i], indent)
+			trimmed := strings.TrimSpace(line)
+			if trimmed == endPatchMarker {
+				break
+			}
+			if fence != "" && isClosingFence(lines[i], fence) {
+				fence = ""
+				break
+			}
+			if fence == "" && fenceRegex.MatchString(lines[i]) {
+				i-- // An unclosed envelope ends at the next code block.
+				break
+			}
+			body = append(body, line)
+		}
+		ops = append(ops, parsePatchBody(body)...)
+	}
+	return ops
+}
+
+// parsePatchBody parses the lines between "*** Begin Patch" and
+// "*** End Patch".
+func parsePatchBody(body []string) []patchOp {
+	var ops []patchOp
+	var op *patchOp
+	var chunk *patcher.Chunk
+	var anchors []string
+
+	flushChunk := func() {
+		if chunk != nil && len(chunk.Lines) > 0 {
+			op.chunks = append(op.chunks, *chunk)
+		}
+		chunk = nil
+	}
+	flushOp := func() {
+		if op == nil {
+			return
+		}
+		flushChunk()
+		if op.action == "update" && len(op.chunks) == 0 && op.movePath == "" && op.err == nil {
+			op.err = fmt.Errorf("update has no changes")
+		}
+		ops = append(ops, *op)
+		op = nil
+	}
+
+	for _, line := range body {
+		switch {
+		case strings.HasPrefix(line, addFileMarker):
+			flushOp()
+			op = &patchOp{action: "add", path: strings.TrimSpace(strings.TrimPrefix(line, addFileMarker))}
+		case strings.HasPrefix(line, deleteFileMarker):
+			flushOp()
+			op = &patchOp{action: "delete", path: strings.TrimSpace(strings.TrimPrefix(line, deleteFileMarker))}
+		case strings.HasPrefix(line, updateFileMarker):
+			flushOp()
+			op = &patchOp{action: "update", path: strings.TrimSpace(strings.TrimPrefix(line, updateFileMarker))}
+			anchors = nil
+		case op == nil:
+			// Lines before the first operation are ignored.
+			continue
+		case op.action == "update" && strings.HasPrefix(line, moveToMarker):
+			op.movePath = strings.TrimSpace(strings.TrimPrefix(line, moveToMarker))
+		case op.action == "update" && strings.HasPrefix(line, "@@"):
+			// Consecutive "@@" lines narrow the location of the next chunk.
+			if chunk != nil {
+				flushChunk()
+				anchors = nil
+			}
+			if anchor := strings.TrimSpace(strings.TrimPrefix(line, "@@")); anchor != "" {
+				anchors = append(anchors, anchor)
+			}
+		case op.action == "update" && strings.TrimSpace(line) == endOfFileMarker:
+			if chunk != nil {
+				chunk.AtEOF = true
+			}
+			flushChunk()
+			anchors = nil
+		case op.action == "update":
+			if line == "" {
+				line = " "
+			}
+			if line[0] != ' ' && line[0] != '-' && line[0] != '+' {
+				if op.err == nil {
+					op.err = fmt.Errorf("invalid line: %q", line)
+				}
+				break
+			}
+			if chunk == nil {
+				chunk = &patcher.Chunk{Anchors: anchors}
+			}
+			chunk.Lines = append(chunk.Lines, line)
+		case op.action == "add":
+			if !strings.HasPrefix(line, "+") {
+				if op.err == nil && strings.TrimSpace(line) != "" {
+					op.err = fmt.Errorf("invalid line: %q", line)
+				}
+				break
+			}
+			op.lines = append(op.lines, line[1:])
+		default:
+			if op.err == nil && strings.TrimSpace(line) != "" {
+				op.err = fmt.Errorf("unexpected line: %q", line)
+			}
+		}
+		if op != nil {
+			op.raw = append(op.raw, line)
+		}
+	}
+	flushOp()
+	return ops
+}
+
+// planApplyPatches turns the apply_patch envelopes in content, outside of
+// tags, into file changes, deletes, renames and failures. Updates are
+// applied on top of earlier operations on the same file, so an envelope can
+// change a file more than once.
+func planApplyPatches(content string, tags []tag, resolver *fs.PathResolver, extensions []string) ([]model.FileChange, []string, []model.FileRename, []model.Failure) {
+	var deletes []string
+	var renames []model.FileRename
+	var failed []model.Failure
+	changes := make(map[string]model.FileChange)
+	var order []string
+
+	setChange := func(change model.FileChange) {
+		if _, found := changes[change.Path]; !found {
+			order = append(order, change.Path)
+		}
+		changes[change.Path] = change
+	}
+
+	for _, op := range parseApplyPatches(content, tags) {
+		fullPath := resolver.Resolve(op.path)
+		if op.err != nil {
+			failed = append(failed, model.Failure{Path: fullPath, Stage: model.StagePlan, Err: op.err})
+			continue
+		}
+
+		targetPath := op.path
+		if op.movePath != "" {
+			targetPath = op.movePath
+		}
+		if !HasAllowedExtension(targetPath, extensions) {
+			continue
+		}
+		if op.action == "delete" {
+			deletes = append(deletes, fullPath)
+			continue
+		}
+
+		rawBlock := fmt.Sprintf("%s\n%s\n%s", beginPatchMarker, strings.Join(op.raw, "\n"), endPatchMarker)
+
+		if op.action == "add" {
+			setChange(model.FileChange{Path: fullPath, Content: op.lines, Source: "patch", RawBlock: rawBlock})
+			continue
+		}
+
+		source, ok := currentLines(fullPath, changes, resolver)
+		if !ok {
+			failed = append(failed, model.Failure{Path: fullPath, Stage: model.StagePatch, Err: os.ErrNotExist})
+			continue
+		}
+		patched, _, err := patcher.ApplyChunks(source, op.chunks)
+		if err != nil {
+			failed = append(failed, patcher.BlockFailures(fullPath, "patch", rawBlock, err)...)
+			continue
+		}
+
+		if op.movePath != "" {
+			delete(changes, fullPath)
+			rename := model.FileRename{OldPath: fullPath, NewPath: resolver.Resolve(op.movePath)}
+			if len(op.chunks) > 0 {
+				rename.Content = patched
+			}
+			renames = append(renames, rename)
+			continue
+		}
+		setChange(model.FileChange{Path: fullPath, Content: patched, Source: "patch", RawBlock: rawBlock})
+	}
+
+	result := make([]model.FileChange, 0, len(changes))
+	for _, path := range order {
+		if change, found := changes[path]; found {
+			result = append(result, change)
+		}
+	}
+	return result, deletes, renames, failed
+}
+
+// currentLines returns the lines of a file as left by earlier operations in
+// the same run, or as on disk.
+func currentLines(path string, changes map[string]model.FileChange, resolver *fs.PathResolver) ([]string, bool) {
+	if change, found := changes[path]; found {
+		return change.Content, true
+	}
+	existing := resolver.ResolveExisting(path)
+	if existing == "" {
+		return nil, false
+	}
+	lines, err := fs.ReadLines(existing)
+	if err != nil {
+		return nil, false
+	}
+	return lines, true
+}
@@ -0,0 +1,122 @@
+package parser
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/sokinpui/itf.go/internal/fs"
+	"github.com/sokinpui/itf.go/internal/patcher"
+	"github.com/sokinpui/itf.go/model"
+)
+
+func TestParsePatchBody(t *testing.T) {
+	body := []string{
+		"*** Add File: new.go",
+		"+package new",
+		"+",
+		"*** Delete File: old.go",
+		"*** Update File: main.go",
+		"*** Move to: cmd/main.go",
+		"@@ func main() {",
+		"@@ \tif x {",
+		"-\ta",
+		"+\tb",
+		"@@",
+		" c",
+		"",
+		"-d",
+		"*** End of File",
+		"*** Update File: empty.go",
+		"*** Update File: bad.go",
+		"x",
+	}
+	want := []patchOp{
+		{action: "add", path: "new.go", lines: []string{"package new", ""}},
+		{action: "delete", path: "old.go"},
+		{action: "update", path: "main.go", movePath: "cmd/main.go", chunks: []patcher.Chunk{
+			{Anchors: []string{"func main() {", "if x {"}, Lines: []string{"-\ta", "+\tb"}},
+			{Lines: []string{" c", " ", "-d"}, AtEOF: true},
+		}},
+		{action: "update", path: "empty.go"},
+		{action: "update", path: "bad.go"},
+	}
+	wantErrs := []string{"", "", "", "update has no changes", `invalid line: "x"`}
+
+	ops := parsePatchBody(body)
+	if len(ops) != len(want) {
+		t.Fatalf("parsePatchBody() returned %d operations, want %d", len(ops), len(want))
+	}
+	for i, op := range ops {
+		errText := ""
+		if op.err != nil {
+			errText = op.err.Error()
+		}
+		if errText != wantErrs[i] {
+			t.Errorf("operation #%d: error %q, want %q", i+1, errText, wantErrs[i])
+		}
+		op.raw, op.err = nil, nil
+		if !reflect.DeepEqual(op, want[i]) {
+			t.Errorf("operation #%d = %+v, want %+v", i+1, op, want[i])
+		}
+	}
+}
+
+func TestPlanApplyPatches(t *testing.T) {
+	dir := t.TempDir()
+	t.Chdir(dir)
+	for name, content := range map[string]string{
+		"main.go":   "package main\n\nfunc main() {\n\tprintln(\"a\")\n}\n",
+		"old.go":    "package main\n",
+		"go.mod":    "module m\n",
+		"notes.txt": "notes\n",
+	} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	content := strings.Join([]string{
+		"```markdown",
+		"Example:",
+		"*** Begin Patch",
+		"*** Delete File: main.go",
+		"*** End Patch",
+		"```",
+		"",
+		"*** Begin Patch",
+		"*** Update File: main.go",
+		"@@ func main() {",
+		"-\tprintln(\"a\")",
+		"+\tprintln(\"b\")",
+		"*** Delete File: go.mod",
+		"*** Delete File: old.go",
+		"*** Update File: notes.txt",
+		"*** Move to: notes.go",
+		"*** Add File: readme.md",
+		"+hi",
+		"*** Update File: missing.go",
+		"@@",
+		"-a",
+		"+b",
+		"*** End Patch",
+	}, "\n")
+
+	changes, deletes, renames, failed := planApplyPatches(content, nil, fs.NewPathResolver(), []string{".go"})
+
+	if len(changes) != 1 || changes[0].Path != filepath.Join(dir, "main.go") || changes[0].Content[3] != "\tprintln(\"b\")" {
+		t.Errorf("changes = %+v, want main.go updated", changes)
+	}
+	if want := []string{filepath.Join(dir, "old.go")}; !slices.Equal(deletes, want) {
+		t.Errorf("deletes = %q, want %q", deletes, want)
+	}
+	wantRename := model.FileRename{OldPath: filepath.Join(dir, "notes.txt"), NewPath: filepath.Join(dir, "notes.go")}
+	if len(renames) != 1 || !reflect.DeepEqual(renames[0], wantRename) {
+		t.Errorf("renames = %+v, want %+v", renames, wantRename)
+	}
+	if len(failed) != 1 || failed[0].Path != filepath.Join(dir, "missing.go") || failed[0].Stage != model.StagePatch {
+		t.Errorf("failed = %v, want missing.go", failed)
+	}
+}
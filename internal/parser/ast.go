@@ -7,21 +7,26 @@ import (
 	"github.com/yuin/goldmark"
 	"github.com/yuin/goldmark/ast"
 	"github.com/yuin/goldmark/text"
+
+	"github.com/sokinpui/itf.go/model"
 )
 
 // CodeBlock represents a parsed code block from markdown content.
-type CodeBlock struct {
-	// Hint is the content of the paragraph immediately preceding the code block.
-	Hint string
-	// Lang is the language identifier of the code block (e.g., "go", "diff").
-	Lang string
-	// Content is the raw text inside the code block.
-	Content string
-}
+type CodeBlock = model.CodeBlock
 
 // ExtractCodeBlocks uses a markdown AST to find all fenced code blocks
-// and their preceding paragraph, which is treated as a hint.
-func ExtractCodeBlocks(source []byte) ([]CodeBlock, error) {
+// and their preceding paragraph, which is treated as a hint. Code blocks in
+// the body of a file operation tag are part of its content, so they are
+// skipped. The path of each block is taken from the first of the hint
+// sources that names one, in the order of hints, or of DefaultHintSources
+// if hints is nil.
+func ExtractCodeBlocks(source []byte, hints []string) ([]CodeBlock, error) {
+	return extractCodeBlocks(source, parseTags(string(source)), hints)
+}
+
+// extractCodeBlocks is ExtractCodeBlocks with the tags of source already
+// parsed.
+func extractCodeBlocks(source []byte, tags []tag, hints []string) ([]CodeBlock, error) {
 	var blocks []CodeBlock
 	parser := goldmark.DefaultParser()
 	root := parser.Parse(text.NewReader(source))
@@ -36,24 +41,31 @@ func ExtractCodeBlocks(source []byte) ([]CodeBlock, error) {
 			return ast.WalkContinue, nil
 		}
 
+		lines := fencedCodeBlock.Lines()
+		if lines.Len() > 0 && inTagBody(tags, lines.At(0).Start) {
+			return ast.WalkSkipChildren, nil
+		}
+
 		var block CodeBlock
 		if fencedCodeBlock.Info != nil {
 			block.Lang = string(fencedCodeBlock.Info.Text(source))
 		}
 
 		var content bytes.Buffer
-		lines := fencedCodeBlock.Lines()
 		for i := 0; i < lines.Len(); i++ {
 			line := lines.At(i)
 			content.Write(line.Value(source))
 		}
 		block.Content = content.String()
 
-		if prev := fencedCodeBlock.PreviousSibling(); prev != nil {
-			if p, ok := prev.(*ast.Paragraph); ok {
-				block.Hint = strings.TrimSpace(string(p.Text(source)))
-			}
+		var heading string
+		switch prev := fencedCodeBlock.PreviousSibling().(type) {
+		case *ast.Paragraph:
+			block.Hint = strings.TrimSpace(string(prev.Text(source)))
+		case *ast.Heading:
+			heading = string(prev.Lines().Value(source))
 		}
+		block.Path = blockPath(block, heading, hints)
 
 		blocks = append(blocks, block)
 		return ast.WalkSkipChildren, nil
@@ -0,0 +1,75 @@
+package parser
+
+import (
+	"fmt"
+
+	"github.com/sokinpui/itf.go/internal/fs"
+	"github.com/sokinpui/itf.go/internal/patcher"
+	"github.com/sokinpui/itf.go/model"
+)
+
+// diffHeaderPlan holds the file-level operations found in the headers of
+// diff blocks.
+type diffHeaderPlan struct {
+	diffs   []model.DiffBlock // Diffs whose hunks still need to be applied
+	changes []model.FileChange
+	deletes []string
+	renames []model.FileRename
+	chmods  []model.FileChmod
+	failed  []model.Failure
+}
+
+// planDiffHeaders handles the git extended headers of diff blocks. A diff
+// to /dev/null becomes a delete, a rename header a rename whose content is
+// patched by the diff's hunks, and a mode change a chmod. With
+// opts.Partial, a rename is made with the hunks that apply. New files are
+// created with the lines their hunks add. Diffs that only patch content are
+// passed through.
+func planDiffHeaders(diffs []model.DiffBlock, resolver *fs.PathResolver, extensions []string, opts patcher.Options) diffHeaderPlan {
+	var p diffHeaderPlan
+	for _, diff := range diffs {
+		h := patcher.ParseDiffHeader(diff.RawContent)
+		if !HasAllowedExtension(h.Path(), extensions) {
+			continue
+		}
+
+		switch {
+		case h.Deleted:
+			p.deletes = append(p.deletes, resolver.Resolve(h.OldPath))
+			continue
+		case h.Renamed:
+			rename := model.FileRename{
+				OldPath: resolver.Resolve(h.OldPath),
+				NewPath: resolver.Resolve(h.NewPath),
+			}
+			if h.Hunks {
+				patched, failed, _ := patcher.GeneratePatchedContents(
+					[]model.DiffBlock{{FilePath: h.OldPath, RawContent: diff.RawContent}}, resolver, nil, opts)
+				p.failed = append(p.failed, failed...)
+				if len(patched) == 0 {
+					continue
+				}
+				rename.Content = patched[0].Content
+				if partial := patched[0].Partial; partial != nil {
+					partial.Path = rename.NewPath
+					rename.Partial = partial
+				}
+			}
+			p.renames = append(p.renames, rename)
+		case h.NewFile:
+			p.changes = append(p.changes, model.FileChange{
+				Path:     resolver.Resolve(h.NewPath),
+				Content:  patcher.NewFileContent(diff.RawContent),
+				Source:   "diff",
+				RawBlock: fmt.Sprintf("```diff\n%s\n```", diff.RawContent),
+			})
+		case h.Hunks:
+			p.diffs = append(p.diffs, diff)
+		}
+
+		if h.ModeChanged() {
+			p.chmods = append(p.chmods, model.FileChmod{Path: resolver.Resolve(h.NewPath), Mode: h.NewMode})
+		}
+	}
+	return p
+}
@@ -0,0 +1,145 @@
+package parser
+
+import (
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/sokinpui/itf.go/internal/fs"
+	"github.com/sokinpui/itf.go/internal/patcher"
+	"github.com/sokinpui/itf.go/model"
+)
+
+// registration is a block handler with the code blocks it claims.
+type registration struct {
+	claims  func(block CodeBlock) bool
+	handler model.BlockHandler
+}
+
+var (
+	registryMu sync.RWMutex
+	registry   []registration // Most recently registered first
+)
+
+// builtinHandlers handle the block formats itf understands, in the order in
+// which they claim blocks. Blocks that none of them claims are file blocks.
+var builtinHandlers = []registration{
+	// Patch envelopes are planned from the whole content, since they need
+	// not be fenced.
+	{func(b CodeBlock) bool { return isApplyPatchBlock(b.Content) }, model.BlockHandlerFunc(skipBlock)},
+	{isSearchReplaceBlock, model.BlockHandlerFunc(handleSearchReplace)},
+	{languageIs("diff"), model.BlockHandlerFunc(handleDiffBlock)},
+	{languageIs("delete"), model.BlockHandlerFunc(handleDeleteBlock)},
+	{languageIs("rename"), model.BlockHandlerFunc(handleRenameBlock)},
+	// Tool blocks are only printed, with --output-tool.
+	{languageIs("tool"), model.BlockHandlerFunc(skipBlock)},
+}
+
+// RegisterHandler registers a handler for the code blocks whose language,
+// the first word of the info string, is lang. Registered handlers take
+// precedence over the built-in ones and over the handlers registered before
+// them, so they can also take over a built-in language such as "diff".
+func RegisterHandler(lang string, h model.BlockHandler) {
+	register(languageIs(lang), h)
+}
+
+// RegisterHandlerPattern registers a handler for the code blocks whose whole
+// info string matches pattern, with the same precedence as RegisterHandler.
+func RegisterHandlerPattern(pattern *regexp.Regexp, h model.BlockHandler) {
+	register(func(b CodeBlock) bool { return pattern.MatchString(b.Lang) }, h)
+}
+
+func register(claims func(CodeBlock) bool, h model.BlockHandler) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	registry = append([]registration{{claims, h}}, registry...)
+}
+
+// languageIs returns a function that reports whether a code block is in
+// the given language.
+func languageIs(lang string) func(CodeBlock) bool {
+	return func(b CodeBlock) bool { return blockLanguage(b) == lang }
+}
+
+// blockLanguage returns the language of a code block, the first word of its
+// info string up to a colon, e.g., "go" for "go:main.go".
+func blockLanguage(block CodeBlock) string {
+	if fields := strings.Fields(block.Lang); len(fields) > 0 {
+		lang, _, _ := strings.Cut(fields[0], ":")
+		return lang
+	}
+	return ""
+}
+
+// planEnv is the model.BlockEnv of a plan being created. It keeps the
+// changes of the blocks handled so far, so that later blocks build on them.
+type planEnv struct {
+	resolver   *fs.PathResolver
+	extensions []string
+	opts       patcher.Options
+	changes    map[string]model.FileChange
+}
+
+func (e *planEnv) Resolve(path string) string {
+	return e.resolver.Resolve(path)
+}
+
+func (e *planEnv) Lines(path string) ([]string, bool) {
+	return currentLines(path, e.changes, e.resolver)
+}
+
+func (e *planEnv) Allowed(path string) bool {
+	return HasAllowedExtension(path, e.extensions)
+}
+
+// handleBlocks passes each code block to the first handler that claims it,
+// registered handlers first, and collects their operations. Blocks that no
+// handler claims are file blocks, which are skipped unless fileBlocks is
+// set. Changes to the same file replace each other in block order.
+func (e *planEnv) handleBlocks(blocks []CodeBlock, fileBlocks bool) model.BlockOperations {
+	registryMu.RLock()
+	handlers := append(append([]registration(nil), registry...), builtinHandlers...)
+	registryMu.RUnlock()
+
+	var all model.BlockOperations
+	for _, block := range blocks {
+		var handler model.BlockHandler
+		for _, r := range handlers {
+			if r.claims(block) {
+				handler = r.handler
+				break
+			}
+		}
+		if handler == nil {
+			if !fileBlocks {
+				continue
+			}
+			handler = model.BlockHandlerFunc(e.handleFileBlock)
+		}
+		e.add(&all, handler.HandleBlock(block, e))
+	}
+	return all
+}
+
+// add adds the operations of a block to all. A change replaces an earlier
+// change to the same file, and is kept in e.changes for the blocks after it.
+func (e *planEnv) add(all *model.BlockOperations, ops model.BlockOperations) {
+	for _, change := range ops.Changes {
+		e.changes[change.Path] = change
+		if i := slices.IndexFunc(all.Changes, func(c model.FileChange) bool { return c.Path == change.Path }); i >= 0 {
+			all.Changes[i] = change
+		} else {
+			all.Changes = append(all.Changes, change)
+		}
+	}
+	all.Diffs = append(all.Diffs, ops.Diffs...)
+	all.Deletes = append(all.Deletes, ops.Deletes...)
+	all.Renames = append(all.Renames, ops.Renames...)
+	all.Failed = append(all.Failed, ops.Failed...)
+}
+
+// skipBlock plans nothing for a block.
+func skipBlock(CodeBlock, model.BlockEnv) model.BlockOperations {
+	return model.BlockOperations{}
+}
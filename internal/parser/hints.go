@@ -0,0 +1,160 @@
+package parser
+
+import (
+	"path"
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+// Sources of the path of a code block.
+const (
+	HintInfo      = "info"
+	HintParagraph = "paragraph"
+	HintHeading   = "heading"
+	HintComment   = "comment"
+)
+
+// HintSources lists the sources of the path of a code block.
+var HintSources = []string{HintInfo, HintParagraph, HintHeading, HintComment}
+
+// DefaultHintSources are the sources used when none are given, in order of
+// precedence. Headings are left out, as a heading such as "### setup.sh"
+// is as often the title of an example as the name of a file to write.
+var DefaultHintSources = []string{HintInfo, HintParagraph, HintComment}
+
+var (
+	// pathInHintRegex extracts a path from a hint line, e.g., `path/to/file.go`.
+	pathInHintRegex = regexp.MustCompile("^`([^`\n]+)`")
+	// boldHintRegex extracts a bold hint line, e.g., **path/to/file.go**.
+	boldHintRegex = regexp.MustCompile(`^\*\*([^*\n]+)\*\*`)
+	// infoAttrRegex extracts a path attribute of an info string, e.g.,
+	// title="path/to/file.go".
+	infoAttrRegex = regexp.MustCompile(`(?:^|\s)(?:title|file|filename|path)=(?:"([^"]*)"|'([^']*)'|(\S+))`)
+	// labelRegex matches a label before a path, e.g., "File: ".
+	labelRegex = regexp.MustCompile(`(?i)^(?:file(?:name|path)?|path)\s*:\s*`)
+	// commentHintRegex extracts the path from a comment naming the file,
+	// e.g., "// File: path/to/file.go" or "<!-- path: index.html -->".
+	commentHintRegex = regexp.MustCompile(`^\s*(?://|#|--|;|/\*|<!--)\s*(?i:file(?:name|path)?|path)\s*:\s*(\S+?)\s*(?:\*/|-->)?\s*$`)
+)
+
+// knownExtensions are the extensions, without the dot, that make a single
+// name in a heading, hint or info string a path.
+var knownExtensions = map[string]bool{
+	"go": true, "mod": true, "sum": true, "c": true, "h": true, "cc": true, "cpp": true, "hpp": true,
+	"cs": true, "java": true, "kt": true, "kts": true, "scala": true, "swift": true, "rs": true,
+	"js": true, "jsx": true, "mjs": true, "cjs": true, "ts": true, "tsx": true, "dart": true,
+	"zig": true, "proto": true, "php": true, "py": true, "pyi": true, "ipynb": true, "rb": true,
+	"sh": true, "bash": true, "zsh": true, "fish": true, "ps1": true, "bat": true, "pl": true,
+	"r": true, "ex": true, "exs": true, "erl": true, "nix": true, "sql": true, "lua": true,
+	"hs": true, "elm": true, "clj": true, "el": true, "lisp": true, "scm": true, "vim": true,
+	"html": true, "htm": true, "xml": true, "svg": true, "vue": true, "svelte": true, "css": true,
+	"scss": true, "less": true, "json": true, "jsonc": true, "yaml": true, "yml": true,
+	"toml": true, "ini": true, "cfg": true, "conf": true, "env": true, "properties": true,
+	"gradle": true, "cmake": true, "mk": true, "tf": true, "hcl": true, "graphql": true,
+	"md": true, "mdx": true, "rst": true, "tex": true, "txt": true, "csv": true, "lock": true,
+	"tmpl": true, "tpl": true, "diff": true, "patch": true,
+}
+
+// blockPath returns the path of a code block from the first of the hint
+// sources that names one, in the order of hints, or of DefaultHintSources
+// if hints is nil. A first-line
+// comment naming the path is left in the content, as it may well be part of
+// the file.
+func blockPath(block CodeBlock, heading string, hints []string) string {
+	if hints == nil {
+		hints = DefaultHintSources
+	}
+	for _, source := range hints {
+		var path string
+		switch source {
+		case HintInfo:
+			path = pathFromInfo(block.Lang)
+		case HintParagraph:
+			path = ExtractPathFromHint(block.Hint)
+		case HintHeading:
+			path = pathFromLabel(heading)
+		case HintComment:
+			firstLine, _, _ := strings.Cut(block.Content, "\n")
+			if match := commentHintRegex.FindStringSubmatch(firstLine); match != nil {
+				path = match[1]
+			}
+		}
+		if path != "" {
+			return path
+		}
+	}
+	return ""
+}
+
+// pathFromInfo returns the path given in the info string of a code block,
+// as a path attribute, after a colon following the language, or as the
+// word after the language. A word starting with "./", as in "sh ./run.sh",
+// is the command the block runs or shows rather than a path.
+func pathFromInfo(info string) string {
+	if match := infoAttrRegex.FindStringSubmatch(info); match != nil {
+		return strings.TrimSpace(match[1] + match[2] + match[3])
+	}
+	fields := strings.Fields(info)
+	if len(fields) == 0 {
+		return ""
+	}
+	if _, path, found := strings.Cut(fields[0], ":"); found && looksLikePath(path) {
+		return path
+	}
+	if len(fields) > 1 && !strings.HasPrefix(fields[1], "./") && looksLikePath(fields[1]) {
+		return fields[1]
+	}
+	return ""
+}
+
+// ExtractPathFromHint returns the path in the paragraph before a code block,
+// in backticks or in bold, e.g., `path/to/file.go` or **path/to/file.go**.
+func ExtractPathFromHint(hint string) string {
+	hint = strings.TrimSpace(hint)
+
+	// A path hint must be enclosed in backticks, e.g., `path/to/file.go`
+	if match := pathInHintRegex.FindStringSubmatch(hint); len(match) > 1 {
+		path := strings.TrimSpace(match[1])
+		// Disallow spaces to avoid capturing commands like `go run main.go` as a path.
+		if !strings.Contains(path, " ") {
+			return path
+		}
+	}
+
+	if match := boldHintRegex.FindStringSubmatch(hint); len(match) > 1 {
+		return pathFromLabel(match[1])
+	}
+	return ""
+}
+
+// pathFromLabel returns the path in a heading or bold hint, which may be in
+// backticks, labeled, e.g., "File: main.go", or followed by a colon. It
+// returns "" if the text does not look like a single path.
+func pathFromLabel(text string) string {
+	text = labelRegex.ReplaceAllString(strings.TrimSpace(text), "")
+	text = strings.TrimSuffix(strings.Trim(text, "`*"), ":")
+	text = strings.Trim(text, "`")
+	if !looksLikePath(text) {
+		return ""
+	}
+	return text
+}
+
+// looksLikePath reports whether s can be taken for a file path: a single
+// word that is not a URL, with a slash between directories, e.g.,
+// "cmd/main.go", or a name with a known extension, e.g., "main.go". Words
+// without letters, such as "1." or "1/2", and versions such as "v2.0" are
+// not paths.
+func looksLikePath(s string) bool {
+	if s == "" || strings.ContainsAny(s, " \t`*") || strings.Contains(s, "://") ||
+		!strings.ContainsFunc(s, unicode.IsLetter) {
+		return false
+	}
+	if strings.Contains(strings.Trim(strings.TrimPrefix(s, "./"), "/"), "/") {
+		return true
+	}
+	ext := path.Ext(s)
+	return knownExtensions[strings.ToLower(strings.TrimPrefix(ext, "."))] &&
+		strings.ContainsFunc(strings.TrimSuffix(path.Base(s), ext), unicode.IsLetter)
+}
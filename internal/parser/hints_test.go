@@ -0,0 +1,131 @@
+package parser
+
+import "testing"
+
+func TestBlockPath(t *testing.T) {
+	tests := []struct {
+		name    string
+		block   CodeBlock
+		heading string
+		hints   []string
+		want    string
+	}{
+		{
+			name:  "info attribute",
+			block: CodeBlock{Lang: `go title="cmd/main.go"`},
+			want:  "cmd/main.go",
+		},
+		{
+			name:  "info after a colon",
+			block: CodeBlock{Lang: "go:main.go"},
+			want:  "main.go",
+		},
+		{
+			name:  "info word",
+			block: CodeBlock{Lang: "go main.go"},
+			want:  "main.go",
+		},
+		{
+			name:  "command in the info string",
+			block: CodeBlock{Lang: "sh ./run.sh"},
+			want:  "",
+		},
+		{
+			name:  "paragraph in backticks",
+			block: CodeBlock{Hint: "`main.go`"},
+			want:  "main.go",
+		},
+		{
+			name:  "paragraph in bold with a label",
+			block: CodeBlock{Hint: "**File: main.go**"},
+			want:  "main.go",
+		},
+		{
+			name:  "command in backticks",
+			block: CodeBlock{Hint: "`go run main.go`"},
+			want:  "",
+		},
+		{
+			name:  "first-line comment",
+			block: CodeBlock{Content: "# path: app.py\nprint()"},
+			want:  "app.py",
+		},
+		{
+			name:    "heading ignored by default",
+			block:   CodeBlock{Lang: "bash", Content: "echo hi"},
+			heading: "setup.sh",
+			want:    "",
+		},
+		{
+			name:    "heading when enabled",
+			block:   CodeBlock{Lang: "bash", Content: "echo hi"},
+			heading: "`setup.sh`",
+			hints:   []string{HintHeading},
+			want:    "setup.sh",
+		},
+		{
+			name:  "info before paragraph before comment",
+			block: CodeBlock{Lang: "go a.go", Hint: "`b.go`", Content: "// File: c.go"},
+			want:  "a.go",
+		},
+		{
+			name:  "paragraph before comment",
+			block: CodeBlock{Lang: "go", Hint: "`b.go`", Content: "// File: c.go"},
+			want:  "b.go",
+		},
+		{
+			name:    "order of the given hints",
+			block:   CodeBlock{Lang: "go a.go", Hint: "`b.go`", Content: "// File: c.go"},
+			heading: "d.go",
+			hints:   []string{HintComment, HintHeading, HintInfo},
+			want:    "c.go",
+		},
+		{
+			name:  "disabled sources",
+			block: CodeBlock{Lang: "go a.go", Hint: "`b.go`", Content: "// File: c.go"},
+			hints: []string{HintParagraph},
+			want:  "b.go",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := blockPath(tt.block, tt.heading, tt.hints); got != tt.want {
+				t.Errorf("blockPath() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLooksLikePath(t *testing.T) {
+	tests := []struct {
+		s    string
+		want bool
+	}{
+		{"main.go", true},
+		{"cmd/main.go", true},
+		{"./cmd/main.go", true},
+		{"src/Makefile", true},
+		{"README.MD", true},
+		{".github/workflows/ci.yml", true},
+		{"Usage", false},
+		{"v2.0", false},
+		{"1.", false},
+		{"1/2", false},
+		{"2024.json", false},
+		{"e.g.", false},
+		{"Makefile", false},
+		{"./run", false},
+		{"main.go:", false},
+		{"go run main.go", false},
+		{"https://example.com/a.go", false},
+		{"*.go", false},
+		{"", false},
+	}
+
+	for _, tt := range tests {
+		if got := looksLikePath(tt.s); got != tt.want {
+			t.Errorf("looksLikePath(%q) = %v, want %v", tt.s, got, tt.want)
+		}
+	}
+}
@@ -4,7 +4,6 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
-	"regexp"
 	"strings"
 
 	"github.com/sokinpui/itf.go/internal/fs"
@@ -17,19 +16,18 @@ type ExecutionPlan struct {
 	Changes      []model.FileChange
 	Deletes      []string
 	Renames      []model.FileRename
-	FileActions  map[string]string // Maps absolute path to "create" or "modify"
+	Chmods       []model.FileChmod
+	FileActions  map[string]string // Maps absolute path to "create", "modify", "delete", "rename" or "chmod"
 	DirsToCreate map[string]struct{}
-	Failed       []string // Files that failed during planning (e.g., bad patch)
+	Failed       []model.Failure // Files that failed during planning (e.g., bad patch)
+	Warnings     []model.Failure // Changes kept in the plan even though they failed validation
 }
 
-var (
-	// pathInHintRegex extracts a path from a hint line, e.g., `path/to/file.go`.
-	pathInHintRegex = regexp.MustCompile("^`([^`\n]+)`")
-)
-
-// CreatePlan parses content and generates a plan of file changes.
-func CreatePlan(content string, resolver *fs.PathResolver, extensions []string) (*ExecutionPlan, error) {
-	allBlocks, err := ExtractCodeBlocks([]byte(content))
+// CreatePlan parses content and generates a plan of file changes. hints are
+// the sources of the paths of file blocks, as for ExtractCodeBlocks.
+func CreatePlan(content string, resolver *fs.PathResolver, extensions []string, hints []string, opts patcher.Options) (*ExecutionPlan, error) {
+	tags := parseTags(content)
+	allBlocks, err := extractCodeBlocks([]byte(content), tags, hints)
 	if err != nil {
 		return nil, fmt.Errorf("failed to parse markdown content: %w", err)
 	}
@@ -37,32 +35,51 @@ func CreatePlan(content string, resolver *fs.PathResolver, extensions []string)
 	// If '.diff' is the ONLY extension, we are in a special diff-only mode.
 	isDiffOnlyMode := len(extensions) == 1 && extensions[0] == ".diff"
 
-	var fileBlocks []model.FileChange
-	if !isDiffOnlyMode {
-		fileBlocks = parseFileBlocks(allBlocks, resolver, extensions)
-	}
-
-	diffBlocks := extractDiffBlocksFromParsed(allBlocks)
-	deletePaths := parseDeletePaths(allBlocks, resolver)
-	renames := parseRenameBlocks(allBlocks, resolver)
-
 	patcherExtensions := extensions
 	if isDiffOnlyMode {
 		// In diff-only mode, don't filter patches by extension.
 		patcherExtensions = []string{}
 	}
-	patchedChanges, failedPatches, err := patcher.GeneratePatchedContents(diffBlocks, resolver, patcherExtensions)
+
+	env := &planEnv{resolver: resolver, extensions: patcherExtensions, opts: opts, changes: make(map[string]model.FileChange)}
+	blockOps := env.handleBlocks(allBlocks, !isDiffOnlyMode)
+	tagOps := env.handleTags(tags, !isDiffOnlyMode)
+	deletePaths := append(blockOps.Deletes, tagOps.Deletes...)
+	renames := append(blockOps.Renames, tagOps.Renames...)
+
+	// Deletes, renames and mode changes from git's extended diff headers.
+	headers := planDiffHeaders(blockOps.Diffs, resolver, patcherExtensions, opts)
+	deletePaths = append(deletePaths, headers.deletes...)
+	renames = append(renames, headers.renames...)
+
+	patchedChanges, failedPatches, err := patcher.GeneratePatchedContents(headers.diffs, resolver, patcherExtensions, opts)
 	if err != nil {
 		return nil, fmt.Errorf("failed during patch generation: %w", err)
 	}
+	patchedChanges = append(headers.changes, patchedChanges...)
+	failedPatches = append(headers.failed, failedPatches...)
 
-	// Combine changes, letting file blocks overwrite diff patches for the same file.
+	envelopeChanges, envelopeDeletes, envelopeRenames, failedEnvelopes := planApplyPatches(content, tags, resolver, patcherExtensions)
+	deletePaths = append(deletePaths, envelopeDeletes...)
+	renames = append(renames, envelopeRenames...)
+	failedPatches = append(failedPatches, failedEnvelopes...)
+	failedPatches = append(failedPatches, blockOps.Failed...)
+	failedPatches = append(failedPatches, tagOps.Failed...)
+
+	// Combine changes, letting file blocks and edits overwrite diff patches
+	// for the same file, and tags overwrite both.
 	finalChanges := make(map[string]model.FileChange)
 	for _, change := range patchedChanges {
 		finalChanges[change.Path] = change
 	}
-	for _, block := range fileBlocks {
-		finalChanges[block.Path] = block
+	for _, change := range envelopeChanges {
+		finalChanges[change.Path] = change
+	}
+	for _, change := range blockOps.Changes {
+		finalChanges[change.Path] = change
+	}
+	for _, change := range tagOps.Changes {
+		finalChanges[change.Path] = change
 	}
 
 	// Filter out changes for files that are marked for deletion.
@@ -81,14 +98,24 @@ func CreatePlan(content string, resolver *fs.PathResolver, extensions []string)
 
 	// Convert map to slice for ordered processing.
 	planChanges := make([]model.FileChange, 0, len(finalChanges))
-	targetPaths := make([]string, 0, len(finalChanges))
 	for _, change := range finalChanges {
 		planChanges = append(planChanges, change)
+	}
+
+	return NewExecutionPlan(planChanges, deletePaths, renames, headers.chmods, failedPatches), nil
+}
+
+// NewExecutionPlan builds a plan from a set of changes, deletes, renames and
+// mode changes, determining the action for each file and the directories to
+// create.
+func NewExecutionPlan(changes []model.FileChange, deletes []string, renames []model.FileRename, chmods []model.FileChmod, failed []model.Failure) *ExecutionPlan {
+	targetPaths := make([]string, 0, len(changes))
+	for _, change := range changes {
 		targetPaths = append(targetPaths, change.Path)
 	}
 
 	actions, dirs := fs.GetFileActionsAndDirs(targetPaths)
-	for _, path := range deletePaths {
+	for _, path := range deletes {
 		actions[path] = "delete"
 	}
 	for _, rename := range renames {
@@ -100,53 +127,82 @@ func CreatePlan(content string, resolver *fs.PathResolver, extensions []string)
 			}
 		}
 	}
+	for _, chmod := range chmods {
+		if _, found := actions[chmod.Path]; !found {
+			actions[chmod.Path] = "chmod"
+		}
+	}
 	return &ExecutionPlan{
-		Changes:      planChanges,
-		Deletes:      deletePaths,
+		Changes:      changes,
+		Deletes:      deletes,
 		Renames:      renames,
+		Chmods:       chmods,
 		FileActions:  actions,
 		DirsToCreate: dirs,
-		Failed:       failedPatches,
-	}, nil
+		Failed:       failed,
+	}
 }
 
-func parseFileBlocks(allBlocks []CodeBlock, resolver *fs.PathResolver, extensions []string) []model.FileChange {
-	var blocks []model.FileChange
+// handleFileBlock returns the full content of a code block with a path. A
+// block that elides unchanged parts of an existing file, e.g., with
+// "// ... existing code ...", is merged with the file; if it cannot be, the
+// block is reported as failed rather than truncating the file. With
+// MergeGo, a block for an existing .go file is merged with the file
+// declaration by declaration.
+func (e *planEnv) handleFileBlock(block CodeBlock, env model.BlockEnv) model.BlockOperations {
+	var ops model.BlockOperations
+	filePath := block.Path
+	if filePath == "" || !env.Allowed(filePath) {
+		return ops
+	}
 
-	for _, block := range allBlocks {
-		if block.Lang == "diff" || block.Lang == "tool" || block.Lang == "delete" || block.Lang == "rename" {
-			continue // Diffs are handled separately.
-		}
+	trimmedContent := strings.TrimRight(block.Content, "\n")
+	lines := strings.Split(trimmedContent, "\n")
+	// Handle empty blocks correctly.
+	if len(lines) == 1 && lines[0] == "" {
+		lines = []string{}
+	}
 
-		filePath := ExtractPathFromHint(block.Hint)
-		if filePath == "" {
-			continue
+	fullPath := env.Resolve(filePath)
+	if patcher.HasElisions(lines, filePath) {
+		source, ok := env.Lines(fullPath)
+		if !ok {
+			ops.Failed = append(ops.Failed, model.Failure{
+				Path:  fullPath,
+				Stage: model.StagePatch,
+				Err:   fmt.Errorf("the block elides existing content: %w", os.ErrNotExist),
+			})
+			return ops
 		}
-
-		if !HasAllowedExtension(filePath, extensions) {
-			continue
+		merged, err := patcher.MergeElided(source, lines, filePath)
+		if err != nil {
+			ops.Failed = append(ops.Failed, model.Failure{Path: fullPath, Stage: model.StagePatch, Err: err})
+			return ops
 		}
-
-		trimmedContent := strings.TrimRight(block.Content, "\n")
-		lines := strings.Split(trimmedContent, "\n")
-		// Handle empty blocks correctly.
-		if len(lines) == 1 && lines[0] == "" {
-			lines = []string{}
+		lines = merged
+	} else if filepath.Ext(filePath) == ".go" && e.opts.MergeGo {
+		if source, ok := env.Lines(fullPath); ok {
+			merged, err := patcher.MergeGoDecls(source, lines)
+			if err != nil {
+				ops.Failed = append(ops.Failed, model.Failure{Path: fullPath, Stage: model.StagePatch, Err: err})
+				return ops
+			}
+			lines = merged
 		}
-
-		blocks = append(blocks, model.FileChange{
-			Path:     resolver.Resolve(filePath),
-			Content:  lines,
-			Source:   "codeblock",
-			RawBlock: fmt.Sprintf("```%s\n%s\n```", block.Lang, trimmedContent),
-		})
 	}
-	return blocks
+
+	ops.Changes = append(ops.Changes, model.FileChange{
+		Path:     fullPath,
+		Content:  lines,
+		Source:   "codeblock",
+		RawBlock: fmt.Sprintf("```%s\n%s\n```", block.Lang, trimmedContent),
+	})
+	return ops
 }
 
 // ExtractDiffBlocks finds all diff blocks in the content.
 func ExtractDiffBlocks(content string) []model.DiffBlock {
-	allBlocks, err := ExtractCodeBlocks([]byte(content))
+	allBlocks, err := ExtractCodeBlocks([]byte(content), nil)
 	if err != nil {
 		// This function is also used for non-critical paths like --output-diff-fix,
 		// so we just return nil. The error isn't critical here.
@@ -158,13 +214,26 @@ func ExtractDiffBlocks(content string) []model.DiffBlock {
 // extractDiffBlocksFromParsed is a helper to process already-parsed blocks.
 func extractDiffBlocksFromParsed(allBlocks []CodeBlock) []model.DiffBlock {
 	var diffs []model.DiffBlock
-
 	for _, block := range allBlocks {
-		if block.Lang != "diff" {
-			continue
+		if blockLanguage(block) == "diff" {
+			diffs = append(diffs, splitDiffBlock(block)...)
 		}
+	}
+	return diffs
+}
+
+// handleDiffBlock passes on the patches of a diff block, to be applied once
+// every block is handled.
+func handleDiffBlock(block CodeBlock, _ model.BlockEnv) model.BlockOperations {
+	return model.BlockOperations{Diffs: splitDiffBlock(block)}
+}
 
-		rawContent := strings.Trim(block.Content, "\n")
+// splitDiffBlock returns the patches of a diff block. A block can hold
+// patches for several files, e.g., `git diff` output.
+func splitDiffBlock(block CodeBlock) []model.DiffBlock {
+	var diffs []model.DiffBlock
+	for _, part := range patcher.SplitDiff(strings.Trim(block.Content, "\n")) {
+		rawContent := strings.Trim(part, "\n")
 		filePath := patcher.ExtractPathFromDiff(rawContent)
 		if filePath == "" {
 			// Silently skip blocks without a path.
@@ -181,13 +250,13 @@ func extractDiffBlocksFromParsed(allBlocks []CodeBlock) []model.DiffBlock {
 
 // ExtractToolBlocks finds all tool blocks in the content.
 func ExtractToolBlocks(content string) ([]model.ToolBlock, error) {
-	allBlocks, err := ExtractCodeBlocks([]byte(content))
+	allBlocks, err := ExtractCodeBlocks([]byte(content), nil)
 	if err != nil {
 		return nil, err
 	}
 	var tools []model.ToolBlock
 	for _, block := range allBlocks {
-		if block.Lang == "tool" {
+		if blockLanguage(block) == "tool" {
 			tools = append(tools, model.ToolBlock{
 				Content: strings.TrimSpace(block.Content),
 			})
@@ -196,21 +265,6 @@ func ExtractToolBlocks(content string) ([]model.ToolBlock, error) {
 	return tools, nil
 }
 
-func ExtractPathFromHint(hint string) string {
-	hint = strings.TrimSpace(hint)
-
-	// A path hint must be enclosed in backticks, e.g., `path/to/file.go`
-	if match := pathInHintRegex.FindStringSubmatch(hint); len(match) > 1 {
-		path := strings.TrimSpace(match[1])
-		// Disallow spaces to avoid capturing commands like `go run main.go` as a path.
-		if !strings.Contains(path, " ") {
-			return path
-		}
-	}
-
-	return ""
-}
-
 func HasAllowedExtension(path string, extensions []string) bool {
 	if len(extensions) == 0 {
 		return true
@@ -224,44 +278,100 @@ func HasAllowedExtension(path string, extensions []string) bool {
 	return false
 }
 
-func parseDeletePaths(allBlocks []CodeBlock, resolver *fs.PathResolver) []string {
-	var paths []string
-	for _, block := range allBlocks {
-		if block.Lang != "delete" {
+// handleDeleteBlock deletes the files listed in a delete block, one per line.
+func handleDeleteBlock(block CodeBlock, env model.BlockEnv) model.BlockOperations {
+	var ops model.BlockOperations
+	lines := strings.Split(block.Content, "\n")
+	for _, line := range lines {
+		trimmed := strings.TrimSpace(line)
+		if trimmed != "" {
+			ops.Deletes = append(ops.Deletes, env.Resolve(trimmed))
+		}
+	}
+	return ops
+}
+
+// handleRenameBlock renames the files listed in a rename block, one
+// "old new" pair per line.
+func handleRenameBlock(block CodeBlock, env model.BlockEnv) model.BlockOperations {
+	var ops model.BlockOperations
+	lines := strings.Split(block.Content, "\n")
+	for _, line := range lines {
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" {
 			continue
 		}
-		lines := strings.Split(block.Content, "\n")
-		for _, line := range lines {
-			trimmed := strings.TrimSpace(line)
-			if trimmed != "" {
-				paths = append(paths, resolver.Resolve(trimmed))
-			}
+		parts := strings.Fields(trimmed)
+		if len(parts) != 2 {
+			continue
 		}
+		ops.Renames = append(ops.Renames, model.FileRename{
+			OldPath: env.Resolve(parts[0]),
+			NewPath: env.Resolve(parts[1]),
+		})
 	}
-	return paths
+	return ops
 }
 
-func parseRenameBlocks(allBlocks []CodeBlock, resolver *fs.PathResolver) []model.FileRename {
-	var renames []model.FileRename
-	for _, block := range allBlocks {
-		if block.Lang != "rename" {
-			continue
+// FailedHunk returns the hunk or edit a failure is for, as a diff hunk,
+// looked up in the block the failure came from. It returns false if the
+// failure is not for a single hunk of a known block.
+func FailedHunk(f model.Failure) (string, bool) {
+	if f.Hunk == 0 || f.Block == "" {
+		return "", false
+	}
+	i := f.Hunk - 1
+
+	switch f.Source {
+	case "diff":
+		if hunks := patcher.SplitHunks(f.Block); i < len(hunks) {
+			return hunks[i], true
 		}
-		lines := strings.Split(block.Content, "\n")
-		for _, line := range lines {
-			trimmed := strings.TrimSpace(line)
-			if trimmed == "" {
-				continue
-			}
-			parts := strings.Fields(trimmed)
-			if len(parts) != 2 {
-				continue
+	case "patch":
+		for _, op := range parseApplyPatches(f.Block, nil) {
+			if i < len(op.chunks) {
+				return chunkHunk(op.chunks[i]), true
 			}
-			renames = append(renames, model.FileRename{
-				OldPath: resolver.Resolve(parts[0]),
-				NewPath: resolver.Resolve(parts[1]),
-			})
 		}
+	case "edit":
+		var edits []patcher.SearchReplace
+		var err error
+		if containsSearchReplace(f.Block) {
+			edits, err = parseSearchReplace(f.Block)
+		} else if tags := parseTags(f.Block); len(tags) == 1 {
+			// An <edit> tag, as a whole for its escaped attribute.
+			edits, err = parseTagEdits(tags[0].body, tags[0].isEscaped())
+		}
+		if err == nil && i < len(edits) {
+			return editHunk(edits[i]), true
+		}
+	}
+	return "", false
+}
+
+// chunkHunk formats an apply_patch chunk as a diff hunk, with its anchors in
+// the "@@" lines.
+func chunkHunk(c patcher.Chunk) string {
+	var b strings.Builder
+	if len(c.Anchors) == 0 {
+		b.WriteString("@@\n")
+	}
+	for _, anchor := range c.Anchors {
+		b.WriteString("@@ " + anchor + "\n")
+	}
+	b.WriteString(strings.Join(c.Lines, "\n"))
+	return b.String()
+}
+
+// editHunk formats a SEARCH/REPLACE edit as a diff hunk that removes the
+// search lines and adds the replacement.
+func editHunk(edit patcher.SearchReplace) string {
+	lines := []string{"@@ @@"}
+	for _, line := range edit.Search {
+		lines = append(lines, "-"+line)
+	}
+	for _, line := range edit.Replace {
+		lines = append(lines, "+"+line)
 	}
-	return renames
+	return strings.Join(lines, "\n")
 }
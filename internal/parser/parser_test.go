@@ -0,0 +1,29 @@
+package parser
+
+import (
+	"errors"
+	"os"
+	"testing"
+
+	"github.com/sokinpui/itf.go/internal/fs"
+	"github.com/sokinpui/itf.go/internal/patcher"
+	"github.com/sokinpui/itf.go/model"
+)
+
+// A block that elides content of a file that does not exist is reported
+// rather than written without the elided content.
+func TestCreatePlanElisionNewFile(t *testing.T) {
+	t.Chdir(t.TempDir())
+	content := "`new.go`\n```go\npackage main\n\n// ... existing code ...\n\nfunc b() {}\n```\n"
+
+	plan, err := CreatePlan(content, fs.NewPathResolver(), nil, nil, patcher.Options{})
+	if err != nil {
+		t.Fatalf("CreatePlan() error = %v", err)
+	}
+	if len(plan.Changes) != 0 {
+		t.Errorf("changes = %+v, want none", plan.Changes)
+	}
+	if len(plan.Failed) != 1 || plan.Failed[0].Stage != model.StagePatch || !errors.Is(plan.Failed[0].Err, os.ErrNotExist) {
+		t.Errorf("failed = %v, want one patch failure for a missing file", plan.Failed)
+	}
+}
@@ -0,0 +1,158 @@
+package parser
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/sokinpui/itf.go/internal/patcher"
+	"github.com/sokinpui/itf.go/model"
+)
+
+// Markers of a SEARCH/REPLACE edit, e.g.:
+//
+//	<<<<<<< SEARCH
+//	old line
+//	=======
+//	new line
+//	>>>>>>> REPLACE
+var (
+	searchMarkerRegex  = regexp.MustCompile(`^<{5,9} SEARCH\s*$`)
+	dividerMarkerRegex = regexp.MustCompile(`^={5,9}\s*$`)
+	replaceMarkerRegex = regexp.MustCompile(`^>{5,9} REPLACE\s*$`)
+)
+
+// docLanguages are the languages of code blocks that document the
+// SEARCH/REPLACE format rather than use it, so they are file blocks.
+var docLanguages = []string{"markdown", "md", "text", "txt"}
+
+// isSearchReplaceBlock reports whether a code block is made of SEARCH/REPLACE
+// edits: it is not in one of docLanguages, and holds one or more edits that
+// parse and nothing else but blank lines and a first-line comment naming
+// its path.
+func isSearchReplaceBlock(block CodeBlock) bool {
+	if slices.Contains(docLanguages, blockLanguage(block)) {
+		return false
+	}
+	content := block.Content
+	if firstLine, rest, _ := strings.Cut(content, "\n"); commentHintRegex.MatchString(firstLine) {
+		content = rest
+	}
+	edits, stray, err := scanSearchReplace(content)
+	return err == nil && !stray && len(edits) > 0
+}
+
+// containsSearchReplace reports whether content holds a SEARCH/REPLACE edit.
+func containsSearchReplace(content string) bool {
+	for _, line := range strings.Split(content, "\n") {
+		if searchMarkerRegex.MatchString(strings.TrimSpace(line)) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseSearchReplace parses the SEARCH/REPLACE edits of a code block. Lines
+// outside of an edit are ignored.
+func parseSearchReplace(content string) ([]patcher.SearchReplace, error) {
+	edits, _, err := scanSearchReplace(content)
+	return edits, err
+}
+
+// scanSearchReplace is parseSearchReplace, also reporting whether content
+// has lines outside of an edit that are not blank.
+func scanSearchReplace(content string) (edits []patcher.SearchReplace, stray bool, err error) {
+	var current *patcher.SearchReplace
+	inReplace := false
+
+	for _, line := range strings.Split(strings.TrimRight(content, "\n"), "\n") {
+		marker := strings.TrimSpace(line)
+		switch {
+		case searchMarkerRegex.MatchString(marker):
+			if current != nil {
+				return nil, stray, fmt.Errorf("edit #%d is missing its REPLACE marker", len(edits)+1)
+			}
+			current = &patcher.SearchReplace{}
+			inReplace = false
+		case current == nil:
+			stray = stray || marker != ""
+		case !inReplace && dividerMarkerRegex.MatchString(marker):
+			inReplace = true
+		case inReplace && replaceMarkerRegex.MatchString(marker):
+			edits = append(edits, *current)
+			current = nil
+		case inReplace:
+			current.Replace = append(current.Replace, line)
+		default:
+			current.Search = append(current.Search, line)
+		}
+	}
+	if current != nil {
+		return nil, stray, fmt.Errorf("edit #%d is missing its REPLACE marker", len(edits)+1)
+	}
+	return edits, stray, nil
+}
+
+// handleSearchReplace applies the SEARCH/REPLACE edits of a code block with
+// a path, on top of the blocks handled before it, so that blocks for
+// the same file are applied in order. A block whose edits cannot all be
+// applied is skipped, with one failure reported for each failed edit.
+func handleSearchReplace(block CodeBlock, env model.BlockEnv) model.BlockOperations {
+	var ops model.BlockOperations
+	filePath := block.Path
+	if filePath == "" || !env.Allowed(filePath) {
+		return ops
+	}
+	fullPath := env.Resolve(filePath)
+
+	edits, err := parseSearchReplace(block.Content)
+	if err != nil {
+		ops.Failed = append(ops.Failed, model.Failure{Path: fullPath, Stage: model.StagePlan, Err: err})
+		return ops
+	}
+	rawBlock := fmt.Sprintf("```%s\n%s\n```", block.Lang, strings.TrimRight(block.Content, "\n"))
+	return applyEdits(fullPath, edits, block.Content, rawBlock, env)
+}
+
+// applyEdits applies SEARCH/REPLACE edits, parsed from the text of block, to
+// the current lines of a file. If any edit fails, the file is left
+// unchanged.
+func applyEdits(fullPath string, edits []patcher.SearchReplace, block, rawBlock string, env model.BlockEnv) model.BlockOperations {
+	var ops model.BlockOperations
+	source, ok := env.Lines(fullPath)
+	if !ok && !allAppends(edits) {
+		ops.Failed = append(ops.Failed, model.Failure{Path: fullPath, Stage: model.StagePatch, Err: os.ErrNotExist})
+		return ops
+	}
+
+	patched, errs := patcher.ApplySearchReplace(source, edits)
+	if len(errs) > 0 {
+		for _, err := range errs {
+			ops.Failed = append(ops.Failed, patcher.BlockFailures(fullPath, "edit", block, err)...)
+		}
+		return ops
+	}
+
+	ops.Changes = append(ops.Changes, model.FileChange{
+		Path:     fullPath,
+		Content:  patched,
+		Source:   "edit",
+		RawBlock: rawBlock,
+	})
+	return ops
+}
+
+// allAppends reports whether every edit has an empty search text, so the
+// edits can create a missing file.
+func allAppends(edits []patcher.SearchReplace) bool {
+	for _, edit := range edits {
+		for _, line := range edit.Search {
+			if strings.TrimSpace(line) != "" {
+				return false
+			}
+		}
+	}
+	return true
+}
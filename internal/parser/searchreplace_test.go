@@ -0,0 +1,53 @@
+package parser
+
+import (
+	"testing"
+
+	"github.com/sokinpui/itf.go/internal/fs"
+	"github.com/sokinpui/itf.go/internal/patcher"
+)
+
+func TestIsSearchReplaceBlock(t *testing.T) {
+	const edit = "<<<<<<< SEARCH\nold\n=======\nnew\n>>>>>>> REPLACE\n"
+	tests := []struct {
+		name  string
+		block CodeBlock
+		want  bool
+	}{
+		{"single edit", CodeBlock{Lang: "go", Content: edit}, true},
+		{"several edits", CodeBlock{Lang: "go", Content: edit + "\n" + edit}, true},
+		{"path comment", CodeBlock{Lang: "go", Content: "// File: main.go\n" + edit}, true},
+		{"no language", CodeBlock{Content: edit}, true},
+		{"markdown", CodeBlock{Lang: "markdown", Content: edit}, false},
+		{"md", CodeBlock{Lang: "md", Content: edit}, false},
+		{"text", CodeBlock{Lang: "text", Content: edit}, false},
+		{"text around the edit", CodeBlock{Lang: "go", Content: "Use this format:\n" + edit}, false},
+		{"code after the edit", CodeBlock{Lang: "go", Content: edit + "func main() {}\n"}, false},
+		{"missing REPLACE marker", CodeBlock{Lang: "go", Content: "<<<<<<< SEARCH\nold\n=======\nnew\n"}, false},
+		{"no edits", CodeBlock{Lang: "go", Content: "package main\n"}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isSearchReplaceBlock(tt.block); got != tt.want {
+				t.Errorf("isSearchReplaceBlock() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCreatePlanSearchReplaceDocs(t *testing.T) {
+	t.Chdir(t.TempDir())
+	content := "`doc.md`\n```markdown\nEdits look like this:\n\n<<<<<<< SEARCH\nold\n=======\nnew\n>>>>>>> REPLACE\n```\n"
+
+	plan, err := CreatePlan(content, fs.NewPathResolver(), nil, nil, patcher.Options{})
+	if err != nil {
+		t.Fatalf("CreatePlan() error = %v", err)
+	}
+	if len(plan.Failed) > 0 {
+		t.Fatalf("CreatePlan() failed: %v", plan.Failed)
+	}
+	if len(plan.Changes) != 1 || plan.Changes[0].Content[0] != "Edits look like this:" {
+		t.Errorf("changes = %+v, want doc.md written as it is", plan.Changes)
+	}
+}
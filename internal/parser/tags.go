@@ -0,0 +1,394 @@
+package parser
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/sokinpui/itf.go/internal/patcher"
+	"github.com/sokinpui/itf.go/model"
+)
+
+// File operations written as XML-like tags outside of code blocks, e.g.:
+//
+//	<file path="main.go">
+//	package main
+//	</file>
+//	<file path="main.go">
+//	if a &lt; b {
+//	</file>
+//	<edit path="main.go"><search>old</search><replace>new</replace></edit>
+//	<delete path="old.go"/>
+//	<rename from="a.go" to="b.go"/>
+var (
+	openTagRegex = regexp.MustCompile(`<(file|edit|delete|rename)((?:\s+[\w:-]+\s*=\s*(?:"[^"]*"|'[^']*'))*)\s*(/?)>`)
+	attrRegex    = regexp.MustCompile(`([\w:-]+)\s*=\s*(?:"([^"]*)"|'([^']*)')`)
+	entityRegex  = regexp.MustCompile(`&(lt|gt|amp|quot|apos|#[0-9]+|#x[0-9a-fA-F]+);`)
+	cdataRegex   = regexp.MustCompile(`(?s)<!\[CDATA\[.*?\]\]>`)
+	editTagRegex = regexp.MustCompile(`</?(?:search|replace)>`)
+	fenceRegex   = regexp.MustCompile("^ {0,3}(`{3,}|~{3,})")
+)
+
+const (
+	cdataStart = "<![CDATA["
+	cdataEnd   = "]]>"
+)
+
+// tag is a file operation tag of the content.
+type tag struct {
+	name  string // "file", "edit", "delete" or "rename"
+	attrs map[string]string
+	body  string // The raw text between the opening and closing tags
+	raw   string // The whole element, for RawBlock
+	start int    // Offsets of body in the content
+	end   int
+	err   error // Set if the element is not closed
+}
+
+// parseTags finds the file operation tags of content. Tags in fenced code
+// blocks and in code spans are examples rather than operations, so they are
+// skipped, and so is the body of each tag.
+func parseTags(content string) []tag {
+	var tags []tag
+	var fence string // The opening fence of the code block being skipped
+	for pos := 0; pos < len(content); {
+		lineStart := strings.LastIndexByte(content[:pos], '\n') + 1
+		lineEnd := len(content)
+		if i := strings.IndexByte(content[pos:], '\n'); i >= 0 {
+			lineEnd = pos + i
+		}
+
+		if pos == lineStart {
+			line := content[pos:lineEnd]
+			if fence != "" {
+				if isClosingFence(line, fence) {
+					fence = ""
+				}
+				pos = lineEnd + 1
+				continue
+			}
+			if match := fenceRegex.FindStringSubmatch(line); match != nil {
+				fence = match[1]
+				pos = lineEnd + 1
+				continue
+			}
+		}
+
+		loc := openTagRegex.FindStringSubmatchIndex(content[pos:lineEnd])
+		if loc == nil {
+			pos = lineEnd + 1
+			continue
+		}
+		base := pos
+		match := func(i int) string { return content[base+loc[2*i] : base+loc[2*i+1]] }
+		start, openEnd := base+loc[0], base+loc[1]
+		pos = openEnd
+		if strings.Count(content[lineStart:start], "`")%2 == 1 {
+			continue // In a code span
+		}
+
+		t := tag{
+			name:  match(1),
+			attrs: parseAttrs(match(2)),
+			raw:   content[start:openEnd],
+			start: openEnd,
+			end:   openEnd,
+		}
+		if loc[6] == loc[7] { // Not self-closing
+			closing := "</" + t.name + ">"
+			if end := closingTag(content[openEnd:], closing); end >= 0 {
+				t.end = openEnd + end
+				t.body = content[t.start:t.end]
+				pos = t.end + len(closing)
+				t.raw = content[start:pos]
+			} else if t.name == "file" || t.name == "edit" {
+				if t.attrs["path"] == "" {
+					continue // Most likely a tag mentioned in the text
+				}
+				t.err = fmt.Errorf("the <%s> tag is not closed", t.name)
+			}
+		}
+		tags = append(tags, t)
+	}
+	return tags
+}
+
+// isClosingFence reports whether line closes a code block opened by fence.
+func isClosingFence(line, fence string) bool {
+	trimmed := strings.TrimSpace(line)
+	return len(line)-len(strings.TrimLeft(line, " ")) <= 3 &&
+		len(trimmed) >= len(fence) &&
+		strings.Trim(trimmed, fence[:1]) == ""
+}
+
+// closingTag returns the offset of closing in s, skipping CDATA sections,
+// or -1 if s does not hold it.
+func closingTag(s, closing string) int {
+	for i := 0; i < len(s); {
+		end := strings.Index(s[i:], closing)
+		cdata := strings.Index(s[i:], cdataStart)
+		if end < 0 || cdata < 0 || end < cdata {
+			if end < 0 {
+				return -1
+			}
+			return i + end
+		}
+		cdataLen := strings.Index(s[i+cdata:], cdataEnd)
+		if cdataLen < 0 {
+			return -1
+		}
+		i += cdata + cdataLen + len(cdataEnd)
+	}
+	return -1
+}
+
+// parseAttrs returns the attributes of a tag, with their entities decoded.
+func parseAttrs(s string) map[string]string {
+	attrs := make(map[string]string)
+	for _, match := range attrRegex.FindAllStringSubmatch(s, -1) {
+		attrs[match[1]] = strings.TrimSpace(unescapeXML(match[2] + match[3]))
+	}
+	return attrs
+}
+
+// isEscaped reports whether the body of t is escaped XML text, as its
+// escaped attribute says. Without the attribute, the body is escaped if its
+// text, outside of CDATA sections and the <search> and <replace> tags of an
+// <edit>, holds entities and no bare "<", ">" or "&", since models seldom
+// escape code.
+func (t tag) isEscaped() bool {
+	if value, found := t.attrs["escaped"]; found {
+		escaped, _ := strconv.ParseBool(value)
+		return escaped
+	}
+	text := cdataRegex.ReplaceAllString(t.body, "")
+	if t.name == "edit" {
+		text = editTagRegex.ReplaceAllString(text, "")
+	}
+	return entityRegex.MatchString(text) && !strings.ContainsAny(entityRegex.ReplaceAllString(text, ""), "<>&")
+}
+
+// tagText returns the text of a tag's body. CDATA sections are taken as
+// they are, and the whitespace around them is dropped. The text outside of
+// them has its entities decoded if escaped is set. A blank first or last
+// line, next to the tags, is dropped, and so is a code fence around the
+// whole text.
+func tagText(body string, escaped bool) string {
+	type segment struct {
+		text  string
+		cdata bool
+	}
+	var segments []segment
+	for {
+		start := strings.Index(body, cdataStart)
+		if start < 0 {
+			break
+		}
+		length := strings.Index(body[start:], cdataEnd)
+		if length < 0 {
+			break
+		}
+		segments = append(segments,
+			segment{text: body[:start]},
+			segment{text: body[start+len(cdataStart) : start+length], cdata: true})
+		body = body[start+length+len(cdataEnd):]
+	}
+	segments = append(segments, segment{text: body})
+
+	var text strings.Builder
+	for _, s := range segments {
+		switch {
+		case s.cdata:
+			text.WriteString(s.text)
+		case len(segments) > 1 && strings.TrimSpace(s.text) == "":
+		case escaped:
+			text.WriteString(unescapeXML(s.text))
+		default:
+			text.WriteString(s.text)
+		}
+	}
+	return unfence(trimTagLines(text.String()))
+}
+
+// unfence returns the content of the fenced code block that s is made of,
+// or s if it is not a single code block.
+func unfence(s string) string {
+	lines := strings.Split(s, "\n")
+	if len(lines) < 2 {
+		return s
+	}
+	match := fenceRegex.FindStringSubmatch(lines[0])
+	if match == nil || (match[1][0] == '`' && strings.Contains(lines[0][len(match[0]):], "`")) {
+		return s
+	}
+	inner := lines[1 : len(lines)-1]
+	if !isClosingFence(lines[len(lines)-1], match[1]) ||
+		slices.ContainsFunc(inner, func(line string) bool { return isClosingFence(line, match[1]) }) {
+		return s
+	}
+	return strings.Join(inner, "\n")
+}
+
+// unescapeXML decodes the predefined XML entities and character references
+// of s.
+func unescapeXML(s string) string {
+	return entityRegex.ReplaceAllStringFunc(s, func(entity string) string {
+		name := entity[1 : len(entity)-1]
+		switch name {
+		case "lt":
+			return "<"
+		case "gt":
+			return ">"
+		case "amp":
+			return "&"
+		case "quot":
+			return `"`
+		case "apos":
+			return "'"
+		}
+		var code int64
+		var err error
+		if hex, found := strings.CutPrefix(name, "#x"); found {
+			code, err = strconv.ParseInt(hex, 16, 32)
+		} else {
+			code, err = strconv.ParseInt(name[1:], 10, 32)
+		}
+		if err != nil {
+			return entity
+		}
+		return string(rune(code))
+	})
+}
+
+// trimTagLines drops the blank first and last lines of s, which are the
+// rest of the lines of the tags around it.
+func trimTagLines(s string) string {
+	if strings.TrimSpace(s) == "" {
+		return ""
+	}
+	if first, rest, found := strings.Cut(s, "\n"); found && strings.TrimSpace(first) == "" {
+		s = rest
+	}
+	if i := strings.LastIndexByte(s, '\n'); i >= 0 && strings.TrimSpace(s[i+1:]) == "" {
+		s = s[:i]
+	}
+	return s
+}
+
+// parseTagEdits parses the <search> and <replace> pairs of an <edit> tag,
+// decoding their text if escaped is set.
+func parseTagEdits(body string, escaped bool) ([]patcher.SearchReplace, error) {
+	var edits []patcher.SearchReplace
+	for {
+		search, rest, found, err := innerTag(body, "search", escaped)
+		if err != nil {
+			return nil, fmt.Errorf("edit #%d: %w", len(edits)+1, err)
+		}
+		if !found {
+			break
+		}
+		replace, rest, found, err := innerTag(rest, "replace", escaped)
+		if err == nil && !found {
+			err = fmt.Errorf("<search> has no <replace>")
+		}
+		if err != nil {
+			return nil, fmt.Errorf("edit #%d: %w", len(edits)+1, err)
+		}
+		edits = append(edits, patcher.SearchReplace{Search: tagLines(search), Replace: tagLines(replace)})
+		body = rest
+	}
+	if len(edits) == 0 {
+		return nil, fmt.Errorf("the <edit> tag has no <search> and <replace> pairs")
+	}
+	return edits, nil
+}
+
+// innerTag returns the text of the first tag named name in s and the rest
+// of s after it, as for tagText. found is false if s has no such tag.
+func innerTag(s, name string, escaped bool) (text, rest string, found bool, err error) {
+	start := strings.Index(s, "<"+name+">")
+	if start < 0 {
+		return "", s, false, nil
+	}
+	s = s[start+len(name)+2:]
+	closing := "</" + name + ">"
+	end := closingTag(s, closing)
+	if end < 0 {
+		return "", "", false, fmt.Errorf("<%s> is not closed", name)
+	}
+	return tagText(s[:end], escaped), s[end+len(closing):], true, nil
+}
+
+// tagLines splits the text of a tag into lines. Empty text has no lines.
+func tagLines(text string) []string {
+	if text == "" {
+		return nil
+	}
+	return strings.Split(text, "\n")
+}
+
+// handleTags plans the file operation tags of the content, after the code
+// blocks, so that edits apply on top of their changes. <file> tags are
+// skipped unless fileTags is set.
+func (e *planEnv) handleTags(tags []tag, fileTags bool) model.BlockOperations {
+	var all model.BlockOperations
+	for _, t := range tags {
+		e.add(&all, e.handleTag(t, fileTags))
+	}
+	return all
+}
+
+// handleTag plans a file operation tag like the matching code block: a
+// <file> tag like a file block, an <edit> tag like SEARCH/REPLACE edits,
+// and <delete> and <rename> tags like delete and rename blocks.
+func (e *planEnv) handleTag(t tag, fileTags bool) model.BlockOperations {
+	var ops model.BlockOperations
+	path := t.attrs["path"]
+	if t.err != nil {
+		ops.Failed = append(ops.Failed, model.Failure{Path: e.Resolve(path), Stage: model.StagePlan, Err: t.err})
+		return ops
+	}
+
+	switch t.name {
+	case "file":
+		if !fileTags {
+			return ops
+		}
+		ops = e.handleFileBlock(CodeBlock{Content: tagText(t.body, t.isEscaped()), Path: path}, e)
+		for i := range ops.Changes {
+			ops.Changes[i].RawBlock = t.raw
+		}
+	case "edit":
+		if path == "" || !e.Allowed(path) {
+			return ops
+		}
+		fullPath := e.Resolve(path)
+		edits, err := parseTagEdits(t.body, t.isEscaped())
+		if err != nil {
+			ops.Failed = append(ops.Failed, model.Failure{Path: fullPath, Stage: model.StagePlan, Err: err})
+			return ops
+		}
+		ops = applyEdits(fullPath, edits, t.raw, t.raw, e)
+	case "delete":
+		if path != "" && e.Allowed(path) {
+			ops.Deletes = append(ops.Deletes, e.Resolve(path))
+		}
+	case "rename":
+		if from, to := t.attrs["from"], t.attrs["to"]; from != "" && to != "" && e.Allowed(to) {
+			ops.Renames = append(ops.Renames, model.FileRename{OldPath: e.Resolve(from), NewPath: e.Resolve(to)})
+		}
+	}
+	return ops
+}
+
+// inTagBody reports whether offset is in the body of one of tags.
+func inTagBody(tags []tag, offset int) bool {
+	for _, t := range tags {
+		if offset >= t.start && offset < t.end {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,166 @@
+package parser
+
+import (
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/sokinpui/itf.go/internal/fs"
+	"github.com/sokinpui/itf.go/internal/patcher"
+)
+
+func TestParseTagsSkipsExamples(t *testing.T) {
+	content := strings.Join([]string{
+		"Write `<delete path=\"span.go\"/>` to delete a file, e.g.:",
+		"",
+		"```xml",
+		"<file path=\"fenced.go\">",
+		"package fenced",
+		"</file>",
+		"```",
+		"",
+		"~~~~",
+		"```",
+		"<delete path=\"tilde.go\"/>",
+		"~~~~",
+		"",
+		"<file path=\"main.go\">",
+		"```go",
+		"<delete path=\"body.go\"/>",
+		"```",
+		"</file>",
+		"<delete path=\"old.go\"/>",
+	}, "\n")
+
+	tags := parseTags(content)
+	var got []string
+	for _, tg := range tags {
+		got = append(got, tg.name+" "+tg.attrs["path"])
+	}
+	want := []string{"file main.go", "delete old.go"}
+	if strings.Join(got, ", ") != strings.Join(want, ", ") {
+		t.Fatalf("parseTags() = %q, want %q", got, want)
+	}
+	if body := tagText(tags[0].body, false); body != "<delete path=\"body.go\"/>" {
+		t.Errorf("body of <file> = %q, want the content of the fenced block", body)
+	}
+}
+
+func TestTagText(t *testing.T) {
+	tests := []struct {
+		name string
+		tag  string
+		want string
+	}{
+		{
+			name: "escaped text",
+			tag:  "<file path=\"a.go\">\nvar s = a &lt; b\n</file>",
+			want: "var s = a < b",
+		},
+		{
+			name: "bare ampersand",
+			tag:  "<file path=\"a.go\">\nif a &lt; b && c {\n</file>",
+			want: "if a &lt; b && c {",
+		},
+		{
+			name: "bare angle bracket",
+			tag:  "<file path=\"a.go\">\nif a > b { s = \"&amp;\" }\n</file>",
+			want: "if a > b { s = \"&amp;\" }",
+		},
+		{
+			name: "no entities",
+			tag:  "<file path=\"a.go\">\npackage a\n</file>",
+			want: "package a",
+		},
+		{
+			name: "escaped attribute",
+			tag:  "<file path=\"a.go\" escaped=\"true\">\nif a &lt; b &amp;&amp; c &#62; &#x41; {\n</file>",
+			want: "if a < b && c > A {",
+		},
+		{
+			name: "escaped attribute set to false",
+			tag:  "<file path=\"a.go\" escaped=\"false\">\na &amp; b\n</file>",
+			want: "a &amp; b",
+		},
+		{
+			name: "fenced",
+			tag:  "<file path=\"a.go\">\n```go\npackage a\n```\n</file>",
+			want: "package a",
+		},
+		{
+			name: "fenced and escaped",
+			tag:  "<file path=\"a.go\">\n~~~\nvar s = a &lt; b\n~~~\n</file>",
+			want: "var s = a < b",
+		},
+		{
+			name: "two code blocks",
+			tag:  "<file path=\"a.md\">\n```\na\n```\ntext\n```\nb\n```\n</file>",
+			want: "```\na\n```\ntext\n```\nb\n```",
+		},
+		{
+			name: "CDATA is not decoded",
+			tag:  "<file path=\"a.go\" escaped=\"true\">\n<![CDATA[a &lt; </file>]]>\n</file>",
+			want: "a &lt; </file>",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tags := parseTags(tt.tag)
+			if len(tags) != 1 {
+				t.Fatalf("parseTags() found %d tags, want 1", len(tags))
+			}
+			if got := tagText(tags[0].body, tags[0].isEscaped()); got != tt.want {
+				t.Errorf("tagText() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseTagEditsEscaped(t *testing.T) {
+	tags := parseTags("<edit path=\"a&amp;b.go\">\n<search>\na &lt; b\n</search>\n<replace>\na &lt;= b\n</replace>\n</edit>")
+	if len(tags) != 1 {
+		t.Fatalf("parseTags() found %d tags, want 1", len(tags))
+	}
+	if path := tags[0].attrs["path"]; path != "a&b.go" {
+		t.Errorf("path = %q, want the decoded attribute", path)
+	}
+	edits, err := parseTagEdits(tags[0].body, tags[0].isEscaped())
+	if err != nil {
+		t.Fatalf("parseTagEdits() error = %v", err)
+	}
+	if len(edits) != 1 || strings.Join(edits[0].Search, "\n") != "a < b" || strings.Join(edits[0].Replace, "\n") != "a <= b" {
+		t.Errorf("parseTagEdits() = %+v, want the decoded edit", edits)
+	}
+}
+
+func TestCreatePlanTags(t *testing.T) {
+	dir := t.TempDir()
+	t.Chdir(dir)
+	content := strings.Join([]string{
+		"<file path=\"x.go\">",
+		"```go",
+		"package x",
+		"```",
+		"</file>",
+		"<delete path=\"go.mod\"/>",
+		"<delete path=\"old.go\"/>",
+		"<rename from=\"a.go\" to=\"notes.txt\"/>",
+		"<rename from=\"b.go\" to=\"c.go\"/>",
+	}, "\n")
+
+	plan, err := CreatePlan(content, fs.NewPathResolver(), []string{".go"}, nil, patcher.Options{})
+	if err != nil {
+		t.Fatalf("CreatePlan() error = %v", err)
+	}
+	if len(plan.Changes) != 1 || !slices.Equal(plan.Changes[0].Content, []string{"package x"}) {
+		t.Errorf("changes = %+v, want x.go without the fence", plan.Changes)
+	}
+	if want := []string{filepath.Join(dir, "old.go")}; !slices.Equal(plan.Deletes, want) {
+		t.Errorf("deletes = %q, want %q", plan.Deletes, want)
+	}
+	if len(plan.Renames) != 1 || plan.Renames[0].NewPath != filepath.Join(dir, "c.go") {
+		t.Errorf("renames = %+v, want only b.go to c.go", plan.Renames)
+	}
+}
@@ -0,0 +1,298 @@
+package patcher
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// HunkStatus describes the outcome of applying a single hunk.
+type HunkStatus string
+
+const (
+	// HunkApplied means the hunk matched at the line given in its header.
+	HunkApplied HunkStatus = "applied"
+	// HunkOffset means the hunk matched, but at a different line than expected.
+	HunkOffset HunkStatus = "offset"
+	// HunkRejected means no matching location was found for the hunk.
+	HunkRejected HunkStatus = "rejected"
+)
+
+// HunkResult records how a single hunk of a patch was applied.
+type HunkResult struct {
+	Index  int // Zero-based index of the hunk within the patch.
+	Status HunkStatus
+	Line   int    // 1-based line in the original file where the hunk was applied.
+	Offset int    // Difference between the actual start line and the one in the hunk header.
+	Reason string // Why the hunk was rejected, empty otherwise.
+}
+
+// PatchError is returned when one or more hunks of a patch were rejected.
+type PatchError struct {
+	Results []HunkResult
+}
+
+func (e *PatchError) Error() string {
+	var reasons []string
+	for _, r := range e.Results {
+		if r.Status == HunkRejected {
+			reasons = append(reasons, fmt.Sprintf("hunk #%d rejected: %s", r.Index+1, r.Reason))
+		}
+	}
+	return strings.Join(reasons, "; ")
+}
+
+// hunkHeaderRegex parses a unified diff hunk header, e.g., "@@ -12,7 +12,8 @@".
+var hunkHeaderRegex = regexp.MustCompile(`^@@ -(\d+)(?:,(\d+))? \+(\d+)(?:,(\d+))? @@`)
+
+// hunk is a single parsed hunk of a unified diff.
+type hunk struct {
+	oldStart, oldLines int
+	newStart, newLines int
+	lines              []string
+}
+
+// oldSide returns the lines the hunk expects to find in the original file.
+func (h hunk) oldSide() []string {
+	var block []string
+	for _, line := range h.lines {
+		if line[0] == ' ' || line[0] == '-' {
+			block = append(block, line[1:])
+		}
+	}
+	return block
+}
+
+// parseUnifiedHunks parses the hunks of a unified diff. File headers and
+// any other lines outside of a hunk are ignored. The line counts in each
+// hunk header decide where the hunk ends, so empty lines inside a hunk are
+// treated as empty context lines.
+func parseUnifiedHunks(patch string) ([]hunk, error) {
+	var hunks []hunk
+	lines := strings.Split(patch, "\n")
+
+	for i := 0; i < len(lines); i++ {
+		match := hunkHeaderRegex.FindStringSubmatch(lines[i])
+		if match == nil {
+			continue
+		}
+
+		h := hunk{
+			oldStart: atoiOr(match[1], 0),
+			oldLines: atoiOr(match[2], 1),
+			newStart: atoiOr(match[3], 0),
+			newLines: atoiOr(match[4], 1),
+		}
+
+		oldSeen, newSeen := 0, 0
+		for oldSeen < h.oldLines || newSeen < h.newLines {
+			i++
+			if i >= len(lines) {
+				return nil, fmt.Errorf("hunk #%d is truncated", len(hunks)+1)
+			}
+			line := lines[i]
+			if line == "" {
+				line = " "
+			}
+			switch line[0] {
+			case ' ':
+				oldSeen++
+				newSeen++
+			case '-':
+				oldSeen++
+			case '+':
+				newSeen++
+			case '\\':
+				// "\ No newline at end of file"
+				continue
+			default:
+				return nil, fmt.Errorf("hunk #%d has an invalid line: %q", len(hunks)+1, line)
+			}
+			h.lines = append(h.lines, line)
+		}
+		hunks = append(hunks, h)
+	}
+	return hunks, nil
+}
+
+func atoiOr(s string, fallback int) int {
+	if s == "" {
+		return fallback
+	}
+	n, err := strconv.Atoi(s)
+	if err != nil {
+		return fallback
+	}
+	return n
+}
+
+// ApplyHunks applies the hunks of a unified diff to the given source lines
+// and returns the patched lines along with a result for every hunk.
+//
+// Each hunk is first looked up exactly at the line given in its header, then
+// at the nearest line where its context matches exactly, and finally with the
+// same whitespace-tolerant matching used to correct diffs. If any hunk is
+// rejected, a *PatchError is returned together with the results.
+func ApplyHunks(source []string, patch string) ([]string, []HunkResult, error) {
+	hunks, err := parseUnifiedHunks(patch)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var patched []string
+	results := make([]HunkResult, 0, len(hunks))
+	rejected := false
+	cursor := 0     // Index of the first source line not yet copied to the output.
+	lastOffset := 0 // Offset of the previous hunk, as `patch` does.
+
+	for i, h := range hunks {
+		headerStart := h.oldStart - 1
+		if h.oldLines == 0 {
+			// For pure insertions, the start line is the line to insert after.
+			headerStart = h.oldStart
+		}
+
+		start, replacement, consumed, ok := locateHunk(source, h, headerStart+lastOffset, cursor)
+		if !ok {
+			rejected = true
+			results = append(results, HunkResult{
+				Index:  i,
+				Status: HunkRejected,
+				Reason: fmt.Sprintf("context not found near line %d", h.oldStart),
+			})
+			continue
+		}
+
+		result := HunkResult{Index: i, Status: HunkApplied, Line: start + 1, Offset: start - headerStart}
+		if result.Offset != 0 {
+			result.Status = HunkOffset
+		}
+		lastOffset = result.Offset
+		results = append(results, result)
+
+		patched = append(patched, source[cursor:start]...)
+		patched = append(patched, replacement...)
+		cursor = start + consumed
+	}
+	patched = append(patched, source[cursor:]...)
+
+	if rejected {
+		return patched, results, &PatchError{Results: results}
+	}
+	return patched, results, nil
+}
+
+// locateHunk finds where hunk h applies in source, searching no earlier than
+// floor. Of several matches, the one closest to expected is taken, whether
+// it is exact or only matches ignoring whitespace. It returns the start
+// index, the lines replacing the matched region, and the number of source
+// lines consumed.
+func locateHunk(source []string, h hunk, expected, floor int) (int, []string, int, bool) {
+	oldBlock := h.oldSide()
+
+	if start, ok := findExactBlock(source, oldBlock, expected, floor); ok {
+		var replacement []string
+		for _, line := range h.lines {
+			if line[0] == ' ' || line[0] == '+' {
+				replacement = append(replacement, line[1:])
+			}
+		}
+		return start, replacement, len(oldBlock), true
+	}
+
+	if floor >= len(source) {
+		return 0, nil, 0, false
+	}
+	matches := matchAllBlocks(source, getTargetBlock(h.lines), floor+1)
+	if len(matches) == 0 {
+		return 0, nil, 0, false
+	}
+	nearest := matches[0]
+	for _, m := range matches[1:] {
+		if abs(m[0]-1-expected) < abs(nearest[0]-1-expected) {
+			nearest = m
+		}
+	}
+	matchStart, matchEnd := nearest[0], nearest[1]
+	replacement, consumed, ok := mergeHunk(source[matchStart-1:matchEnd], h)
+	if !ok {
+		return 0, nil, 0, false
+	}
+	return matchStart - 1, replacement, consumed, true
+}
+
+// findExactBlock returns the index of the occurrence of block in source that
+// is closest to expected, ignoring any occurrence that starts before floor.
+func findExactBlock(source, block []string, expected, floor int) (int, bool) {
+	last := len(source) - len(block)
+	if last < floor {
+		return 0, false
+	}
+	if expected < floor {
+		expected = floor
+	}
+	if expected > last {
+		expected = last
+	}
+
+	for delta := 0; expected-delta >= floor || expected+delta <= last; delta++ {
+		if pos := expected + delta; pos <= last && blockEqual(source[pos:pos+len(block)], block) {
+			return pos, true
+		}
+		if pos := expected - delta; delta > 0 && pos >= floor && blockEqual(source[pos:pos+len(block)], block) {
+			return pos, true
+		}
+	}
+	return 0, false
+}
+
+func blockEqual(a, b []string) bool {
+	for i := range b {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// mergeHunk applies h to region, a slice of source lines that matched the
+// hunk with whitespace-normalized comparison. Blank lines are allowed to
+// differ between the hunk and the region: blank lines only in the region are
+// kept, and blank context or removed lines only in the hunk are skipped.
+// Context lines keep their original text from the region.
+func mergeHunk(region []string, h hunk) ([]string, int, bool) {
+	var merged []string
+	pos := 0
+
+	for _, line := range h.lines {
+		kind, content := line[0], line[1:]
+		if kind == '+' {
+			merged = append(merged, content)
+			continue
+		}
+
+		if normalizeLineForMatching(content) == "" {
+			if pos < len(region) && normalizeLineForMatching(region[pos]) == "" {
+				if kind == ' ' {
+					merged = append(merged, region[pos])
+				}
+				pos++
+			}
+			continue
+		}
+
+		for pos < len(region) && normalizeLineForMatching(region[pos]) == "" {
+			merged = append(merged, region[pos])
+			pos++
+		}
+		if pos >= len(region) || normalizeLineForMatching(region[pos]) != normalizeLineForMatching(content) {
+			return nil, 0, false
+		}
+		if kind == ' ' {
+			merged = append(merged, region[pos])
+		}
+		pos++
+	}
+	return merged, pos, true
+}
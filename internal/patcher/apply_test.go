@@ -0,0 +1,153 @@
+package patcher
+
+import (
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestApplyHunks(t *testing.T) {
+	tests := []struct {
+		name     string
+		source   string
+		patch    string
+		want     string
+		statuses []HunkStatus
+		offsets  []int
+	}{
+		{
+			name:     "exact",
+			source:   "a\nb\nc",
+			patch:    "@@ -1,3 +1,3 @@\n a\n-b\n+B\n c\n",
+			want:     "a\nB\nc",
+			statuses: []HunkStatus{HunkApplied},
+			offsets:  []int{0},
+		},
+		{
+			name:     "offset",
+			source:   "x\ny\nz\na\nb\nc",
+			patch:    "@@ -1,3 +1,3 @@\n a\n-b\n+B\n c\n",
+			want:     "x\ny\nz\na\nB\nc",
+			statuses: []HunkStatus{HunkOffset},
+			offsets:  []int{3},
+		},
+		{
+			name:     "context mismatch",
+			source:   "a\nb\nc",
+			patch:    "@@ -1,3 +1,3 @@\n a\n-q\n+Q\n c\n",
+			want:     "a\nb\nc",
+			statuses: []HunkStatus{HunkRejected},
+			offsets:  []int{0},
+		},
+		{
+			name:     "insertion at end of file",
+			source:   "a\nb",
+			patch:    "@@ -2,0 +3,1 @@\n+c\n",
+			want:     "a\nb\nc",
+			statuses: []HunkStatus{HunkApplied},
+			offsets:  []int{0},
+		},
+		{
+			name:     "context at end of file",
+			source:   "a\nb",
+			patch:    "@@ -1,2 +1,3 @@\n a\n b\n+c\n",
+			want:     "a\nb\nc",
+			statuses: []HunkStatus{HunkApplied},
+			offsets:  []int{0},
+		},
+		{
+			name:     "no newline at end of file",
+			source:   "a\nb",
+			patch:    "@@ -1,2 +1,2 @@\n a\n-b\n\\ No newline at end of file\n+B\n\\ No newline at end of file\n",
+			want:     "a\nB",
+			statuses: []HunkStatus{HunkApplied},
+			offsets:  []int{0},
+		},
+		{
+			name:   "multiple hunks",
+			source: "1\n2\n3\n4\n5\n6\n7\n8\n9",
+			patch: "@@ -1,2 +1,2 @@\n-1\n+one\n 2\n" +
+				"@@ -5,3 +5,4 @@\n 5\n+5.5\n 6\n 7\n" +
+				"@@ -9,1 +10,1 @@\n-9\n+nine\n",
+			want:     "one\n2\n3\n4\n5\n5.5\n6\n7\n8\nnine",
+			statuses: []HunkStatus{HunkApplied, HunkApplied, HunkApplied},
+			offsets:  []int{0, 0, 0},
+		},
+		{
+			name:   "later hunk rejected",
+			source: "1\n2\n3\n4",
+			patch: "@@ -1,1 +1,1 @@\n-1\n+one\n" +
+				"@@ -3,1 +3,1 @@\n-x\n+X\n",
+			want:     "one\n2\n3\n4",
+			statuses: []HunkStatus{HunkApplied, HunkRejected},
+			offsets:  []int{0, 0},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, results, err := ApplyHunks(strings.Split(tt.source, "\n"), tt.patch)
+			rejected := slices.Contains(tt.statuses, HunkRejected)
+			var patchErr *PatchError
+			if rejected != errors.As(err, &patchErr) {
+				t.Fatalf("ApplyHunks() error = %v, want a *PatchError: %v", err, rejected)
+			}
+			if joined := strings.Join(got, "\n"); joined != tt.want {
+				t.Errorf("ApplyHunks() = %q, want %q", joined, tt.want)
+			}
+			if len(results) != len(tt.statuses) {
+				t.Fatalf("ApplyHunks() returned %d results, want %d", len(results), len(tt.statuses))
+			}
+			for i, r := range results {
+				if r.Status != tt.statuses[i] || r.Offset != tt.offsets[i] {
+					t.Errorf("hunk #%d: status %s offset %d, want %s offset %d", i+1, r.Status, r.Offset, tt.statuses[i], tt.offsets[i])
+				}
+			}
+		})
+	}
+}
+
+func TestCorrectionOffsets(t *testing.T) {
+	source := strings.Split("x\ny\nz\na\nb\nc", "\n")
+	diff := "--- a/f\n+++ b/f\n@@ -1,3 +1,3 @@\n a\n-b\n+B\n c\n"
+
+	c, err := correctDiffHunks(source, diff, "f", Options{})
+	if err != nil {
+		t.Fatalf("correctDiffHunks() error = %v", err)
+	}
+	_, results, err := ApplyHunks(source, c.patch)
+	if err != nil {
+		t.Fatalf("ApplyHunks() error = %v", err)
+	}
+	offsets := c.offsets(results, "f")
+	if len(offsets) != 1 || offsets[0].Hunk != 1 || offsets[0].Line != 4 || offsets[0].Offset != 3 {
+		t.Errorf("offsets() = %+v, want hunk #1 at line 4 with offset 3", offsets)
+	}
+}
+
+// A hunk whose indentation differs from the file is placed by the
+// whitespace-tolerant match nearest to its header, not by the first one.
+func TestApplyHunksDuplicateBlocks(t *testing.T) {
+	block := "\tif err != nil {\n\t\treturn err\n\t}\n\treturn nil\n}"
+	source := strings.Split("func a() error {\n"+block+"\nfunc b() error {\n"+block, "\n")
+	diff := "--- a/f.go\n+++ b/f.go\n@@ -8,3 +8,3 @@\n" +
+		"     if err != nil {\n-        return err\n+        return fmt.Errorf(\"b: %w\", err)\n     }\n"
+
+	c, err := correctDiffHunks(source, diff, "f.go", Options{})
+	if err != nil {
+		t.Fatalf("correctDiffHunks() error = %v", err)
+	}
+	got, results, err := ApplyHunks(source, c.patch)
+	if err != nil {
+		t.Fatalf("ApplyHunks() error = %v", err)
+	}
+	if len(results) != 1 || results[0].Line != 8 {
+		t.Errorf("ApplyHunks() results = %+v, want the hunk at line 8", results)
+	}
+	want := slices.Clone(source)
+	want[8] = "        return fmt.Errorf(\"b: %w\", err)"
+	if !slices.Equal(got, want) {
+		t.Errorf("ApplyHunks() =\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
@@ -0,0 +1,95 @@
+package patcher
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Chunk is a single change of an "*** Update File:" section in the
+// apply_patch format. Unlike a unified diff hunk, it carries no line
+// numbers and is located by its context and anchors alone.
+type Chunk struct {
+	Anchors []string // Text of the "@@" lines before the chunk, outermost first
+	Lines   []string // Lines prefixed with ' ', '-' or '+'
+	AtEOF   bool     // The chunk was followed by "*** End of File"
+}
+
+// ApplyChunks applies apply_patch chunks to the given source lines, in
+// order, and returns the patched lines along with a result for every chunk.
+//
+// Each anchor is searched for after the previous chunk, and the chunk itself
+// after its last anchor, using the same exact-then-whitespace-tolerant
+// matching as ApplyHunks. A chunk that only adds lines is inserted after its
+// last anchor, or at the end of the file if it has none. If any chunk is
+// rejected, a *PatchError is returned together with the results.
+func ApplyChunks(source []string, chunks []Chunk) ([]string, []HunkResult, error) {
+	var patched []string
+	results := make([]HunkResult, 0, len(chunks))
+	rejected := false
+	cursor := 0 // Index of the first source line not yet copied to the output.
+
+	for i, c := range chunks {
+		floor, ok := findAnchors(source, c.Anchors, cursor)
+		if !ok {
+			rejected = true
+			results = append(results, HunkResult{
+				Index:  i,
+				Status: HunkRejected,
+				Reason: fmt.Sprintf("anchor not found: %q", strings.Join(c.Anchors, " / ")),
+			})
+			continue
+		}
+
+		h := hunk{lines: c.Lines}
+		oldBlock := h.oldSide()
+		expected := floor
+		switch {
+		case c.AtEOF:
+			expected = len(source) - len(oldBlock)
+		case len(oldBlock) == 0 && len(c.Anchors) == 0:
+			expected = len(source)
+		}
+
+		start, replacement, consumed, ok := locateHunk(source, h, expected, floor)
+		if !ok {
+			rejected = true
+			results = append(results, HunkResult{
+				Index:  i,
+				Status: HunkRejected,
+				Reason: "context not found",
+			})
+			continue
+		}
+
+		results = append(results, HunkResult{Index: i, Status: HunkApplied, Line: start + 1})
+		patched = append(patched, source[cursor:start]...)
+		patched = append(patched, replacement...)
+		cursor = start + consumed
+	}
+	patched = append(patched, source[cursor:]...)
+
+	if rejected {
+		return patched, results, &PatchError{Results: results}
+	}
+	return patched, results, nil
+}
+
+// findAnchors finds each anchor line in turn, starting at floor, and returns
+// the index of the line after the last one.
+func findAnchors(source, anchors []string, floor int) (int, bool) {
+	for _, anchor := range anchors {
+		if pos, ok := findExactBlock(source, []string{anchor}, floor, floor); ok {
+			floor = pos + 1
+			continue
+		}
+		if floor >= len(source) {
+			return 0, false
+		}
+		matchStart, _ := matchBlock(source, []string{anchor}, floor+1)
+		if matchStart == -1 || matchStart-1 < floor {
+			return 0, false
+		}
+		floor = matchStart
+	}
+	return floor, true
+}
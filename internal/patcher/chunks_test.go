@@ -0,0 +1,109 @@
+package patcher
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+const chunksSource = "func a() {\n\treturn 1\n}\n\nfunc b() {\n\treturn 1\n}"
+
+func TestApplyChunks(t *testing.T) {
+	tests := []struct {
+		name     string
+		chunks   []Chunk
+		want     string
+		statuses []HunkStatus
+		reason   string
+	}{
+		{
+			name:     "no anchors",
+			chunks:   []Chunk{{Lines: []string{"-\treturn 1", "+\treturn 2"}}},
+			want:     "func a() {\n\treturn 2\n}\n\nfunc b() {\n\treturn 1\n}",
+			statuses: []HunkStatus{HunkApplied},
+		},
+		{
+			name:     "anchor",
+			chunks:   []Chunk{{Anchors: []string{"func b() {"}, Lines: []string{"-\treturn 1", "+\treturn 2"}}},
+			want:     "func a() {\n\treturn 1\n}\n\nfunc b() {\n\treturn 2\n}",
+			statuses: []HunkStatus{HunkApplied},
+		},
+		{
+			name:     "nested anchors",
+			chunks:   []Chunk{{Anchors: []string{"func a() {", "func b() {"}, Lines: []string{"-\treturn 1", "+\treturn 2"}}},
+			want:     "func a() {\n\treturn 1\n}\n\nfunc b() {\n\treturn 2\n}",
+			statuses: []HunkStatus{HunkApplied},
+		},
+		{
+			name:     "whitespace-tolerant anchor",
+			chunks:   []Chunk{{Anchors: []string{"func b()  {"}, Lines: []string{"-\treturn 1", "+\treturn 2"}}},
+			want:     "func a() {\n\treturn 1\n}\n\nfunc b() {\n\treturn 2\n}",
+			statuses: []HunkStatus{HunkApplied},
+		},
+		{
+			name:     "end of file",
+			chunks:   []Chunk{{Lines: []string{" }", "+// end"}, AtEOF: true}},
+			want:     chunksSource + "\n// end",
+			statuses: []HunkStatus{HunkApplied},
+		},
+		{
+			name:     "addition without anchors",
+			chunks:   []Chunk{{Lines: []string{"+", "+func c() {}"}}},
+			want:     chunksSource + "\n\nfunc c() {}",
+			statuses: []HunkStatus{HunkApplied},
+		},
+		{
+			name:     "addition after an anchor",
+			chunks:   []Chunk{{Anchors: []string{"func a() {"}, Lines: []string{"+\tprintln()"}}},
+			want:     "func a() {\n\tprintln()\n\treturn 1\n}\n\nfunc b() {\n\treturn 1\n}",
+			statuses: []HunkStatus{HunkApplied},
+		},
+		{
+			name: "chunks in order",
+			chunks: []Chunk{
+				{Lines: []string{"-\treturn 1", "+\treturn 2"}},
+				{Lines: []string{"-\treturn 1", "+\treturn 3"}},
+			},
+			want:     "func a() {\n\treturn 2\n}\n\nfunc b() {\n\treturn 3\n}",
+			statuses: []HunkStatus{HunkApplied, HunkApplied},
+		},
+		{
+			name:     "anchor not found",
+			chunks:   []Chunk{{Anchors: []string{"func c() {"}, Lines: []string{"-\treturn 1", "+\treturn 2"}}},
+			want:     chunksSource,
+			statuses: []HunkStatus{HunkRejected},
+			reason:   `anchor not found: "func c() {"`,
+		},
+		{
+			name:     "context not found",
+			chunks:   []Chunk{{Anchors: []string{"func b() {"}, Lines: []string{"-\treturn 9", "+\treturn 2"}}},
+			want:     chunksSource,
+			statuses: []HunkStatus{HunkRejected},
+			reason:   "context not found",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, results, err := ApplyChunks(strings.Split(chunksSource, "\n"), tt.chunks)
+			var patchErr *PatchError
+			if (tt.reason != "") != errors.As(err, &patchErr) {
+				t.Fatalf("ApplyChunks() error = %v", err)
+			}
+			if joined := strings.Join(got, "\n"); joined != tt.want {
+				t.Errorf("ApplyChunks() =\n%s\nwant\n%s", joined, tt.want)
+			}
+			if len(results) != len(tt.statuses) {
+				t.Fatalf("ApplyChunks() returned %d results, want %d", len(results), len(tt.statuses))
+			}
+			for i, r := range results {
+				if r.Status != tt.statuses[i] {
+					t.Errorf("chunk #%d: status %s, want %s", i+1, r.Status, tt.statuses[i])
+				}
+				if r.Status == HunkRejected && r.Reason != tt.reason {
+					t.Errorf("chunk #%d: reason %q, want %q", i+1, r.Reason, tt.reason)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,97 @@
+package patcher
+
+import (
+	"strings"
+)
+
+// SplitHunks splits a diff into its hunks, each starting with its "@@"
+// header line. Lines before the first hunk and hunks without any line after
+// their header are dropped, as parseDiffToHunks does.
+func SplitHunks(diff string) []string {
+	var hunks []string
+	var current []string
+	for _, line := range strings.Split(strings.TrimRight(diff, "\n"), "\n") {
+		if strings.HasPrefix(line, "@@") {
+			if len(current) > 1 {
+				hunks = append(hunks, strings.Join(current, "\n"))
+			}
+			current = []string{line}
+			continue
+		}
+		if len(current) > 0 {
+			current = append(current, line)
+		}
+	}
+	if len(current) > 1 {
+		hunks = append(hunks, strings.Join(current, "\n"))
+	}
+	return hunks
+}
+
+// ClosestRegion returns the 1-based, inclusive range of source lines that
+// most resembles the context and removed lines of a hunk. Lines are compared
+// by similarity rather than equality, and whitespace and blank lines are
+// ignored as in matchBlock. It returns false if no line resembles the hunk.
+func ClosestRegion(source []string, hunk string) (int, int, bool) {
+	var block []string
+	for _, line := range strings.Split(hunk, "\n")[1:] {
+		if line == "" || (line[0] != ' ' && line[0] != '-') {
+			continue
+		}
+		if normalized := normalizeLineForMatching(line[1:]); normalized != "" {
+			block = append(block, normalized)
+		}
+	}
+
+	var filtered []string
+	var lineNumbers []int
+	for i, line := range source {
+		if normalized := normalizeLineForMatching(line); normalized != "" {
+			filtered = append(filtered, normalized)
+			lineNumbers = append(lineNumbers, i+1)
+		}
+	}
+	if len(block) == 0 || len(filtered) == 0 {
+		return 0, 0, false
+	}
+
+	size := min(len(block), len(filtered))
+	bestStart, bestScore := -1, 0.0
+	for i := 0; i+size <= len(filtered); i++ {
+		score := 0.0
+		for j := 0; j < size; j++ {
+			score += lineSimilarity(filtered[i+j], block[j])
+		}
+		if score > bestScore {
+			bestStart, bestScore = i, score
+		}
+	}
+	if bestStart == -1 {
+		return 0, 0, false
+	}
+	return lineNumbers[bestStart], lineNumbers[bestStart+size-1], true
+}
+
+// lineSimilarity returns how similar two lines are, from 0 to 1, as the
+// Dice coefficient of their character bigrams.
+func lineSimilarity(a, b string) float64 {
+	if a == b {
+		return 1
+	}
+	if len(a) < 2 || len(b) < 2 {
+		return 0
+	}
+
+	bigrams := make(map[string]int, len(a)-1)
+	for i := 0; i < len(a)-1; i++ {
+		bigrams[a[i:i+2]]++
+	}
+	shared := 0
+	for i := 0; i < len(b)-1; i++ {
+		if bigrams[b[i:i+2]] > 0 {
+			bigrams[b[i:i+2]]--
+			shared++
+		}
+	}
+	return 2 * float64(shared) / float64(len(a)+len(b)-2)
+}
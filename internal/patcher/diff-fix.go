@@ -2,7 +2,11 @@ package patcher
 
 import (
 	"fmt"
+	"slices"
+	"strconv"
 	"strings"
+
+	"github.com/sokinpui/itf.go/model"
 )
 
 // This file is a direct port of the logic from diff_corrector.py.
@@ -95,9 +99,14 @@ func buildHunkHeader(oldStart, oldLines, newStart, newLines int) string {
 	return fmt.Sprintf("@@ -%d,%d +%d,%d @@\n", oldStart, oldLines, newStart, newLines)
 }
 
-func parseDiffToHunks(diffLines []string) [][]string {
+// parseDiffToHunks splits diff lines into hunks. It also returns the start
+// line each hunk's header gives for the original file, or 0 if the header
+// has no line numbers.
+func parseDiffToHunks(diffLines []string) ([][]string, []int) {
 	var hunks [][]string
+	var oldStarts []int
 	var currentHunk []string
+	currentStart := 0
 
 	for _, line := range diffLines {
 		if strings.HasPrefix(line, "---") || strings.HasPrefix(line, "+++") {
@@ -106,23 +115,83 @@ func parseDiffToHunks(diffLines []string) [][]string {
 		if strings.HasPrefix(line, "@@") {
 			if len(currentHunk) > 0 {
 				hunks = append(hunks, currentHunk)
+				oldStarts = append(oldStarts, currentStart)
 			}
 			currentHunk = nil
+			currentStart = 0
+			if match := hunkHeaderRegex.FindStringSubmatch(line); match != nil {
+				currentStart = atoiOr(match[1], 0)
+			}
 		} else if strings.HasPrefix(line, "+") || strings.HasPrefix(line, "-") || strings.HasPrefix(line, " ") {
 			currentHunk = append(currentHunk, line)
 		}
 	}
 	if len(currentHunk) > 0 {
 		hunks = append(hunks, currentHunk)
+		oldStarts = append(oldStarts, currentStart)
+	}
+	return hunks, oldStarts
+}
+
+// locateTargetBlock finds the region of sourceLines matching the target
+// block of a hunk, searching from startLine. If the block matches more than
+// once, the match closest to the hunk header's start line wins; without a
+// start line, or with two matches equally close to it, the hunk is
+// ambiguous and an error listing the candidate lines is returned. It returns
+// -1 if the block is not found.
+func locateTargetBlock(sourceLines, targetBlock []string, startLine, headerStart int) (int, int, error) {
+	matches := matchAllBlocks(sourceLines, targetBlock, startLine)
+	switch len(matches) {
+	case 0:
+		return -1, -1, nil
+	case 1:
+		return matches[0][0], matches[0][1], nil
+	}
+
+	lines := make([]string, len(matches))
+	for i, m := range matches {
+		lines[i] = strconv.Itoa(m[0])
+	}
+
+	if headerStart > 0 {
+		distance := func(m [2]int) int { return abs(m[0] - headerStart) }
+		slices.SortStableFunc(matches, func(a, b [2]int) int { return distance(a) - distance(b) })
+		if distance(matches[0]) < distance(matches[1]) {
+			return matches[0][0], matches[0][1], nil
+		}
+	}
+	return -1, -1, fmt.Errorf("ambiguous: the hunk matches at lines %s", strings.Join(lines, ", "))
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
 	}
-	return hunks
+	return n
+}
+
+// correction is a diff whose hunk headers were corrected against the file
+// it patches.
+type correction struct {
+	patch    string
+	total    int                // Number of hunks in the original diff
+	hunks    []int              // Index in the original diff of each hunk in patch
+	headers  []int              // Start line in the header of each hunk of the original diff, 0 if none
+	fuzzy    []model.FuzzyMatch // Hunks placed by fuzzy matching
+	rejected []HunkResult       // Hunks left out of patch, in partial mode
 }
 
-func correctDiffHunks(sourceLines []string, rawDiffContent, sourceFilePath string) (string, error) {
+// correctDiffHunks rewrites the hunk headers of a diff with the line numbers
+// where each hunk is found in sourceLines. Hunks that are not found verbatim
+// are placed by fuzzy matching if opts allows it. A hunk that cannot be
+// placed fails the whole diff, unless opts.Partial is set, in which case it
+// is left out and recorded as rejected.
+func correctDiffHunks(sourceLines []string, rawDiffContent, sourceFilePath string, opts Options) (correction, error) {
 	diffLines := strings.Split(rawDiffContent, "\n")
-	hunks := parseDiffToHunks(diffLines)
+	hunks, oldStarts := parseDiffToHunks(diffLines)
+	c := correction{total: len(hunks), headers: oldStarts}
 	if len(hunks) == 0 {
-		return "", nil
+		return c, nil
 	}
 
 	var correctedParts []string
@@ -131,14 +200,33 @@ func correctDiffHunks(sourceLines []string, rawDiffContent, sourceFilePath strin
 
 	lineDiffOffset := 0
 	lastMatchEndLine := 0
-	for _, hunk := range hunks {
+	for i, hunk := range hunks {
 		targetBlock := getTargetBlock(hunk)
-		oldStart, matchEndLine := matchBlock(sourceLines, targetBlock, lastMatchEndLine+1)
+		oldStart, matchEndLine, err := locateTargetBlock(sourceLines, targetBlock, lastMatchEndLine+1, oldStarts[i])
 		if oldStart == -1 {
-			// Continue trying to correct other hunks, but warn the user.
-			return "", fmt.Errorf("could not find matching block for a hunk")
+			reason := "could not find matching block"
+			if err != nil {
+				reason = err.Error()
+			} else if opts.FuzzyThreshold > 0 {
+				match, err := matchBlockFuzzy(sourceLines, hunk, lastMatchEndLine+1, opts.FuzzyThreshold)
+				if err == nil {
+					hunk, oldStart, matchEndLine = match.lines, match.start, match.end
+					c.fuzzy = append(c.fuzzy, model.FuzzyMatch{Hunk: i + 1, Line: match.start, Score: match.score})
+				} else {
+					reason = err.Error()
+				}
+			}
+			if oldStart == -1 {
+				rejected := HunkResult{Index: i, Status: HunkRejected, Reason: reason}
+				if !opts.Partial {
+					return correction{}, &PatchError{Results: []HunkResult{rejected}}
+				}
+				c.rejected = append(c.rejected, rejected)
+				continue
+			}
 		}
 		lastMatchEndLine = matchEndLine
+		c.hunks = append(c.hunks, i)
 
 		addCount, removeCount := 0, 0
 		for _, line := range hunk {
@@ -163,5 +251,26 @@ func correctDiffHunks(sourceLines []string, rawDiffContent, sourceFilePath strin
 		lineDiffOffset += newLines - oldLines
 	}
 
-	return strings.Join(correctedParts, ""), nil
+	c.patch = strings.Join(correctedParts, "")
+	return c, nil
+}
+
+// offsets returns the hunks of the original diff that results show were
+// applied verbatim at another line than their header gave. Hunks placed by
+// fuzzy matching are reported as such instead.
+func (c correction) offsets(results []HunkResult, path string) []model.OffsetMatch {
+	var offsets []model.OffsetMatch
+	for _, r := range results {
+		if r.Status == HunkRejected || r.Index >= len(c.hunks) {
+			continue
+		}
+		i := c.hunks[r.Index]
+		header := c.headers[i]
+		fuzzy := slices.ContainsFunc(c.fuzzy, func(f model.FuzzyMatch) bool { return f.Hunk == i+1 })
+		if header == 0 || r.Line == header || fuzzy {
+			continue
+		}
+		offsets = append(offsets, model.OffsetMatch{Path: path, Hunk: i + 1, Line: r.Line, Offset: r.Line - header})
+	}
+	return offsets
 }
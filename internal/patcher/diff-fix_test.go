@@ -0,0 +1,37 @@
+package patcher
+
+import (
+	"strings"
+	"testing"
+)
+
+// Source lines used to be split from the raw file content, with a trailing
+// "" for the final newline, and are now read without it. Hunks at the end
+// of the file must be corrected the same either way.
+func TestCorrectDiffHunksAtEndOfFile(t *testing.T) {
+	content := "package main\n\nfunc main() {\n\tprintln(\"a\")\n}\n"
+	diff := "--- a/main.go\n+++ b/main.go\n@@ -9,3 +9,4 @@\n func main() {\n \tprintln(\"a\")\n }\n+// end\n"
+
+	withEmpty, err := correctDiffHunks(strings.Split(content, "\n"), diff, "main.go", Options{})
+	if err != nil {
+		t.Fatalf("correctDiffHunks() with the trailing empty line: %v", err)
+	}
+	withoutEmpty, err := correctDiffHunks(strings.Split(strings.TrimSuffix(content, "\n"), "\n"), diff, "main.go", Options{})
+	if err != nil {
+		t.Fatalf("correctDiffHunks() without the trailing empty line: %v", err)
+	}
+	if withEmpty.patch != withoutEmpty.patch {
+		t.Errorf("corrected patches differ:\n%s\nand\n%s", withEmpty.patch, withoutEmpty.patch)
+	}
+	if !strings.Contains(withoutEmpty.patch, "@@ -3,3 +3,4 @@") {
+		t.Errorf("corrected patch = %q, want the hunk at line 3", withoutEmpty.patch)
+	}
+
+	got, _, err := ApplyHunks(strings.Split(strings.TrimSuffix(content, "\n"), "\n"), withoutEmpty.patch)
+	if err != nil {
+		t.Fatalf("ApplyHunks() error = %v", err)
+	}
+	if want := "package main\n\nfunc main() {\n\tprintln(\"a\")\n}\n// end"; strings.Join(got, "\n") != want {
+		t.Errorf("ApplyHunks() = %q, want %q", strings.Join(got, "\n"), want)
+	}
+}
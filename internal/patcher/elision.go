@@ -0,0 +1,261 @@
+package patcher
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+// commentSyntax describes how comments are written in a language.
+type commentSyntax struct {
+	line  []string    // Prefixes of line comments, e.g., "//"
+	block [][2]string // Delimiters of block comments, e.g., "/*" and "*/"
+}
+
+var (
+	cStyleComments    = commentSyntax{line: []string{"//"}, block: [][2]string{{"/*", "*/"}, {"{/*", "*/}"}}}
+	hashComments      = commentSyntax{line: []string{"#"}}
+	dashComments      = commentSyntax{line: []string{"--"}, block: [][2]string{{"/*", "*/"}, {"{-", "-}"}, {"--[[", "]]"}}}
+	semicolonComments = commentSyntax{line: []string{";"}}
+	markupComments    = commentSyntax{block: [][2]string{{"<!--", "-->"}}}
+	cssComments       = commentSyntax{block: [][2]string{{"/*", "*/"}}, line: []string{"//"}}
+
+	// anyComments is used for files whose language is not known.
+	anyComments = commentSyntax{
+		line:  []string{"//", "#", "--", ";"},
+		block: [][2]string{{"/*", "*/"}, {"<!--", "-->"}},
+	}
+)
+
+// commentSyntaxes maps file extensions, or names of files without one, to
+// the comment syntax of their language.
+var commentSyntaxes = map[string]commentSyntax{
+	".go": cStyleComments, ".c": cStyleComments, ".h": cStyleComments, ".cc": cStyleComments,
+	".cpp": cStyleComments, ".hpp": cStyleComments, ".cs": cStyleComments, ".java": cStyleComments,
+	".kt": cStyleComments, ".scala": cStyleComments, ".swift": cStyleComments, ".rs": cStyleComments,
+	".js": cStyleComments, ".jsx": cStyleComments, ".mjs": cStyleComments, ".ts": cStyleComments,
+	".tsx": cStyleComments, ".dart": cStyleComments, ".zig": cStyleComments, ".proto": cStyleComments,
+	".php": {line: []string{"//", "#"}, block: [][2]string{{"/*", "*/"}}},
+
+	".py": hashComments, ".rb": hashComments, ".sh": hashComments, ".bash": hashComments,
+	".zsh": hashComments, ".fish": hashComments, ".pl": hashComments, ".r": hashComments,
+	".ex": hashComments, ".exs": hashComments, ".nix": hashComments, ".yaml": hashComments,
+	".yml": hashComments, ".toml": hashComments, ".conf": hashComments, ".cmake": hashComments,
+	"Dockerfile": hashComments, "Makefile": hashComments,
+
+	".sql": dashComments, ".lua": dashComments, ".hs": dashComments, ".elm": dashComments,
+
+	".clj": semicolonComments, ".el": semicolonComments, ".lisp": semicolonComments,
+	".scm": semicolonComments, ".ini": {line: []string{";", "#"}},
+	".vim": {line: []string{`"`}},
+	".tex": {line: []string{"%"}},
+	".erl": {line: []string{"%"}},
+
+	".html": markupComments, ".htm": markupComments, ".xml": markupComments, ".svg": markupComments,
+	".md": markupComments, ".vue": {line: []string{"//"}, block: [][2]string{{"<!--", "-->"}, {"/*", "*/"}}},
+	".svelte": {line: []string{"//"}, block: [][2]string{{"<!--", "-->"}, {"/*", "*/"}}},
+
+	".css": cssComments, ".scss": cssComments, ".less": cssComments,
+}
+
+// commentSyntaxFor returns the comment syntax of the language of path.
+func commentSyntaxFor(path string) commentSyntax {
+	if syntax, found := commentSyntaxes[strings.ToLower(filepath.Ext(path))]; found {
+		return syntax
+	}
+	if syntax, found := commentSyntaxes[filepath.Base(path)]; found {
+		return syntax
+	}
+	return anyComments
+}
+
+// commentBody returns the text of a line that holds nothing but a comment.
+func (s commentSyntax) commentBody(line string) (string, bool) {
+	trimmed := strings.TrimSpace(line)
+	for _, delims := range s.block {
+		if len(trimmed) >= len(delims[0])+len(delims[1]) &&
+			strings.HasPrefix(trimmed, delims[0]) && strings.HasSuffix(trimmed, delims[1]) {
+			return strings.TrimSpace(trimmed[len(delims[0]) : len(trimmed)-len(delims[1])]), true
+		}
+	}
+	for _, prefix := range s.line {
+		if strings.HasPrefix(trimmed, prefix) {
+			return strings.TrimSpace(strings.TrimLeft(trimmed, prefix)), true
+		}
+	}
+	return "", false
+}
+
+// Elision markers are comments such as "// ... existing code ..." or
+// "# rest of file unchanged...". A marker either starts with an ellipsis and
+// mentions the elided content, or starts with a word describing it and ends
+// with an ellipsis. A bare "// ..." is not a marker, as it is also a common
+// placeholder in new code.
+var (
+	leadingEllipsisRegex  = regexp.MustCompile(`^(?:\.{3,}|…)\s*([^.…]*?)\s*(?:\.{3,}|…)?$`)
+	trailingEllipsisRegex = regexp.MustCompile(`(?i)^(?:existing|unchanged|rest|remaining|remainder|omitted|original)\b[^.…]*?(?:\.{3,}|…)$`)
+	elisionKeywordRegex   = regexp.MustCompile(`(?i)\b(?:existing|unchanged|rest|remaining|remainder|omitted|same|previous|original|other|more)\b`)
+)
+
+// elisionAnchorLines is the most lines next to an elision marker used to
+// locate it in the file.
+const elisionAnchorLines = 3
+
+// isElisionMarker reports whether line is a comment marking elided content.
+func (s commentSyntax) isElisionMarker(line string) bool {
+	body, ok := s.commentBody(line)
+	if !ok {
+		return false
+	}
+	if match := leadingEllipsisRegex.FindStringSubmatch(body); match != nil {
+		return elisionKeywordRegex.MatchString(match[1])
+	}
+	return trailingEllipsisRegex.MatchString(body)
+}
+
+// HasElisions reports whether the content of a file block for path contains
+// elision markers, such as "// ... existing code ...", in place of
+// unchanged parts of the file.
+func HasElisions(block []string, path string) bool {
+	syntax := commentSyntaxFor(path)
+	for _, line := range block {
+		if syntax.isElisionMarker(line) {
+			return true
+		}
+	}
+	return false
+}
+
+// MergeElided merges a file block containing elision markers with the
+// current source lines of the file at path. The block is split at each
+// marker, and the lines next to a marker are located in the source, in
+// order, with the same whitespace tolerance as matchBlock. The source lines
+// between them replace the marker. A marker at the start or end of the block
+// stands for the beginning or end of the file.
+//
+// If the lines next to a marker are modified, the nearest unmodified lines
+// are used instead, and the modified lines are kept as given. If no line of
+// the block next to a marker is found, an error is returned rather than a
+// file missing the elided content.
+func MergeElided(source, block []string, path string) ([]string, error) {
+	syntax := commentSyntaxFor(path)
+	segments := [][]string{nil}
+	for _, line := range block {
+		if syntax.isElisionMarker(line) {
+			segments = append(segments, nil)
+			continue
+		}
+		segments[len(segments)-1] = append(segments[len(segments)-1], line)
+	}
+
+	merged := make([]string, 0, len(source))
+	cursor := 0
+	for i := 1; i < len(segments); i++ {
+		before, after := segments[i-1], segments[i]
+		merged = append(merged, before...)
+
+		start := cursor
+		if nonBlank := nonBlankLines(before); len(nonBlank) > 0 {
+			end, ok := locateSegmentEnd(source, nonBlank, cursor)
+			if !ok {
+				return nil, fmt.Errorf("elision marker #%d: the lines before it are not in the file", i)
+			}
+			start = end
+		}
+		stop := len(source)
+		if nonBlank := nonBlankLines(after); len(nonBlank) > 0 {
+			begin, ok := locateSegmentStart(source, nonBlank, start)
+			if !ok {
+				return nil, fmt.Errorf("elision marker #%d: the lines after it are not in the file", i)
+			}
+			stop = begin
+		}
+
+		// Avoid doubling the blank lines around the marker.
+		elided := source[start:stop]
+		if len(before) > 0 && strings.TrimSpace(before[len(before)-1]) == "" {
+			for len(elided) > 0 && strings.TrimSpace(elided[0]) == "" {
+				elided = elided[1:]
+			}
+		}
+		if len(after) > 0 && strings.TrimSpace(after[0]) == "" {
+			for len(elided) > 0 && strings.TrimSpace(elided[len(elided)-1]) == "" {
+				elided = elided[:len(elided)-1]
+			}
+		}
+		merged = append(merged, elided...)
+		cursor = stop
+	}
+	return append(merged, segments[len(segments)-1]...), nil
+}
+
+// locateSegmentEnd finds the last lines of a segment in source, at or after
+// index from, and returns the index of the source line after them. Shorter
+// anchors are tried before lines at the end of the segment are skipped as
+// new.
+func locateSegmentEnd(source, lines []string, from int) (int, bool) {
+	for last := len(lines); last > 0; last-- {
+		for size := min(elisionAnchorLines, last); size > 0; size-- {
+			if _, end, ok := matchAnchor(source, lines[last-size:last], from); ok {
+				return end, true
+			}
+		}
+	}
+	return 0, false
+}
+
+// locateSegmentStart finds the first lines of a segment in source, at or
+// after index from, and returns the index of the first of them. Shorter
+// anchors are tried before lines at the start of the segment are skipped as
+// new.
+func locateSegmentStart(source, lines []string, from int) (int, bool) {
+	for first := range lines {
+		for size := min(elisionAnchorLines, len(lines)-first); size > 0; size-- {
+			if start, _, ok := matchAnchor(source, lines[first:first+size], from); ok {
+				return start, true
+			}
+		}
+	}
+	return 0, false
+}
+
+// matchAnchor locates anchor in source at or after index from, and returns
+// the half-open range of indexes it spans. A single line without letters or
+// digits, such as a closing brace, is too common to be matched loosely and
+// must match exactly, indentation included.
+func matchAnchor(source, anchor []string, from int) (int, int, bool) {
+	if len(anchor) == 1 && !strings.ContainsFunc(anchor[0], isWordRune) {
+		for i := from; i < len(source); i++ {
+			if strings.TrimRight(source[i], " \t") == strings.TrimRight(anchor[0], " \t") {
+				return i, i + 1, true
+			}
+		}
+		return 0, 0, false
+	}
+	if from >= len(source) {
+		return 0, 0, false
+	}
+	start, end := matchBlock(source, anchor, from+1)
+	if start <= from {
+		return 0, 0, false
+	}
+	return start - 1, end, true
+}
+
+// isWordRune reports whether r is a letter or digit.
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+// nonBlankLines returns the lines that are not empty or whitespace only.
+func nonBlankLines(lines []string) []string {
+	var result []string
+	for _, line := range lines {
+		if strings.TrimSpace(line) != "" {
+			result = append(result, line)
+		}
+	}
+	return result
+}
@@ -0,0 +1,148 @@
+package patcher
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+const elisionGoSource = `package main
+
+import "fmt"
+
+func a() {
+	fmt.Println("a")
+}
+
+func b() {
+	fmt.Println("b")
+}
+
+func c() {
+	fmt.Println("c")
+}`
+
+func TestMergeElided(t *testing.T) {
+	tests := []struct {
+		name    string
+		path    string
+		source  string
+		block   string
+		want    string
+		wantErr string
+	}{
+		{
+			name:   "marker at the start",
+			path:   "main.go",
+			source: elisionGoSource,
+			block:  "// ... existing code ...\n\nfunc c() {\n\tfmt.Println(\"C\")\n}",
+			want:   strings.Replace(elisionGoSource, `"c"`, `"C"`, 1),
+		},
+		{
+			name:   "marker in the middle",
+			path:   "main.go",
+			source: elisionGoSource,
+			block:  "package main\n\nimport \"fmt\"\n\n// ... existing code ...\n\nfunc c() {\n\tfmt.Println(\"C\")\n}",
+			want:   strings.Replace(elisionGoSource, `"c"`, `"C"`, 1),
+		},
+		{
+			name:   "marker at the end",
+			path:   "main.go",
+			source: elisionGoSource,
+			block:  "package main\n\nimport \"fmt\"\n\nfunc a() {\n\tfmt.Println(\"A\")\n}\n\n// ... rest of the file ...",
+			want:   strings.Replace(elisionGoSource, `"a"`, `"A"`, 1),
+		},
+		{
+			name:   "multiple markers",
+			path:   "main.go",
+			source: elisionGoSource,
+			block:  "// ... existing code ...\nfunc b() {\n\tfmt.Println(\"B\")\n}\n// ... existing code ...",
+			want:   strings.Replace(elisionGoSource, `"b"`, `"B"`, 1),
+		},
+		{
+			name:   "modified lines next to the markers",
+			path:   "main.go",
+			source: elisionGoSource,
+			block:  "// ... existing code ...\n// b prints b.\nfunc b() {\n\tfmt.Println(\"b\")\n}\n// ... existing code ...",
+			want:   strings.Replace(elisionGoSource, "func b", "// b prints b.\nfunc b", 1),
+		},
+		{
+			name:    "lines before the marker not in the file",
+			path:    "main.go",
+			source:  elisionGoSource,
+			block:   "func z() {\n\treturn\n// ... existing code ...",
+			wantErr: "elision marker #1: the lines before it are not in the file",
+		},
+		{
+			name:    "lines after the marker not in the file",
+			path:    "main.go",
+			source:  elisionGoSource,
+			block:   "// ... existing code ...\nfunc z() {\n\treturn",
+			wantErr: "elision marker #1: the lines after it are not in the file",
+		},
+		{
+			name:   "hash comments in Python",
+			path:   "app.py",
+			source: "import os\n\n\ndef a():\n    return 1\n\n\ndef b():\n    return 2",
+			block:  "# ... existing code ...\n\n\ndef b():\n    return 3",
+			want:   "import os\n\n\ndef a():\n    return 1\n\n\ndef b():\n    return 3",
+		},
+		{
+			name:   "markup comments in markdown",
+			path:   "README.md",
+			source: "# Title\n\nIntro.\n\n## Usage\n\nRun it.",
+			block:  "<!-- ... existing content ... -->\n\n## Usage\n\nRun it with `go run .`.",
+			want:   "# Title\n\nIntro.\n\n## Usage\n\nRun it with `go run .`.",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			block := strings.Split(tt.block, "\n")
+			if !HasElisions(block, tt.path) {
+				t.Fatalf("HasElisions() = false, want true")
+			}
+			got, err := MergeElided(strings.Split(tt.source, "\n"), block, tt.path)
+			if tt.wantErr != "" {
+				if err == nil || err.Error() != tt.wantErr {
+					t.Fatalf("MergeElided() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("MergeElided() error = %v", err)
+			}
+			if want := strings.Split(tt.want, "\n"); !slices.Equal(got, want) {
+				t.Errorf("MergeElided() =\n%s\nwant\n%s", strings.Join(got, "\n"), tt.want)
+			}
+		})
+	}
+}
+
+func TestHasElisions(t *testing.T) {
+	tests := []struct {
+		name  string
+		path  string
+		block string
+		want  bool
+	}{
+		{"line comment", "main.go", "// ... existing code ...", true},
+		{"trailing ellipsis", "main.go", "// rest of file unchanged...", true},
+		{"block comment", "main.go", "/* ... existing code ... */", true},
+		{"bare ellipsis", "main.go", "// ...", false},
+		{"ellipsis without a keyword", "main.go", "// ... handle the error ...", false},
+		{"comment syntax of another language", "main.go", "# ... existing code ...", false},
+		{"hash comment", "app.py", "# ... existing code ...", true},
+		{"markup comment", "README.md", "<!-- ... existing content ... -->", true},
+		{"line comment in markdown", "README.md", "// ... existing code ...", false},
+		{"unknown language", "notes.unknown", "-- ... existing code ...", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := HasElisions(strings.Split(tt.block, "\n"), tt.path); got != tt.want {
+				t.Errorf("HasElisions(%q) = %v, want %v", tt.block, got, tt.want)
+			}
+		})
+	}
+}
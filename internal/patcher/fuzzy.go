@@ -0,0 +1,199 @@
+package patcher
+
+import (
+	"fmt"
+	"math"
+)
+
+// Options tunes how changes are located in and merged into the files they
+// patch.
+type Options struct {
+	// FuzzyThreshold is the minimum similarity, from 0 to 1, a hunk needs to
+	// be placed by fuzzy matching when its lines are not found verbatim.
+	// Zero disables fuzzy matching.
+	FuzzyThreshold float64
+	// Partial applies the hunks of a diff that can be placed even if others
+	// cannot, instead of failing the whole diff.
+	Partial bool
+	// MergeGo merges blocks for existing .go files by declaration instead of
+	// replacing the files.
+	MergeGo bool
+}
+
+// fuzzyMargin is how much better the best fuzzy match must score than a
+// match at any other location to be accepted.
+const fuzzyMargin = 0.05
+
+// extraLineCost is the cost of a file line inside the matched region that
+// the hunk leaves out. It is lower than the cost of a hunk line missing from
+// the file, so a region containing every line of the hunk is preferred.
+const extraLineCost = 0.5
+
+// minLineSimilarity is the similarity below which two lines are never
+// paired by fuzzy matching.
+const minLineSimilarity = 0.5
+
+// Alignment steps between the lines of a hunk and the lines of a file.
+const (
+	alignPair = iota // The hunk line corresponds to the file line
+	alignHunk        // The hunk line is not in the file
+	alignFile        // The file line is not in the hunk
+)
+
+// fuzzyMatch is the location of a hunk found by fuzzy matching.
+type fuzzyMatch struct {
+	start, end int      // 1-based, inclusive lines of the matched region
+	score      float64  // Similarity of the hunk to the region, from 0 to 1
+	lines      []string // The hunk rewritten against the region
+}
+
+// matchBlockFuzzy locates a hunk in source when matchBlock cannot, searching
+// from startLine. It aligns the non-blank context and removed lines of the
+// hunk to the source with a line-level edit distance, where similar lines
+// may be paired, and scores each location by how few edits it needs. The
+// best location is accepted if it scores at least threshold and clearly
+// better than any location that does not overlap it.
+//
+// The returned hunk has its context and removed lines replaced by the source
+// lines they were paired with. Hunk lines missing from the source are
+// dropped, and source lines missing from the hunk become context lines.
+func matchBlockFuzzy(source, hunk []string, startLine int, threshold float64) (fuzzyMatch, error) {
+	// The non-blank context and removed lines, with their index in hunk.
+	var block []string
+	var blockLines []int
+	for i, line := range hunk {
+		if line == "" || (line[0] != ' ' && line[0] != '-') {
+			continue
+		}
+		if normalized := normalizeLineForMatching(line[1:]); normalized != "" {
+			block = append(block, normalized)
+			blockLines = append(blockLines, i)
+		}
+	}
+
+	var filtered []string
+	var lineNumbers []int
+	for i := max(startLine, 1) - 1; i < len(source); i++ {
+		if normalized := normalizeLineForMatching(source[i]); normalized != "" {
+			filtered = append(filtered, normalized)
+			lineNumbers = append(lineNumbers, i+1)
+		}
+	}
+	if len(block) == 0 || len(filtered) == 0 {
+		return fuzzyMatch{}, fmt.Errorf("could not find matching block")
+	}
+
+	// cost[i][j] is the fewest edits aligning the first i block lines so that
+	// they end at filtered line j, with start[i][j] the filtered line the
+	// alignment starts at. Source lines before the start and after the end
+	// are free.
+	n, m := len(block), len(filtered)
+	cost := make([][]float64, n+1)
+	start := make([][]int, n+1)
+	step := make([][]byte, n+1)
+	for i := range cost {
+		cost[i] = make([]float64, m+1)
+		start[i] = make([]int, m+1)
+		step[i] = make([]byte, m+1)
+	}
+	for j := 0; j <= m; j++ {
+		start[0][j] = j
+	}
+	for i := 1; i <= n; i++ {
+		cost[i][0] = float64(i)
+		step[i][0] = alignHunk
+		for j := 1; j <= m; j++ {
+			best, from := cost[i-1][j]+1, byte(alignHunk)
+			if c := cost[i][j-1] + extraLineCost; c < best {
+				best, from = c, alignFile
+			}
+			if sim := lineSimilarity(block[i-1], filtered[j-1]); sim >= minLineSimilarity {
+				if c := cost[i-1][j-1] + 1 - sim; c <= best {
+					best, from = c, alignPair
+				}
+			}
+			cost[i][j], step[i][j] = best, from
+			switch from {
+			case alignPair:
+				start[i][j] = start[i-1][j-1]
+			case alignHunk:
+				start[i][j] = start[i-1][j]
+			case alignFile:
+				start[i][j] = start[i][j-1]
+			}
+		}
+	}
+
+	score := func(j int) float64 {
+		return math.Max(0, 1-cost[n][j]/float64(n))
+	}
+	bestEnd := 1
+	for j := 2; j <= m; j++ {
+		if cost[n][j] < cost[n][bestEnd] {
+			bestEnd = j
+		}
+	}
+	bestStart := min(start[n][bestEnd], bestEnd-1)
+	bestScore := score(bestEnd)
+	if bestScore < threshold {
+		return fuzzyMatch{}, fmt.Errorf("could not find matching block (closest match at line %d scores %.0f%%)",
+			lineNumbers[bestStart], bestScore*100)
+	}
+
+	// Refuse if a location that does not overlap the best one scores about
+	// the same.
+	for j := 1; j <= m; j++ {
+		if j > bestStart && start[n][j] < bestEnd {
+			continue
+		}
+		if s := score(j); s >= threshold && bestScore-s < fuzzyMargin {
+			return fuzzyMatch{}, fmt.Errorf("ambiguous fuzzy match: lines %d and %d both score about %.0f%%",
+				lineNumbers[bestStart], lineNumbers[min(start[n][j], j-1)], bestScore*100)
+		}
+	}
+
+	// Walk the alignment back from its end.
+	paired := make([]int, n) // Filtered line of each block line, or -1
+	var extra [][2]int       // Filtered lines missing from the hunk, with the block line they precede
+	for i, j := n, bestEnd; i > 0; {
+		switch step[i][j] {
+		case alignPair:
+			paired[i-1] = j - 1
+			i, j = i-1, j-1
+		case alignHunk:
+			paired[i-1] = -1
+			i--
+		case alignFile:
+			extra = append(extra, [2]int{j - 1, i})
+			j--
+		}
+	}
+
+	var lines []string
+	next := len(extra) - 1
+	flushExtra := func(before int) {
+		for ; next >= 0 && extra[next][1] <= before; next-- {
+			lines = append(lines, " "+source[lineNumbers[extra[next][0]]-1])
+		}
+	}
+	k := 0
+	for i, line := range hunk {
+		if k < n && blockLines[k] == i {
+			flushExtra(k)
+			if j := paired[k]; j >= 0 {
+				lines = append(lines, line[:1]+source[lineNumbers[j]-1])
+			}
+			k++
+			continue
+		}
+		lines = append(lines, line)
+	}
+	flushExtra(n)
+
+	return fuzzyMatch{
+		start: lineNumbers[bestStart],
+		end:   lineNumbers[bestEnd-1],
+		score: bestScore,
+		lines: lines,
+	}, nil
+}
@@ -0,0 +1,46 @@
+package patcher
+
+import (
+	"math"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestMatchBlockFuzzy(t *testing.T) {
+	source := strings.Split("package a\n\nfunc a() {\n\tx := compute(1)\n\treturn x\n}", "\n")
+	hunk := []string{" func a() {", "-\tx := compute(2)", "+\tx := compute(3)", " \treturn x", " }"}
+	// One of the four lines differs, by its similarity to the file's line.
+	wantScore := 1 - (1-lineSimilarity(normalizeLineForMatching("x := compute(2)"), normalizeLineForMatching("x := compute(1)")))/4
+
+	m, err := matchBlockFuzzy(source, hunk, 1, wantScore)
+	if err != nil {
+		t.Fatalf("matchBlockFuzzy() at the threshold error = %v", err)
+	}
+	if m.start != 3 || m.end != 6 {
+		t.Errorf("matchBlockFuzzy() placed the hunk at lines %d-%d, want 3-6", m.start, m.end)
+	}
+	if math.Abs(m.score-wantScore) > 1e-9 {
+		t.Errorf("matchBlockFuzzy() score = %v, want %v", m.score, wantScore)
+	}
+	wantLines := []string{" func a() {", "-\tx := compute(1)", "+\tx := compute(3)", " \treturn x", " }"}
+	if !slices.Equal(m.lines, wantLines) {
+		t.Errorf("matchBlockFuzzy() lines = %q, want %q", m.lines, wantLines)
+	}
+
+	_, err = matchBlockFuzzy(source, hunk, 1, wantScore+0.01)
+	if err == nil || !strings.Contains(err.Error(), "closest match at line 3") {
+		t.Errorf("matchBlockFuzzy() above the score error = %v, want the closest match at line 3", err)
+	}
+}
+
+func TestMatchBlockFuzzyTie(t *testing.T) {
+	region := "func a() {\n\tx := compute(1)\n\treturn x\n}"
+	source := strings.Split(region+"\n\nvar unrelated = true\n\n"+region, "\n")
+	hunk := []string{" func a() {", "-\tx := compute(2)", "+\tx := compute(3)", " \treturn x", " }"}
+
+	_, err := matchBlockFuzzy(source, hunk, 1, 0.5)
+	if err == nil || !strings.Contains(err.Error(), "ambiguous fuzzy match: lines 1 and 8") {
+		t.Errorf("matchBlockFuzzy() error = %v, want an ambiguous match at lines 1 and 8", err)
+	}
+}
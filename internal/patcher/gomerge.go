@@ -0,0 +1,358 @@
+package patcher
+
+import (
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// packageClauseRegex matches the package clause of a Go file.
+var packageClauseRegex = regexp.MustCompile(`^package\s+\w+`)
+
+// hasPackageClause reports whether the lines of a Go file block start a
+// complete file. A block without one can only be a set of declarations.
+func hasPackageClause(block []string) bool {
+	for _, line := range block {
+		if packageClauseRegex.MatchString(strings.TrimSpace(line)) {
+			return true
+		}
+	}
+	return false
+}
+
+// textEdit replaces the bytes of a source between two offsets.
+type textEdit struct {
+	start, end int
+	text       string
+}
+
+// MergeGoDecls merges the top-level declarations of a Go file block into the
+// current source lines of the file. Functions, types, constants and
+// variables replace the declarations of the same name, with methods matched
+// by receiver type and name, and are appended to the file otherwise. A
+// declaration without a doc comment keeps the one of the declaration it
+// replaces. Imports of the block missing from the file are added. The
+// result is formatted with gofmt. Declarations of the file are never
+// removed, even if the block holds a whole file without them.
+func MergeGoDecls(source, block []string) ([]string, error) {
+	src := strings.Join(source, "\n") + "\n"
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, "", src, parser.ParseComments)
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse the current file: %w", err)
+	}
+
+	blockSrc := strings.Join(block, "\n") + "\n"
+	if !hasPackageClause(block) {
+		blockSrc = "package " + file.Name.Name + "\n" + blockSrc
+	}
+	blockFile, err := parser.ParseFile(fset, "", blockSrc, parser.ParseComments)
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse the block as Go declarations: %w", err)
+	}
+
+	offset := func(pos token.Pos) int { return fset.Position(pos).Offset }
+	blockText := func(node ast.Node) string { return blockSrc[offset(node.Pos()):offset(node.End())] }
+
+	existing := declsByName(file)
+	var edits []textEdit
+	var appended []string
+	replaced := make(map[ast.Decl]bool)
+
+	for _, decl := range blockFile.Decls {
+		if gen, ok := decl.(*ast.GenDecl); ok && gen.Tok == token.IMPORT {
+			continue
+		}
+		names := declNames(decl)
+		target, spec := findMergeTarget(existing, decl, names)
+		text := declText(decl, blockText)
+
+		switch {
+		case target == nil:
+			appended = append(appended, text)
+		case spec != nil:
+			// A single spec replaces its counterpart in a grouped declaration.
+			blockSpec := decl.(*ast.GenDecl).Specs[0]
+			start, end := specRange(spec, blockSpec, offset)
+			edits = append(edits, textEdit{start, end, specText(blockSpec, blockText)})
+		case replaced[target]:
+			// Another declaration of the block already replaced the target.
+			appended = append(appended, text)
+		default:
+			replaced[target] = true
+			start := offset(target.Pos())
+			if doc := declDoc(target); doc != nil && declDoc(decl) != nil {
+				start = offset(doc.Pos())
+			}
+			edits = append(edits, textEdit{start, offset(target.End()), text})
+			// Drop the other declarations the block declaration covers.
+			for _, name := range names {
+				for _, other := range existing[name] {
+					if other != target && !replaced[other] && coveredBy(other, names) {
+						replaced[other] = true
+						edits = append(edits, textEdit{declStart(other, offset), offset(other.End()), ""})
+					}
+				}
+			}
+		}
+	}
+
+	edits = append(edits, importEdits(file, blockFile, src, offset)...)
+	if len(appended) > 0 {
+		edits = append(edits, textEdit{len(src), len(src), "\n" + strings.Join(appended, "\n\n") + "\n"})
+	}
+
+	merged, err := applyTextEdits(src, edits)
+	if err != nil {
+		return nil, err
+	}
+	formatted, err := format.Source([]byte(merged))
+	if err != nil {
+		return nil, fmt.Errorf("cannot format the merged file: %w", err)
+	}
+	return strings.Split(strings.TrimRight(string(formatted), "\n"), "\n"), nil
+}
+
+// declsByName indexes the top-level declarations of a file, other than
+// imports, by the names they declare.
+func declsByName(file *ast.File) map[string][]ast.Decl {
+	decls := make(map[string][]ast.Decl)
+	for _, decl := range file.Decls {
+		for _, name := range declNames(decl) {
+			decls[name] = append(decls[name], decl)
+		}
+	}
+	return decls
+}
+
+// declNames returns the names declared by a top-level declaration. Methods
+// are named after their receiver type, e.g., "Server.Start". Blank names are
+// left out, so they are never matched.
+func declNames(decl ast.Decl) []string {
+	var names []string
+	switch d := decl.(type) {
+	case *ast.FuncDecl:
+		if d.Recv != nil && len(d.Recv.List) > 0 {
+			return []string{receiverName(d.Recv.List[0].Type) + "." + d.Name.Name}
+		}
+		names = append(names, d.Name.Name)
+	case *ast.GenDecl:
+		if d.Tok == token.IMPORT {
+			return nil
+		}
+		for _, spec := range d.Specs {
+			switch s := spec.(type) {
+			case *ast.TypeSpec:
+				names = append(names, s.Name.Name)
+			case *ast.ValueSpec:
+				for _, name := range s.Names {
+					names = append(names, name.Name)
+				}
+			}
+		}
+	}
+	return slices.DeleteFunc(names, func(name string) bool { return name == "_" })
+}
+
+// receiverName returns the name of the type of a method receiver, without
+// pointers and type parameters.
+func receiverName(expr ast.Expr) string {
+	for {
+		switch e := expr.(type) {
+		case *ast.StarExpr:
+			expr = e.X
+		case *ast.ParenExpr:
+			expr = e.X
+		case *ast.IndexExpr:
+			expr = e.X
+		case *ast.IndexListExpr:
+			expr = e.X
+		case *ast.Ident:
+			return e.Name
+		default:
+			return ""
+		}
+	}
+}
+
+// findMergeTarget returns the existing declaration that a block declaration
+// replaces. If the block declaration has a single spec and the existing one
+// is a group, the spec it replaces within the group is returned as well.
+// Functions named init are only replaced if the file has exactly one.
+func findMergeTarget(existing map[string][]ast.Decl, decl ast.Decl, names []string) (ast.Decl, ast.Spec) {
+	for _, name := range names {
+		candidates := existing[name]
+		if len(candidates) == 0 || (name == "init" && len(candidates) != 1) {
+			continue
+		}
+		target := candidates[0]
+		gen, isGen := decl.(*ast.GenDecl)
+		targetGen, targetIsGen := target.(*ast.GenDecl)
+		if isGen && targetIsGen && len(gen.Specs) == 1 && len(targetGen.Specs) > 1 && gen.Tok == targetGen.Tok {
+			for _, spec := range targetGen.Specs {
+				if slices.Contains(specNames(spec), name) {
+					return target, spec
+				}
+			}
+		}
+		return target, nil
+	}
+	return nil, nil
+}
+
+// coveredBy reports whether every name declared by decl is in names.
+func coveredBy(decl ast.Decl, names []string) bool {
+	declared := declNames(decl)
+	if len(declared) == 0 {
+		return false
+	}
+	for _, name := range declared {
+		if !slices.Contains(names, name) {
+			return false
+		}
+	}
+	return true
+}
+
+// specNames returns the names declared by a spec.
+func specNames(spec ast.Spec) []string {
+	switch s := spec.(type) {
+	case *ast.TypeSpec:
+		return []string{s.Name.Name}
+	case *ast.ValueSpec:
+		var names []string
+		for _, name := range s.Names {
+			names = append(names, name.Name)
+		}
+		return names
+	}
+	return nil
+}
+
+// declDoc returns the doc comment of a declaration, if any.
+func declDoc(decl ast.Decl) *ast.CommentGroup {
+	switch d := decl.(type) {
+	case *ast.FuncDecl:
+		return d.Doc
+	case *ast.GenDecl:
+		return d.Doc
+	}
+	return nil
+}
+
+// declStart returns the offset a declaration starts at, including its doc
+// comment.
+func declStart(decl ast.Decl, offset func(token.Pos) int) int {
+	if doc := declDoc(decl); doc != nil {
+		return offset(doc.Pos())
+	}
+	return offset(decl.Pos())
+}
+
+// declText returns the text of a block declaration with its doc comment.
+func declText(decl ast.Decl, blockText func(ast.Node) string) string {
+	if doc := declDoc(decl); doc != nil {
+		return blockText(doc) + "\n" + blockText(decl)
+	}
+	return blockText(decl)
+}
+
+// specRange returns the offsets of an existing spec to replace with a block
+// spec, including its doc comment if the block spec has one.
+func specRange(spec, blockSpec ast.Spec, offset func(token.Pos) int) (int, int) {
+	start := offset(spec.Pos())
+	if doc, blockDoc := specDoc(spec), specDoc(blockSpec); doc != nil && blockDoc != nil {
+		start = offset(doc.Pos())
+	}
+	return start, offset(spec.End())
+}
+
+// specText returns the text of a block spec with its doc comment.
+func specText(spec ast.Spec, blockText func(ast.Node) string) string {
+	if doc := specDoc(spec); doc != nil {
+		return blockText(doc) + "\n" + blockText(spec)
+	}
+	return blockText(spec)
+}
+
+// specDoc returns the doc comment of a spec, if any.
+func specDoc(spec ast.Spec) *ast.CommentGroup {
+	switch s := spec.(type) {
+	case *ast.TypeSpec:
+		return s.Doc
+	case *ast.ValueSpec:
+		return s.Doc
+	}
+	return nil
+}
+
+// importEdits returns the edits adding the imports of blockFile that are
+// missing from file. They are added to the first import declaration of the
+// file, or after its package clause if it has none.
+func importEdits(file, blockFile *ast.File, src string, offset func(token.Pos) int) []textEdit {
+	have := make(map[string]bool)
+	for _, spec := range file.Imports {
+		have[importKey(spec)] = true
+	}
+	var missing []string
+	for _, spec := range blockFile.Imports {
+		if key := importKey(spec); !have[key] {
+			have[key] = true
+			missing = append(missing, key)
+		}
+	}
+	if len(missing) == 0 {
+		return nil
+	}
+
+	for _, decl := range file.Decls {
+		gen, ok := decl.(*ast.GenDecl)
+		if !ok || gen.Tok != token.IMPORT {
+			continue
+		}
+		if gen.Lparen.IsValid() {
+			at := offset(gen.Rparen)
+			text := "\t" + strings.Join(missing, "\n\t") + "\n"
+			if !strings.HasSuffix(strings.TrimRight(src[:at], " \t"), "\n") {
+				// The group closes on the line of its last import.
+				text = "\n" + text
+			}
+			return []textEdit{{at, at, text}}
+		}
+		// Turn a single import into a group.
+		spec := src[offset(gen.Specs[0].Pos()):offset(gen.Specs[0].End())]
+		lines := append([]string{spec}, missing...)
+		return []textEdit{{offset(gen.Pos()), offset(gen.End()), "import (\n\t" + strings.Join(lines, "\n\t") + "\n)"}}
+	}
+
+	at := offset(file.Name.End())
+	return []textEdit{{at, at, "\n\nimport (\n\t" + strings.Join(missing, "\n\t") + "\n)"}}
+}
+
+// importKey returns an import spec as it is written, e.g., `str "strings"`.
+func importKey(spec *ast.ImportSpec) string {
+	if spec.Name != nil {
+		return spec.Name.Name + " " + spec.Path.Value
+	}
+	return spec.Path.Value
+}
+
+// applyTextEdits applies edits to src. It fails if two edits overlap, as
+// when the block declares the same name twice.
+func applyTextEdits(src string, edits []textEdit) (string, error) {
+	slices.SortStableFunc(edits, func(a, b textEdit) int { return b.start - a.start })
+	limit := len(src)
+	for _, e := range edits {
+		if e.end > limit {
+			return "", fmt.Errorf("the block replaces overlapping declarations")
+		}
+		src = src[:e.start] + e.text + src[e.end:]
+		limit = e.start
+	}
+	return src, nil
+}
@@ -0,0 +1,120 @@
+package patcher
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestMergeGoDecls(t *testing.T) {
+	tests := []struct {
+		name    string
+		source  string
+		block   string
+		want    string
+		wantErr string
+	}{
+		{
+			name:   "function replaced",
+			source: "package a\n\nfunc A() int { return 1 }\n\nfunc B() {}",
+			block:  "func A() int { return 2 }",
+			want:   "package a\n\nfunc A() int { return 2 }\n\nfunc B() {}",
+		},
+		{
+			name:   "method matched by receiver",
+			source: "package a\n\ntype S struct{ n int }\n\nfunc Start() {}\n\nfunc (s *S) Start() {}\n\nfunc (t T) Start() {}",
+			block:  "func (s *S) Start() { s.n++ }",
+			want:   "package a\n\ntype S struct{ n int }\n\nfunc Start() {}\n\nfunc (s *S) Start() { s.n++ }\n\nfunc (t T) Start() {}",
+		},
+		{
+			name:   "new declarations appended in order",
+			source: "package a\n\nfunc A() {}",
+			block:  "func C() {}\n\nfunc B() {}",
+			want:   "package a\n\nfunc A() {}\n\nfunc C() {}\n\nfunc B() {}",
+		},
+		{
+			name:   "doc comment kept",
+			source: "package a\n\n// A does a.\nfunc A() {}",
+			block:  "func A() { println() }",
+			want:   "package a\n\n// A does a.\nfunc A() { println() }",
+		},
+		{
+			name:   "doc comment replaced",
+			source: "package a\n\n// A does a.\nfunc A() {}",
+			block:  "// A does more.\nfunc A() { println() }",
+			want:   "package a\n\n// A does more.\nfunc A() { println() }",
+		},
+		{
+			name:   "spec replaced in a group",
+			source: "package a\n\nconst (\n\tX = 1\n\tY = 2\n)",
+			block:  "const Y = 3",
+			want:   "package a\n\nconst (\n\tX = 1\n\tY = 3\n)",
+		},
+		{
+			name:   "import added to a group",
+			source: "package a\n\nimport (\n\t\"fmt\"\n)\n\nfunc A() { fmt.Println() }",
+			block:  "import \"strings\"\n\nfunc B() string { return strings.ToUpper(\"b\") }",
+			want:   "package a\n\nimport (\n\t\"fmt\"\n\t\"strings\"\n)\n\nfunc A() { fmt.Println() }\n\nfunc B() string { return strings.ToUpper(\"b\") }",
+		},
+		{
+			name:   "import added to a group on one line",
+			source: "package a\n\nimport (\"fmt\")\n\nfunc A() { fmt.Println() }",
+			block:  "import \"strings\"\n\nfunc A() { fmt.Println(strings.ToUpper(\"a\")) }",
+			want:   "package a\n\nimport (\n\t\"fmt\"\n\t\"strings\"\n)\n\nfunc A() { fmt.Println(strings.ToUpper(\"a\")) }",
+		},
+		{
+			name:   "single import turned into a group",
+			source: "package a\n\nimport \"fmt\"\n\nfunc A() { fmt.Println() }",
+			block:  "import str \"strings\"\n\nfunc B() string { return str.ToUpper(\"b\") }",
+			want:   "package a\n\nimport (\n\t\"fmt\"\n\tstr \"strings\"\n)\n\nfunc A() { fmt.Println() }\n\nfunc B() string { return str.ToUpper(\"b\") }",
+		},
+		{
+			name:   "imports added to a file without any",
+			source: "package a\n\nfunc A() {}",
+			block:  "import \"os\"\n\nfunc B() { os.Exit(1) }",
+			want:   "package a\n\nimport (\n\t\"os\"\n)\n\nfunc A() {}\n\nfunc B() { os.Exit(1) }",
+		},
+		{
+			// A full file cannot remove declarations in this mode.
+			name:   "full file keeps other declarations",
+			source: "package a\n\nfunc A() {}\n\nfunc B() {}",
+			block:  "package a\n\nfunc A() { println() }",
+			want:   "package a\n\nfunc A() { println() }\n\nfunc B() {}",
+		},
+		{
+			name:    "file cannot be parsed",
+			source:  "package a\n\nfunc A() {",
+			block:   "func A() {}",
+			wantErr: "cannot parse the current file",
+		},
+		{
+			name:    "block cannot be parsed",
+			source:  "package a\n\nfunc A() {}",
+			block:   "func A() {",
+			wantErr: "cannot parse the block as Go declarations",
+		},
+		{
+			name:    "same spec replaced twice",
+			source:  "package a\n\nvar (\n\tX = 1\n\tY = 2\n)",
+			block:   "var X = 3\n\nvar X = 4",
+			wantErr: "the block replaces overlapping declarations",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := MergeGoDecls(strings.Split(tt.source, "\n"), strings.Split(tt.block, "\n"))
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("MergeGoDecls() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("MergeGoDecls() error = %v", err)
+			}
+			if joined := strings.Join(got, "\n"); joined != tt.want {
+				t.Errorf("MergeGoDecls() =\n%s\nwant\n%s", joined, tt.want)
+			}
+		})
+	}
+}
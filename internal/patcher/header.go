@@ -0,0 +1,142 @@
+package patcher
+
+import (
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// devNull is the path git uses for the missing side of a created or deleted
+// file.
+const devNull = "/dev/null"
+
+// gitHeaderRegex parses a "diff --git a/old b/new" line.
+var gitHeaderRegex = regexp.MustCompile(`^diff --git a/(\S+) b/(\S+)`)
+
+// DiffHeader holds the file-level information of a single file's diff, from
+// its "---"/"+++" lines and git's extended header lines.
+type DiffHeader struct {
+	OldPath string // Empty if the file is created
+	NewPath string // Empty if the file is deleted
+	NewFile bool
+	Deleted bool
+	Renamed bool        // OldPath is renamed to NewPath
+	OldMode os.FileMode // Permission bits from "old mode" or "deleted file mode"
+	NewMode os.FileMode // Permission bits from "new mode" or "new file mode"
+	Hunks   bool        // Whether the diff has any "@@" hunk
+}
+
+// ParseDiffHeader parses the header of a single file's diff. Paths have their
+// "a/" and "b/" prefixes removed.
+func ParseDiffHeader(content string) DiffHeader {
+	var h DiffHeader
+	for _, line := range strings.Split(content, "\n") {
+		switch {
+		case strings.HasPrefix(line, "@@"):
+			h.Hunks = true
+		case h.Hunks:
+			// Hunk content, not header lines.
+		case strings.HasPrefix(line, "diff --git "):
+			if m := gitHeaderRegex.FindStringSubmatch(line); m != nil {
+				h.OldPath, h.NewPath = m[1], m[2]
+			}
+		case strings.HasPrefix(line, "new file mode "):
+			h.NewFile = true
+			h.NewMode = parseMode(strings.TrimPrefix(line, "new file mode "))
+		case strings.HasPrefix(line, "deleted file mode "):
+			h.Deleted = true
+			h.OldMode = parseMode(strings.TrimPrefix(line, "deleted file mode "))
+		case strings.HasPrefix(line, "old mode "):
+			h.OldMode = parseMode(strings.TrimPrefix(line, "old mode "))
+		case strings.HasPrefix(line, "new mode "):
+			h.NewMode = parseMode(strings.TrimPrefix(line, "new mode "))
+		case strings.HasPrefix(line, "rename from "):
+			h.Renamed = true
+			h.OldPath = strings.TrimSpace(strings.TrimPrefix(line, "rename from "))
+		case strings.HasPrefix(line, "rename to "):
+			h.Renamed = true
+			h.NewPath = strings.TrimSpace(strings.TrimPrefix(line, "rename to "))
+		case strings.HasPrefix(line, "--- "):
+			if path := diffHeaderPath(line[4:], "a/"); path == devNull {
+				h.NewFile = true
+				h.OldPath = ""
+			} else if !h.Renamed {
+				h.OldPath = path
+			}
+		case strings.HasPrefix(line, "+++ "):
+			if path := diffHeaderPath(line[4:], "b/"); path == devNull {
+				h.Deleted = true
+				h.NewPath = ""
+			} else if !h.Renamed {
+				h.NewPath = path
+			}
+		}
+	}
+	if h.NewFile {
+		h.OldPath = ""
+	}
+	if h.Deleted {
+		h.NewPath = ""
+	}
+	return h
+}
+
+// Path returns the path the diff applies to: the new path, or the old one
+// for a deleted file.
+func (h DiffHeader) Path() string {
+	if h.NewPath != "" {
+		return h.NewPath
+	}
+	return h.OldPath
+}
+
+// ModeChanged reports whether the diff changes the permission bits of an
+// existing file, or creates a file with non-default ones.
+func (h DiffHeader) ModeChanged() bool {
+	if h.NewMode == 0 || h.Deleted {
+		return false
+	}
+	if h.NewFile {
+		return h.NewMode != 0644
+	}
+	return h.NewMode != h.OldMode
+}
+
+// NewFileContent returns the lines added by the hunks of a diff that creates
+// a file.
+func NewFileContent(content string) []string {
+	lines := []string{}
+	inHunk := false
+	for _, line := range strings.Split(content, "\n") {
+		switch {
+		case strings.HasPrefix(line, "@@"):
+			inHunk = true
+		case inHunk && strings.HasPrefix(line, "+"):
+			lines = append(lines, line[1:])
+		}
+	}
+	return lines
+}
+
+// diffHeaderPath extracts the path of a "---" or "+++" line, without the
+// given "a/" or "b/" prefix and any trailing timestamp.
+func diffHeaderPath(rest, prefix string) string {
+	path := strings.TrimSpace(rest)
+	if i := strings.IndexByte(path, '\t'); i >= 0 {
+		path = path[:i]
+	}
+	if fields := strings.Fields(path); len(fields) > 0 {
+		path = fields[0]
+	}
+	return strings.TrimPrefix(path, prefix)
+}
+
+// parseMode parses a git file mode, e.g., "100755", into permission bits.
+func parseMode(s string) os.FileMode {
+	mode, err := strconv.ParseUint(strings.TrimSpace(s), 8, 32)
+	if err != nil {
+		return 0
+	}
+	return os.FileMode(mode).Perm()
+}
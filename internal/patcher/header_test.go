@@ -0,0 +1,100 @@
+package patcher
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestParseDiffHeader(t *testing.T) {
+	tests := []struct {
+		name        string
+		diff        string
+		want        DiffHeader
+		path        string
+		modeChanged bool
+	}{
+		{
+			name: "unified diff",
+			diff: "--- a/main.go\t2024-01-01 00:00:00\n+++ b/main.go\n@@ -1 +1 @@\n-a\n+b",
+			want: DiffHeader{OldPath: "main.go", NewPath: "main.go", Hunks: true},
+			path: "main.go",
+		},
+		{
+			name: "new file",
+			diff: "diff --git a/new.go b/new.go\nnew file mode 100644\nindex 0000000..e69de29\n--- /dev/null\n+++ b/new.go\n@@ -0,0 +1 @@\n+package new",
+			want: DiffHeader{NewPath: "new.go", NewFile: true, NewMode: 0o644, Hunks: true},
+			path: "new.go",
+		},
+		{
+			name: "new file from /dev/null alone",
+			diff: "--- /dev/null\n+++ b/new.go\n@@ -0,0 +1 @@\n+package new",
+			want: DiffHeader{NewPath: "new.go", NewFile: true, Hunks: true},
+			path: "new.go",
+		},
+		{
+			name:        "new executable file",
+			diff:        "diff --git a/run.sh b/run.sh\nnew file mode 100755\n--- /dev/null\n+++ b/run.sh\n@@ -0,0 +1 @@\n+echo",
+			want:        DiffHeader{NewPath: "run.sh", NewFile: true, NewMode: 0o755, Hunks: true},
+			path:        "run.sh",
+			modeChanged: true,
+		},
+		{
+			name: "deleted file",
+			diff: "diff --git a/old.go b/old.go\ndeleted file mode 100644\n--- a/old.go\n+++ /dev/null\n@@ -1 +0,0 @@\n-package old",
+			want: DiffHeader{OldPath: "old.go", Deleted: true, OldMode: 0o644, Hunks: true},
+			path: "old.go",
+		},
+		{
+			name: "pure rename",
+			diff: "diff --git a/a.go b/b.go\nsimilarity index 100%\nrename from a.go\nrename to b.go",
+			want: DiffHeader{OldPath: "a.go", NewPath: "b.go", Renamed: true},
+			path: "b.go",
+		},
+		{
+			name: "rename with hunks",
+			diff: "diff --git a/a.go b/b.go\nsimilarity index 90%\nrename from a.go\nrename to b.go\n--- a/a.go\n+++ b/b.go\n@@ -1 +1 @@\n-a\n+b",
+			want: DiffHeader{OldPath: "a.go", NewPath: "b.go", Renamed: true, Hunks: true},
+			path: "b.go",
+		},
+		{
+			name:        "mode change",
+			diff:        "diff --git a/run.sh b/run.sh\nold mode 100644\nnew mode 100755",
+			want:        DiffHeader{OldPath: "run.sh", NewPath: "run.sh", OldMode: 0o644, NewMode: 0o755},
+			path:        "run.sh",
+			modeChanged: true,
+		},
+		{
+			name: "header lines in hunks",
+			diff: "--- a/notes.txt\n+++ b/notes.txt\n@@ -1 +1 @@\n-rename from x\n+++ b/other.txt",
+			want: DiffHeader{OldPath: "notes.txt", NewPath: "notes.txt", Hunks: true},
+			path: "notes.txt",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := ParseDiffHeader(tt.diff)
+			if got != tt.want {
+				t.Errorf("ParseDiffHeader() = %+v, want %+v", got, tt.want)
+			}
+			if path := got.Path(); path != tt.path {
+				t.Errorf("Path() = %q, want %q", path, tt.path)
+			}
+			if changed := got.ModeChanged(); changed != tt.modeChanged {
+				t.Errorf("ModeChanged() = %v, want %v", changed, tt.modeChanged)
+			}
+		})
+	}
+}
+
+func TestNewFileContent(t *testing.T) {
+	diff := "diff --git a/new.go b/new.go\nnew file mode 100644\n--- /dev/null\n+++ b/new.go\n" +
+		"@@ -0,0 +1,3 @@\n+package new\n+\n+func F() {}\n\\ No newline at end of file"
+	want := []string{"package new", "", "func F() {}"}
+	if got := NewFileContent(diff); !slices.Equal(got, want) {
+		t.Errorf("NewFileContent() = %q, want %q", got, want)
+	}
+	if got := NewFileContent("--- /dev/null\n+++ b/empty.txt\n"); got == nil || len(got) != 0 {
+		t.Errorf("NewFileContent() of an empty file = %#v, want no lines", got)
+	}
+}
@@ -1,38 +1,65 @@
 package patcher
 
 import (
-	"bytes"
+	"errors"
 	"fmt"
-	"os"
-	"os/exec"
 	"path/filepath"
-	"regexp"
+	"slices"
 	"strings"
 
 	"github.com/sokinpui/itf.go/internal/fs"
 	"github.com/sokinpui/itf.go/model"
 )
 
-// filePathRegex extracts the file path from a '+++ b/...' line.
-var filePathRegex = regexp.MustCompile(`(?m)^\+\+\+ b/(?P<path>.*?)(\s|$)`)
-
-// ExtractPathFromDiff finds the file path in a raw diff string.
+// ExtractPathFromDiff finds the file path in a raw diff string. For a
+// deleted file, this is the path of the file being deleted.
 func ExtractPathFromDiff(content string) string {
-	match := filePathRegex.FindStringSubmatch(content)
-	if len(match) > 1 {
-		return strings.TrimSpace(match[1])
+	return ParseDiffHeader(content).Path()
+}
+
+// SplitDiff splits a diff with patches for several files, such as the output
+// of `git diff`, into one diff per file. A new part starts at each
+// "diff --git" line, and at each "---"/"+++" header pair that follows the
+// header of the previous part. Lines before the first header are kept with
+// the first part.
+func SplitDiff(content string) []string {
+	lines := strings.Split(content, "\n")
+	var parts []string
+	var current []string
+	hasGitHeader := false  // Whether the current part has a "diff --git" line.
+	hasFileHeader := false // Whether the current part has a "+++" line.
+
+	for i, line := range lines {
+		isGitHeader := strings.HasPrefix(line, "diff --git ")
+		isFileHeader := strings.HasPrefix(line, "--- ") && i+1 < len(lines) && strings.HasPrefix(lines[i+1], "+++ ")
+		// A git header may have no "+++" line at all, e.g., for a pure rename.
+		if (isGitHeader && (hasGitHeader || hasFileHeader)) || (isFileHeader && hasFileHeader) {
+			parts = append(parts, strings.Join(current, "\n"))
+			current = nil
+			hasGitHeader, hasFileHeader = false, false
+		}
+		if isGitHeader {
+			hasGitHeader = true
+		}
+		if strings.HasPrefix(line, "+++ ") {
+			hasFileHeader = true
+		}
+		current = append(current, line)
+	}
+	if len(current) > 0 {
+		parts = append(parts, strings.Join(current, "\n"))
 	}
-	return ""
+	return parts
 }
 
 // GeneratePatchedContents corrects and applies diffs to produce final file contents.
-func GeneratePatchedContents(diffs []model.DiffBlock, resolver *fs.PathResolver, extensions []string) ([]model.FileChange, []string, error) {
+func GeneratePatchedContents(diffs []model.DiffBlock, resolver *fs.PathResolver, extensions []string, opts Options) ([]model.FileChange, []model.Failure, error) {
 	if len(diffs) == 0 {
 		return nil, nil, nil
 	}
 
 	var changes []model.FileChange
-	var failedPaths []string
+	var failures []model.Failure
 	for _, diff := range diffs {
 		fullPath := resolver.Resolve(diff.FilePath)
 		if len(extensions) > 0 {
@@ -49,68 +76,138 @@ func GeneratePatchedContents(diffs []model.DiffBlock, resolver *fs.PathResolver,
 			}
 		}
 
-		patchedContent, err := CorrectDiff(diff, resolver, extensions)
+		sourceLines := readSourceLines(diff.FilePath, resolver)
+		c, err := correctDiffHunks(sourceLines, diff.RawContent, diff.FilePath, opts)
 		if err != nil {
-			failedPaths = append(failedPaths, fullPath)
+			failures = append(failures, BlockFailures(fullPath, "diff", diff.RawContent, err)...)
 			continue
 		}
+		for i := range c.fuzzy {
+			c.fuzzy[i].Path = fullPath
+		}
 
-		appliedContent, err := applyPatch(diff.FilePath, patchedContent, resolver)
+		appliedContent, results, err := ApplyHunks(sourceLines, c.patch)
+		rejected := c.rejected
 		if err != nil {
-			failedPaths = append(failedPaths, fullPath)
-			continue
+			var patchErr *PatchError
+			if !errors.As(err, &patchErr) {
+				failures = append(failures, BlockFailures(fullPath, "diff", diff.RawContent, err)...)
+				continue
+			}
+			// Report hunks by their index in the original diff.
+			for _, r := range results {
+				if r.Status == HunkRejected {
+					if r.Index < len(c.hunks) {
+						r.Index = c.hunks[r.Index]
+					}
+					rejected = append(rejected, r)
+				}
+			}
+			if !opts.Partial {
+				failures = append(failures, BlockFailures(fullPath, "diff", diff.RawContent, &PatchError{Results: rejected})...)
+				continue
+			}
 		}
 
-		changes = append(changes, model.FileChange{
+		change := model.FileChange{
 			Path:     fullPath,
 			Content:  appliedContent,
 			Source:   "diff",
 			RawBlock: fmt.Sprintf("```diff\n%s\n```", diff.RawContent),
-		})
+			Fuzzy:    c.fuzzy,
+			Offsets:  c.offsets(results, fullPath),
+		}
+		if len(rejected) > 0 {
+			failures = append(failures, BlockFailures(fullPath, "diff", diff.RawContent, &PatchError{Results: rejected})...)
+			if len(rejected) == c.total {
+				continue
+			}
+			change.Partial = &model.PartialPatch{
+				Path:    fullPath,
+				Applied: c.total - len(rejected),
+				Total:   c.total,
+				Rejects: rejectsDiff(diff, rejected),
+			}
+		}
+		changes = append(changes, change)
 	}
-	return changes, failedPaths, nil
+	return changes, failures, nil
 }
 
-// CorrectDiff prepares a valid patch from a raw diff block.
-func CorrectDiff(diff model.DiffBlock, resolver *fs.PathResolver, extensions []string) (string, error) {
-	sourcePath := resolver.ResolveExisting(diff.FilePath)
-	var sourceLines []string
-	if sourcePath != "" {
-		content, err := os.ReadFile(sourcePath)
-		if err == nil {
-			sourceLines = strings.Split(string(content), "\n")
+// rejectsDiff returns the rejected hunks of a diff as a diff of their own,
+// in the style of a .rej file.
+func rejectsDiff(diff model.DiffBlock, rejected []HunkResult) string {
+	slices.SortFunc(rejected, func(a, b HunkResult) int { return a.Index - b.Index })
+	hunks := SplitHunks(diff.RawContent)
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "--- a/%s\n+++ b/%s\n", diff.FilePath, diff.FilePath)
+	for _, r := range rejected {
+		if r.Index < len(hunks) {
+			b.WriteString(hunks[r.Index] + "\n")
 		}
 	}
-
-	return correctDiffHunks(sourceLines, diff.RawContent, diff.FilePath)
+	return b.String()
 }
 
-func applyPatch(filePath, patchContent string, resolver *fs.PathResolver) ([]string, error) {
-	sourcePath := resolver.ResolveExisting(filePath)
-	if sourcePath == "" {
-		// Create a temporary empty file for patch to apply against (for new files).
-		tmpFile, err := os.CreateTemp("", "itf-source-")
-		if err != nil {
-			return nil, fmt.Errorf("failed to create temp file: %w", err)
+// Failures converts an error from patching the file at path into failures:
+// one for each rejected hunk of a *PatchError, one for an *EditError, and a
+// single one otherwise.
+func Failures(path string, err error) []model.Failure {
+	var patchErr *PatchError
+	if errors.As(err, &patchErr) {
+		var failures []model.Failure
+		for _, r := range patchErr.Results {
+			if r.Status == HunkRejected {
+				failures = append(failures, model.Failure{
+					Path:  path,
+					Stage: model.StagePatch,
+					Hunk:  r.Index + 1,
+					Err:   fmt.Errorf("hunk #%d rejected: %s", r.Index+1, r.Reason),
+				})
+			}
+		}
+		if len(failures) > 0 {
+			return failures
 		}
-		sourcePath = tmpFile.Name()
-		defer os.Remove(sourcePath)
-		tmpFile.Close()
 	}
 
-	devNull := "/dev/null"
-	cmd := exec.Command("patch", "-s", "-p1", "--no-backup-if-mismatch", "-r", devNull, "-o", "-", sourcePath)
-	cmd.Stdin = strings.NewReader(patchContent)
-
-	var out bytes.Buffer
-	var stderr bytes.Buffer
-	cmd.Stdout = &out
-	cmd.Stderr = &stderr
+	failure := model.Failure{Path: path, Stage: model.StagePatch, Err: err}
+	var editErr *EditError
+	if errors.As(err, &editErr) {
+		failure.Hunk = editErr.Index + 1
+	}
+	return []model.Failure{failure}
+}
 
-	if err := cmd.Run(); err != nil {
-		return nil, fmt.Errorf("`patch` command failed: %s", stderr.String())
+// BlockFailures is like Failures, for a change of the given source that
+// came from block, so that the failed hunks can be found in it.
+func BlockFailures(path, source, block string, err error) []model.Failure {
+	failures := Failures(path, err)
+	for i := range failures {
+		failures[i].Source = source
+		failures[i].Block = block
 	}
+	return failures
+}
+
+// CorrectDiff prepares a valid patch from a raw diff block. It also returns
+// the hunks that were placed by fuzzy matching.
+func CorrectDiff(diff model.DiffBlock, resolver *fs.PathResolver, extensions []string, opts Options) (string, []model.FuzzyMatch, error) {
+	c, err := correctDiffHunks(readSourceLines(diff.FilePath, resolver), diff.RawContent, diff.FilePath, opts)
+	return c.patch, c.fuzzy, err
+}
 
-	// Read output and split into lines, trimming a potential trailing newline from patch.
-	return strings.Split(strings.TrimSuffix(out.String(), "\n"), "\n"), nil
+// readSourceLines reads the current lines of a file. It returns nil if the
+// file does not exist or cannot be read.
+func readSourceLines(filePath string, resolver *fs.PathResolver) []string {
+	sourcePath := resolver.ResolveExisting(filePath)
+	if sourcePath == "" {
+		return nil
+	}
+	lines, err := fs.ReadLines(sourcePath)
+	if err != nil {
+		return nil
+	}
+	return lines
 }
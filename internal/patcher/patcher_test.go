@@ -0,0 +1,53 @@
+package patcher
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestSplitDiff(t *testing.T) {
+	tests := []struct {
+		name string
+		diff string
+		want []string
+	}{
+		{
+			name: "single file",
+			diff: "--- a/a.go\n+++ b/a.go\n@@ -1 +1 @@\n-a\n+b",
+			want: []string{"--- a/a.go\n+++ b/a.go\n@@ -1 +1 @@\n-a\n+b"},
+		},
+		{
+			name: "unified diffs",
+			diff: "intro\n--- a/a.go\n+++ b/a.go\n@@ -1 +1 @@\n-a\n+b\n--- a/b.go\n+++ b/b.go\n@@ -1 +1 @@\n-c\n+d",
+			want: []string{
+				"intro\n--- a/a.go\n+++ b/a.go\n@@ -1 +1 @@\n-a\n+b",
+				"--- a/b.go\n+++ b/b.go\n@@ -1 +1 @@\n-c\n+d",
+			},
+		},
+		{
+			name: "git diffs",
+			diff: "diff --git a/a.go b/a.go\nindex 1..2 100644\n--- a/a.go\n+++ b/a.go\n@@ -1 +1 @@\n-a\n+b\n" +
+				"diff --git a/run.sh b/run.sh\nold mode 100644\nnew mode 100755\n" +
+				"diff --git a/c.go b/d.go\nrename from c.go\nrename to d.go",
+			want: []string{
+				"diff --git a/a.go b/a.go\nindex 1..2 100644\n--- a/a.go\n+++ b/a.go\n@@ -1 +1 @@\n-a\n+b",
+				"diff --git a/run.sh b/run.sh\nold mode 100644\nnew mode 100755",
+				"diff --git a/c.go b/d.go\nrename from c.go\nrename to d.go",
+			},
+		},
+		{
+			name: "removed line starting with dashes",
+			diff: "--- a/a.sql\n+++ b/a.sql\n@@ -1,2 +1 @@\n--- comment\n-x",
+			want: []string{"--- a/a.sql\n+++ b/a.sql\n@@ -1,2 +1 @@\n--- comment\n-x"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := SplitDiff(tt.diff); !slices.Equal(got, tt.want) {
+				t.Errorf("SplitDiff() =\n%s\nwant\n%s", strings.Join(got, "\n====\n"), strings.Join(tt.want, "\n====\n"))
+			}
+		})
+	}
+}
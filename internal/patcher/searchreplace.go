@@ -0,0 +1,124 @@
+package patcher
+
+import (
+	"fmt"
+	"strings"
+)
+
+// SearchReplace is a single SEARCH/REPLACE edit: the Search lines are
+// replaced by the Replace lines.
+type SearchReplace struct {
+	Search  []string
+	Replace []string
+}
+
+// EditError reports a SEARCH/REPLACE edit that could not be applied.
+type EditError struct {
+	Index  int // Zero-based index of the edit within its block.
+	Reason string
+}
+
+func (e *EditError) Error() string {
+	return fmt.Sprintf("edit #%d: %s", e.Index+1, e.Reason)
+}
+
+// ApplySearchReplace applies SEARCH/REPLACE edits to the given source lines,
+// in order, each one to the result of the previous ones. The search text is
+// located with the same whitespace-tolerant matching used to correct diffs;
+// if it matches more than once, an exact match is preferred. An edit with an
+// empty search text appends its replacement to the end of the file.
+// It returns an *EditError for every edit that could not be applied.
+func ApplySearchReplace(source []string, edits []SearchReplace) ([]string, []error) {
+	patched := source
+	var errs []error
+
+	for i, edit := range edits {
+		search, replace := trimBlankEdges(edit.Search, edit.Replace)
+		if len(search) == 0 {
+			patched = append(append([]string{}, patched...), replace...)
+			continue
+		}
+
+		start, end, reason := locateSearch(patched, search)
+		if reason != "" {
+			errs = append(errs, &EditError{Index: i, Reason: reason})
+			continue
+		}
+
+		next := make([]string, 0, len(patched)-(end-start)+len(replace))
+		next = append(next, patched[:start]...)
+		next = append(next, replace...)
+		next = append(next, patched[end:]...)
+		patched = next
+	}
+	return patched, errs
+}
+
+// locateSearch returns the region of source matching search as a half-open
+// range of indexes, or a reason why it could not be located.
+func locateSearch(source, search []string) (int, int, string) {
+	matches := matchAllBlocks(source, search, 1)
+	switch len(matches) {
+	case 0:
+		return 0, 0, "search text not found"
+	case 1:
+		return matches[0][0] - 1, matches[0][1], ""
+	}
+
+	// Several normalized matches; accept the search text only if it occurs
+	// exactly once verbatim.
+	var exact []int
+	for pos := 0; pos+len(search) <= len(source); pos++ {
+		if blockEqual(source[pos:pos+len(search)], search) {
+			exact = append(exact, pos)
+		}
+	}
+	if len(exact) == 1 {
+		return exact[0], exact[0] + len(search), ""
+	}
+	return 0, 0, fmt.Sprintf("search text is ambiguous, it matches %d locations", len(matches))
+}
+
+// matchAllBlocks returns the 1-based start and end lines of every match of
+// block in source at or after startLine, as found by matchBlock.
+func matchAllBlocks(source, block []string, startLine int) [][2]int {
+	// matchBlock skips blank source lines, so blank block lines are dropped.
+	var target []string
+	for _, line := range block {
+		if strings.TrimSpace(line) != "" {
+			target = append(target, line)
+		}
+	}
+
+	var matches [][2]int
+	for startLine = max(startLine, 1); startLine <= len(source); {
+		start, end := matchBlock(source, target, startLine)
+		// matchBlock searches from the top again once startLine is past the
+		// last non-blank line.
+		if start == -1 || start < startLine {
+			break
+		}
+		matches = append(matches, [2]int{start, end})
+		startLine = start + 1
+	}
+	return matches
+}
+
+// trimBlankEdges removes leading and trailing blank lines from search, which
+// matchBlock would not include in a match, along with the corresponding
+// blank lines of replace.
+func trimBlankEdges(search, replace []string) ([]string, []string) {
+	for len(search) > 0 && strings.TrimSpace(search[0]) == "" {
+		search = search[1:]
+		if len(replace) > 0 && strings.TrimSpace(replace[0]) == "" {
+			replace = replace[1:]
+		}
+	}
+	for len(search) > 0 && strings.TrimSpace(search[len(search)-1]) == "" {
+		search = search[:len(search)-1]
+		if len(replace) > 0 && strings.TrimSpace(replace[len(replace)-1]) == "" {
+			replace = replace[:len(replace)-1]
+		}
+	}
+	return search, replace
+}
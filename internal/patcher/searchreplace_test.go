@@ -0,0 +1,114 @@
+package patcher
+
+import (
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestApplySearchReplace(t *testing.T) {
+	tests := []struct {
+		name   string
+		source string
+		edits  []SearchReplace
+		want   string
+		errs   []string
+	}{
+		{
+			name:   "exact match",
+			source: "a\nb\nc",
+			edits:  []SearchReplace{{Search: []string{"b"}, Replace: []string{"B"}}},
+			want:   "a\nB\nc",
+		},
+		{
+			name:   "whitespace-normalized match",
+			source: "func f() int {\n\treturn 1\n}",
+			edits: []SearchReplace{{
+				Search:  []string{"func f() int {", "    return 1", "}"},
+				Replace: []string{"func f() int {", "\treturn 2", "}"},
+			}},
+			want: "func f() int {\n\treturn 2\n}",
+		},
+		{
+			name:   "ambiguous match with a single verbatim one",
+			source: "\tx := 1\nx := 1\n  x := 1",
+			edits:  []SearchReplace{{Search: []string{"x := 1"}, Replace: []string{"x := 2"}}},
+			want:   "\tx := 1\nx := 2\n  x := 1",
+		},
+		{
+			name:   "ambiguous match without a verbatim one",
+			source: "\tx := 1\n  x := 1",
+			edits:  []SearchReplace{{Search: []string{"x := 1"}, Replace: []string{"x := 2"}}},
+			want:   "\tx := 1\n  x := 1",
+			errs:   []string{"edit #1: search text is ambiguous, it matches 2 locations"},
+		},
+		{
+			name:   "ambiguous match with several verbatim ones",
+			source: "x := 1\nx := 1",
+			edits:  []SearchReplace{{Search: []string{"x := 1"}, Replace: []string{"x := 2"}}},
+			want:   "x := 1\nx := 1",
+			errs:   []string{"edit #1: search text is ambiguous, it matches 2 locations"},
+		},
+		{
+			name:   "not found",
+			source: "a\nb",
+			edits:  []SearchReplace{{Search: []string{"z"}, Replace: []string{"Z"}}},
+			want:   "a\nb",
+			errs:   []string{"edit #1: search text not found"},
+		},
+		{
+			name:   "empty search appends",
+			source: "a\nb",
+			edits:  []SearchReplace{{Replace: []string{"c", "d"}}},
+			want:   "a\nb\nc\nd",
+		},
+		{
+			name:   "blank edges trimmed",
+			source: "a\nb\nc",
+			edits:  []SearchReplace{{Search: []string{"", "b", ""}, Replace: []string{"", "B", ""}}},
+			want:   "a\nB\nc",
+		},
+		{
+			name:   "edits applied in order",
+			source: "a\nb\nc",
+			edits: []SearchReplace{
+				{Search: []string{"a"}, Replace: []string{"A"}},
+				{Search: []string{"A", "b"}, Replace: []string{"AB"}},
+				{Replace: []string{"d"}},
+			},
+			want: "AB\nc\nd",
+		},
+		{
+			name:   "failed edit among others",
+			source: "a\nb\nc",
+			edits: []SearchReplace{
+				{Search: []string{"a"}, Replace: []string{"A"}},
+				{Search: []string{"a"}, Replace: []string{"again"}},
+				{Search: []string{"c"}, Replace: []string{"C"}},
+			},
+			want: "A\nb\nC",
+			errs: []string{"edit #2: search text not found"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, errs := ApplySearchReplace(strings.Split(tt.source, "\n"), tt.edits)
+			if joined := strings.Join(got, "\n"); joined != tt.want {
+				t.Errorf("ApplySearchReplace() = %q, want %q", joined, tt.want)
+			}
+			var messages []string
+			for _, err := range errs {
+				var editErr *EditError
+				if !errors.As(err, &editErr) {
+					t.Errorf("error %v is not an *EditError", err)
+				}
+				messages = append(messages, err.Error())
+			}
+			if !slices.Equal(messages, tt.errs) {
+				t.Errorf("ApplySearchReplace() errors = %q, want %q", messages, tt.errs)
+			}
+		})
+	}
+}
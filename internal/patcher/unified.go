@@ -0,0 +1,266 @@
+package patcher
+
+import (
+	"fmt"
+	"strings"
+)
+
+// contextLines is the number of unchanged lines shown around each change.
+const contextLines = 3
+
+// UnifiedDiff returns a unified diff that turns oldLines into newLines, or an
+// empty string if they are equal. oldName and newName are used verbatim in
+// the file headers, e.g., "a/main.go" or "/dev/null".
+func UnifiedDiff(oldName, newName string, oldLines, newLines []string) string {
+	hunks := unifiedHunks(oldLines, newLines)
+	if len(hunks) == 0 {
+		return ""
+	}
+
+	var b strings.Builder
+	b.WriteString(fmt.Sprintf("--- %s\n", oldName))
+	b.WriteString(fmt.Sprintf("+++ %s\n", newName))
+	for _, h := range hunks {
+		b.WriteString(h)
+	}
+	return b.String()
+}
+
+// DiffHunks returns the hunks of the unified diff that turns oldLines into
+// newLines. Each hunk starts with its "@@" header and ends with a newline.
+func DiffHunks(oldLines, newLines []string) []string {
+	return unifiedHunks(oldLines, newLines)
+}
+
+// editKind is the kind of a single line in an edit script.
+type editKind int
+
+const (
+	editEqual editKind = iota
+	editDelete
+	editInsert
+)
+
+// edit is one line of an edit script. oldPos and newPos are the positions in
+// the old and new lines at which the edit happens.
+type edit struct {
+	kind           editKind
+	oldPos, newPos int
+}
+
+// unifiedHunks groups the differences between a and b into unified diff
+// hunks, each including its header and a trailing newline.
+func unifiedHunks(a, b []string) []string {
+	edits := diffLines(a, b)
+
+	var hunks []string
+	for i := 0; i < len(edits); {
+		if edits[i].kind == editEqual {
+			i++
+			continue
+		}
+
+		// Extend the hunk while the next change is close enough for the
+		// context of both to overlap.
+		start := max(i-contextLines, 0)
+		end := i
+		for j := i; j < len(edits); j++ {
+			if edits[j].kind != editEqual {
+				end = j + 1
+			} else if j-end >= 2*contextLines {
+				break
+			}
+		}
+		end = min(end+contextLines, len(edits))
+
+		hunks = append(hunks, formatHunk(a, b, edits[start:end]))
+		i = end
+	}
+	return hunks
+}
+
+func formatHunk(a, b []string, edits []edit) string {
+	var body strings.Builder
+	oldCount, newCount := 0, 0
+	for _, e := range edits {
+		switch e.kind {
+		case editEqual:
+			body.WriteString(" " + a[e.oldPos] + "\n")
+			oldCount++
+			newCount++
+		case editDelete:
+			body.WriteString("-" + a[e.oldPos] + "\n")
+			oldCount++
+		case editInsert:
+			body.WriteString("+" + b[e.newPos] + "\n")
+			newCount++
+		}
+	}
+
+	// An empty side refers to the line before the hunk, as in GNU diff.
+	oldStart, newStart := edits[0].oldPos+1, edits[0].newPos+1
+	if oldCount == 0 {
+		oldStart--
+	}
+	if newCount == 0 {
+		newStart--
+	}
+	return buildHunkHeader(oldStart, oldCount, newStart, newCount) + body.String()
+}
+
+// diffLines computes a minimal edit script turning a into b.
+func diffLines(a, b []string) []edit {
+	d := &lineDiffer{
+		a:        a,
+		b:        b,
+		deleted:  make([]bool, len(a)),
+		inserted: make([]bool, len(b)),
+	}
+	d.compare(0, len(a), 0, len(b))
+
+	var edits []edit
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		switch {
+		case i < len(a) && d.deleted[i]:
+			edits = append(edits, edit{editDelete, i, j})
+			i++
+		case j < len(b) && d.inserted[j]:
+			edits = append(edits, edit{editInsert, i, j})
+			j++
+		default:
+			edits = append(edits, edit{editEqual, i, j})
+			i++
+			j++
+		}
+	}
+	return edits
+}
+
+// lineDiffer implements the linear-space variant of Myers' diff algorithm,
+// marking the lines of a that are deleted and the lines of b that are inserted.
+type lineDiffer struct {
+	a, b              []string
+	deleted, inserted []bool
+}
+
+func (d *lineDiffer) compare(aLo, aHi, bLo, bHi int) {
+	for aLo < aHi && bLo < bHi && d.a[aLo] == d.b[bLo] {
+		aLo++
+		bLo++
+	}
+	for aLo < aHi && bLo < bHi && d.a[aHi-1] == d.b[bHi-1] {
+		aHi--
+		bHi--
+	}
+
+	if aLo == aHi || bLo == bHi || (aHi-aLo)+(bHi-bLo) <= 2 {
+		d.markChanged(aLo, aHi, bLo, bHi)
+		return
+	}
+
+	x, y, ok := d.bisect(aLo, aHi, bLo, bHi)
+	if !ok {
+		d.markChanged(aLo, aHi, bLo, bHi)
+		return
+	}
+	d.compare(aLo, x, bLo, y)
+	d.compare(x, aHi, y, bHi)
+}
+
+func (d *lineDiffer) markChanged(aLo, aHi, bLo, bHi int) {
+	for i := aLo; i < aHi; i++ {
+		d.deleted[i] = true
+	}
+	for j := bLo; j < bHi; j++ {
+		d.inserted[j] = true
+	}
+}
+
+// bisect finds the middle snake of the shortest edit path between
+// a[aLo:aHi] and b[bLo:bHi] and returns the point at which to split.
+func (d *lineDiffer) bisect(aLo, aHi, bLo, bHi int) (int, int, bool) {
+	n, m := aHi-aLo, bHi-bLo
+	maxD := (n + m + 1) / 2
+	vOffset := maxD
+	vLength := 2 * maxD
+	v1 := make([]int, vLength)
+	v2 := make([]int, vLength)
+	for i := range v1 {
+		v1[i] = -1
+		v2[i] = -1
+	}
+	v1[vOffset+1] = 0
+	v2[vOffset+1] = 0
+
+	delta := n - m
+	front := delta%2 != 0
+	k1start, k1end, k2start, k2end := 0, 0, 0, 0
+
+	for step := 0; step < maxD; step++ {
+		// Walk the front path one step.
+		for k1 := -step + k1start; k1 <= step-k1end; k1 += 2 {
+			k1Offset := vOffset + k1
+			var x1 int
+			if k1 == -step || (k1 != step && v1[k1Offset-1] < v1[k1Offset+1]) {
+				x1 = v1[k1Offset+1]
+			} else {
+				x1 = v1[k1Offset-1] + 1
+			}
+			y1 := x1 - k1
+			for x1 < n && y1 < m && d.a[aLo+x1] == d.b[bLo+y1] {
+				x1++
+				y1++
+			}
+			v1[k1Offset] = x1
+
+			switch {
+			case x1 > n:
+				k1end += 2
+			case y1 > m:
+				k1start += 2
+			case front:
+				k2Offset := vOffset + delta - k1
+				if k2Offset >= 0 && k2Offset < vLength && v2[k2Offset] != -1 {
+					if x1 >= n-v2[k2Offset] {
+						return aLo + x1, bLo + y1, true
+					}
+				}
+			}
+		}
+
+		// Walk the reverse path one step.
+		for k2 := -step + k2start; k2 <= step-k2end; k2 += 2 {
+			k2Offset := vOffset + k2
+			var x2 int
+			if k2 == -step || (k2 != step && v2[k2Offset-1] < v2[k2Offset+1]) {
+				x2 = v2[k2Offset+1]
+			} else {
+				x2 = v2[k2Offset-1] + 1
+			}
+			y2 := x2 - k2
+			for x2 < n && y2 < m && d.a[aHi-x2-1] == d.b[bHi-y2-1] {
+				x2++
+				y2++
+			}
+			v2[k2Offset] = x2
+
+			switch {
+			case x2 > n:
+				k2end += 2
+			case y2 > m:
+				k2start += 2
+			case !front:
+				k1Offset := vOffset + delta - k2
+				if k1Offset >= 0 && k1Offset < vLength && v1[k1Offset] != -1 {
+					x1 := v1[k1Offset]
+					y1 := vOffset + x1 - k1Offset
+					if x1 >= n-x2 {
+						return aLo + x1, bLo + y1, true
+					}
+				}
+			}
+		}
+	}
+	return 0, 0, false
+}
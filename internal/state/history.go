@@ -0,0 +1,180 @@
+package state
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/sokinpui/itf.go/internal/fs"
+	"github.com/sokinpui/itf.go/model"
+)
+
+// unknownHash marks a file whose content cannot be predicted, so it is not
+// checked during verification.
+const unknownHash = "?"
+
+// Entries returns all history entries, oldest first.
+func (m *Manager) Entries() []HistoryEntry {
+	return m.state.History
+}
+
+// CurrentIndex returns the index of the most recently applied entry, or -1
+// if every entry has been undone.
+func (m *Manager) CurrentIndex() int {
+	return m.state.CurrentIndex
+}
+
+// SetCurrentIndex moves the history pointer and saves the state.
+func (m *Manager) SetCurrentIndex(index int) {
+	m.state.CurrentIndex = index
+	m.save()
+}
+
+// EntriesToUndo returns up to n entries that can be undone, most recent first.
+func (m *Manager) EntriesToUndo(n int) []HistoryEntry {
+	var entries []HistoryEntry
+	for i := m.state.CurrentIndex; i >= 0 && len(entries) < n; i-- {
+		entries = append(entries, m.state.History[i])
+	}
+	return entries
+}
+
+// EntriesToRedo returns up to n entries that can be redone, oldest first.
+func (m *Manager) EntriesToRedo(n int) []HistoryEntry {
+	var entries []HistoryEntry
+	for i := m.state.CurrentIndex + 1; i < len(m.state.History) && len(entries) < n; i++ {
+		entries = append(entries, m.state.History[i])
+	}
+	return entries
+}
+
+// VerifyUndo checks that undoing the given entries, most recent first, will
+// find every file as it was recorded. Files touched by several entries are
+// checked against the state the undo of the later entries leaves behind.
+// It returns a failure for every file that does not match.
+func (m *Manager) VerifyUndo(entries []HistoryEntry) []model.Failure {
+	expected := make(map[string]string)
+	var conflicts []model.Failure
+
+	for i, entry := range entries {
+		id := m.state.CurrentIndex - i + 1
+		for _, op := range entry.Operations {
+			location, want := op.Path, op.ContentHash
+			switch op.Action {
+			case "rename":
+				location = op.NewPath
+			case "delete":
+				location = m.trashPath(op.Path)
+			}
+
+			actual := m.expectedHash(expected, location)
+			absentOK := op.Action == "create" && actual == ""
+			if actual != unknownHash && actual != want && !absentOK {
+				conflicts = append(conflicts, conflict(op.Path, fmt.Errorf("entry #%d: changed since it was recorded", id)))
+			}
+
+			// Record the state undoing this operation leaves behind.
+			switch op.Action {
+			case "create":
+				expected[op.Path] = ""
+			case "modify":
+				expected[op.Path] = orUnknown(op.PrevHash)
+			case "rename":
+				expected[op.NewPath] = ""
+				expected[op.Path] = renamedFrom(op)
+			case "delete":
+				expected[location] = ""
+				expected[op.Path] = op.ContentHash
+			}
+		}
+	}
+	return conflicts
+}
+
+// VerifyRedo checks that redoing the given entries, oldest first, will find
+// every file as undoing it left it. It returns a failure for every file that
+// does not match.
+func (m *Manager) VerifyRedo(entries []HistoryEntry) []model.Failure {
+	expected := make(map[string]string)
+	var conflicts []model.Failure
+
+	for i, entry := range entries {
+		id := m.state.CurrentIndex + i + 2
+		for _, op := range entry.Operations {
+			want := op.ContentHash
+			switch op.Action {
+			case "create":
+				want = ""
+			case "modify":
+				want = orUnknown(op.PrevHash)
+			case "rename":
+				want = renamedFrom(op)
+			}
+
+			actual := m.expectedHash(expected, op.Path)
+			if op.Action == "rename" && m.expectedHash(expected, op.NewPath) != "" {
+				conflicts = append(conflicts, conflict(op.Path, fmt.Errorf("entry #%d: %s already exists", id, op.NewPath)))
+			} else if actual != unknownHash && want != unknownHash && actual != want {
+				conflicts = append(conflicts, conflict(op.Path, fmt.Errorf("entry #%d: changed since it was undone", id)))
+			}
+
+			// Record the state redoing this operation leaves behind.
+			switch op.Action {
+			case "create", "modify":
+				expected[op.Path] = op.ContentHash
+			case "rename":
+				expected[op.Path] = ""
+				expected[op.NewPath] = op.ContentHash
+			case "delete":
+				expected[op.Path] = ""
+			}
+		}
+	}
+	return conflicts
+}
+
+// expectedHash returns the hash a file is expected to have, either as left
+// by an earlier step of the verification or as currently on disk. A missing
+// file has an empty hash.
+func (m *Manager) expectedHash(expected map[string]string, path string) string {
+	if hash, ok := expected[path]; ok {
+		return hash
+	}
+	hash, err := fs.GetFileSHA256(path)
+	if err != nil {
+		return ""
+	}
+	return hash
+}
+
+// trashPath returns where a deleted file is kept in the trash.
+func (m *Manager) trashPath(path string) string {
+	wd, _ := os.Getwd()
+	relPath, err := filepath.Rel(wd, path)
+	if err != nil {
+		relPath = filepath.Base(path)
+	}
+	return filepath.Join(m.StateDir, TrashDir, relPath)
+}
+
+// renamedFrom returns the hash of a renamed file before the rename, which
+// differs from its ContentHash if the rename also changed its content.
+func renamedFrom(op Operation) string {
+	if op.PrevHash != "" {
+		return op.PrevHash
+	}
+	return op.ContentHash
+}
+
+// conflict returns the failure reported for a file that does not match its
+// history.
+func conflict(path string, err error) model.Failure {
+	return model.Failure{Path: path, Stage: model.StageUndo, Err: err}
+}
+
+func orUnknown(hash string) string {
+	if hash == "" {
+		return unknownHash
+	}
+	return hash
+}
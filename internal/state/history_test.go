@@ -0,0 +1,205 @@
+package state
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/sokinpui/itf.go/model"
+)
+
+func hashOf(content string) string {
+	sum := sha256.Sum256([]byte(content))
+	return hex.EncodeToString(sum[:])
+}
+
+// newTestManager returns a manager for a temporary project, which is made
+// the working directory, with the given files on disk and history.
+func newTestManager(t *testing.T, files map[string]string, history []HistoryEntry, current int) (*Manager, string) {
+	t.Helper()
+	dir := t.TempDir()
+	t.Chdir(dir)
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	stateDir := filepath.Join(dir, stateDirName)
+	for i := range history {
+		for j := range history[i].Operations {
+			op := &history[i].Operations[j]
+			op.Path = filepath.Join(dir, op.Path)
+			if op.NewPath != "" {
+				op.NewPath = filepath.Join(dir, op.NewPath)
+			}
+		}
+	}
+	return &Manager{
+		statePath: filepath.Join(stateDir, stateFileName),
+		StateDir:  stateDir,
+		state:     &State{History: history, CurrentIndex: current},
+	}, dir
+}
+
+// conflictMessages returns the paths, relative to dir, and errors of
+// failures, e.g., "a.txt: entry #1: changed since it was recorded".
+func conflictMessages(t *testing.T, dir string, failures []model.Failure) []string {
+	t.Helper()
+	var messages []string
+	for _, f := range failures {
+		if f.Stage != model.StageUndo {
+			t.Errorf("failure %v has stage %s, want %s", f, f.Stage, model.StageUndo)
+		}
+		rel, _ := filepath.Rel(dir, f.Path)
+		messages = append(messages, rel+": "+f.Err.Error())
+	}
+	return messages
+}
+
+func TestVerifyUndo(t *testing.T) {
+	trash := filepath.Join(stateDirName, TrashDir)
+	tests := []struct {
+		name    string
+		files   map[string]string
+		history []HistoryEntry
+		want    []string
+	}{
+		{
+			name:    "modified file as recorded",
+			files:   map[string]string{"a.txt": "v2"},
+			history: []HistoryEntry{{Operations: []Operation{{Path: "a.txt", Action: "modify", ContentHash: hashOf("v2"), PrevHash: hashOf("v1")}}}},
+		},
+		{
+			name:    "modified file changed by hand",
+			files:   map[string]string{"a.txt": "v3"},
+			history: []HistoryEntry{{Operations: []Operation{{Path: "a.txt", Action: "modify", ContentHash: hashOf("v2"), PrevHash: hashOf("v1")}}}},
+			want:    []string{"a.txt: entry #1: changed since it was recorded"},
+		},
+		{
+			name:    "created file already removed",
+			history: []HistoryEntry{{Operations: []Operation{{Path: "a.txt", Action: "create", ContentHash: hashOf("v1")}}}},
+		},
+		{
+			name:    "created file changed by hand",
+			files:   map[string]string{"a.txt": "v2"},
+			history: []HistoryEntry{{Operations: []Operation{{Path: "a.txt", Action: "create", ContentHash: hashOf("v1")}}}},
+			want:    []string{"a.txt: entry #1: changed since it was recorded"},
+		},
+		{
+			name:  "file changed by two entries",
+			files: map[string]string{"a.txt": "v3"},
+			history: []HistoryEntry{
+				{Operations: []Operation{{Path: "a.txt", Action: "modify", ContentHash: hashOf("v2"), PrevHash: hashOf("v1")}}},
+				{Operations: []Operation{{Path: "a.txt", Action: "modify", ContentHash: hashOf("v3"), PrevHash: hashOf("v2")}}},
+			},
+		},
+		{
+			name:  "earlier entry out of step with the later one",
+			files: map[string]string{"a.txt": "v3"},
+			history: []HistoryEntry{
+				{Operations: []Operation{{Path: "a.txt", Action: "modify", ContentHash: hashOf("other"), PrevHash: hashOf("v1")}}},
+				{Operations: []Operation{{Path: "a.txt", Action: "modify", ContentHash: hashOf("v3"), PrevHash: hashOf("v2")}}},
+			},
+			want: []string{"a.txt: entry #1: changed since it was recorded"},
+		},
+		{
+			name:  "later entry without a snapshot",
+			files: map[string]string{"a.txt": "v3"},
+			history: []HistoryEntry{
+				{Operations: []Operation{{Path: "a.txt", Action: "modify", ContentHash: hashOf("other"), PrevHash: hashOf("v1")}}},
+				{Operations: []Operation{{Path: "a.txt", Action: "modify", ContentHash: hashOf("v3")}}},
+			},
+		},
+		{
+			name:    "renamed file changed by hand",
+			files:   map[string]string{"b.txt": "v2"},
+			history: []HistoryEntry{{Operations: []Operation{{Path: "a.txt", Action: "rename", NewPath: "b.txt", ContentHash: hashOf("v1")}}}},
+			want:    []string{"a.txt: entry #1: changed since it was recorded"},
+		},
+		{
+			name:    "deleted file in the trash",
+			files:   map[string]string{filepath.Join(trash, "a.txt"): "v1"},
+			history: []HistoryEntry{{Operations: []Operation{{Path: "a.txt", Action: "delete", ContentHash: hashOf("v1")}}}},
+		},
+		{
+			name:    "deleted file missing from the trash",
+			history: []HistoryEntry{{Operations: []Operation{{Path: "a.txt", Action: "delete", ContentHash: hashOf("v1")}}}},
+			want:    []string{"a.txt: entry #1: changed since it was recorded"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, dir := newTestManager(t, tt.files, tt.history, len(tt.history)-1)
+			got := conflictMessages(t, dir, m.VerifyUndo(m.EntriesToUndo(len(tt.history))))
+			if strings.Join(got, "\n") != strings.Join(tt.want, "\n") {
+				t.Errorf("VerifyUndo() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestVerifyRedo(t *testing.T) {
+	// "{dir}" in the messages stands for the project directory.
+	tests := []struct {
+		name    string
+		files   map[string]string
+		history []HistoryEntry
+		want    []string
+	}{
+		{
+			name:    "modified file as undone",
+			files:   map[string]string{"a.txt": "v1"},
+			history: []HistoryEntry{{Operations: []Operation{{Path: "a.txt", Action: "modify", ContentHash: hashOf("v2"), PrevHash: hashOf("v1")}}}},
+		},
+		{
+			name:    "modified file changed by hand",
+			files:   map[string]string{"a.txt": "v3"},
+			history: []HistoryEntry{{Operations: []Operation{{Path: "a.txt", Action: "modify", ContentHash: hashOf("v2"), PrevHash: hashOf("v1")}}}},
+			want:    []string{"a.txt: entry #1: changed since it was undone"},
+		},
+		{
+			name:    "created file back on disk",
+			files:   map[string]string{"a.txt": "v1"},
+			history: []HistoryEntry{{Operations: []Operation{{Path: "a.txt", Action: "create", ContentHash: hashOf("v1")}}}},
+			want:    []string{"a.txt: entry #1: changed since it was undone"},
+		},
+		{
+			name:    "rename onto an existing file",
+			files:   map[string]string{"a.txt": "v1", "b.txt": "other"},
+			history: []HistoryEntry{{Operations: []Operation{{Path: "a.txt", Action: "rename", NewPath: "b.txt", ContentHash: hashOf("v1")}}}},
+			want:    []string{"a.txt: entry #1: {dir}/b.txt already exists"},
+		},
+		{
+			name: "file created and then modified",
+			history: []HistoryEntry{
+				{Operations: []Operation{{Path: "a.txt", Action: "create", ContentHash: hashOf("v1")}}},
+				{Operations: []Operation{{Path: "a.txt", Action: "modify", ContentHash: hashOf("v2"), PrevHash: hashOf("v1")}}},
+			},
+		},
+		{
+			name:    "deleted file changed by hand",
+			files:   map[string]string{"a.txt": "v2"},
+			history: []HistoryEntry{{Operations: []Operation{{Path: "a.txt", Action: "delete", ContentHash: hashOf("v1")}}}},
+			want:    []string{"a.txt: entry #1: changed since it was undone"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, dir := newTestManager(t, tt.files, tt.history, -1)
+			got := conflictMessages(t, dir, m.VerifyRedo(m.EntriesToRedo(len(tt.history))))
+			want := strings.ReplaceAll(strings.Join(tt.want, "\n"), "{dir}", dir)
+			if strings.Join(got, "\n") != want {
+				t.Errorf("VerifyRedo() = %q, want %q", got, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,86 @@
+package state
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/sokinpui/itf.go/internal/fs"
+)
+
+// ObjectsDir is the directory in the state directory that stores file
+// snapshots, keyed by the SHA256 hash of their content.
+const ObjectsDir = "objects"
+
+// StoreObject copies the content of a file into the object store and
+// returns its SHA256 hash.
+func StoreObject(stateDir, path string) (string, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(content)
+	hash := hex.EncodeToString(sum[:])
+
+	objectPath := filepath.Join(stateDir, ObjectsDir, hash)
+	if _, err := os.Stat(objectPath); err == nil {
+		return hash, nil // Already stored.
+	}
+	if err := os.MkdirAll(filepath.Dir(objectPath), 0755); err != nil {
+		return "", fmt.Errorf("could not create objects directory: %w", err)
+	}
+	if err := fs.WriteFileAtomic(objectPath, content); err != nil {
+		return "", fmt.Errorf("could not store object: %w", err)
+	}
+	return hash, nil
+}
+
+// RestoreObject writes the stored object with the given hash to path.
+func RestoreObject(stateDir, hash, path string) error {
+	if hash == "" {
+		return fmt.Errorf("no snapshot recorded for %s", path)
+	}
+	content, err := os.ReadFile(filepath.Join(stateDir, ObjectsDir, hash))
+	if err != nil {
+		return fmt.Errorf("snapshot not found for %s: %w", path, err)
+	}
+	return fs.WriteFileAtomic(path, content)
+}
+
+// Snapshot stores the current content of the given files in the object
+// store. It returns a map from each path to its hash; files that cannot be
+// read are left out.
+func (m *Manager) Snapshot(paths []string) map[string]string {
+	hashes := make(map[string]string, len(paths))
+	for _, path := range paths {
+		if hash, err := StoreObject(m.StateDir, path); err == nil {
+			hashes[path] = hash
+		}
+	}
+	return hashes
+}
+
+// PruneObjects removes stored objects that are no longer referenced by any
+// history entry, such as the snapshots of an operation that changed nothing.
+func (m *Manager) PruneObjects() {
+	referenced := make(map[string]struct{})
+	for _, entry := range m.state.History {
+		for _, op := range entry.Operations {
+			referenced[op.ContentHash] = struct{}{}
+			referenced[op.PrevHash] = struct{}{}
+		}
+	}
+
+	objectsDir := filepath.Join(m.StateDir, ObjectsDir)
+	entries, err := os.ReadDir(objectsDir)
+	if err != nil {
+		return
+	}
+	for _, e := range entries {
+		if _, ok := referenced[e.Name()]; !ok {
+			os.Remove(filepath.Join(objectsDir, e.Name()))
+		}
+	}
+}
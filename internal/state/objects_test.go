@@ -0,0 +1,26 @@
+package state
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestPruneObjects(t *testing.T) {
+	m, dir := newTestManager(t, map[string]string{"kept.txt": "kept\n", "dropped.txt": "dropped\n"}, []HistoryEntry{
+		{Operations: []Operation{{Path: "kept.txt", Action: "modify", ContentHash: hashOf("new\n"), PrevHash: hashOf("kept\n")}}},
+	}, 0)
+
+	hashes := m.Snapshot([]string{filepath.Join(dir, "kept.txt"), filepath.Join(dir, "dropped.txt")})
+	if len(hashes) != 2 {
+		t.Fatalf("Snapshot() = %v, want a hash for each file", hashes)
+	}
+	m.PruneObjects()
+
+	for name, want := range map[string]bool{"kept.txt": true, "dropped.txt": false} {
+		_, err := os.Stat(filepath.Join(m.StateDir, ObjectsDir, hashes[filepath.Join(dir, name)]))
+		if exists := err == nil; exists != want {
+			t.Errorf("object of %s exists = %v, want %v", name, exists, want)
+		}
+	}
+}
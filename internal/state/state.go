@@ -18,14 +18,31 @@ const (
 	stateDirName  = ".itf"
 	stateFileName = "state.itf"
 	TrashDir      = "trash"
+	RejectsDir    = "rejects"
+
+	// prevHashPrefix marks the optional line holding an operation's PrevHash.
+	prevHashPrefix = "pre:"
+	// modePrefix marks the optional line holding an operation's OldMode and
+	// NewMode, in octal, e.g., "mode:644:755".
+	modePrefix = "mode:"
 )
 
-// Operation represents a single file operation (create or modify).
+// Operation represents a single file operation (create, modify, delete,
+// rename or chmod).
 type Operation struct {
 	Path        string
 	Action      string
 	ContentHash string // SHA256 hash of the file content after operation
+	PrevHash    string // SHA256 hash of the file content before operation, if snapshotted
 	NewPath     string
+	OldMode     os.FileMode // Permission bits before the operation, 0 if unchanged or new
+	NewMode     os.FileMode // Permission bits after the operation, 0 if unchanged
+}
+
+// ModeChange records a change of a file's permission bits.
+type ModeChange struct {
+	Old os.FileMode // 0 if the file is new
+	New os.FileMode
 }
 
 // HistoryEntry represents one complete run of the tool.
@@ -47,8 +64,8 @@ type Manager struct {
 	StateDir  string
 }
 
-// findGitRoot finds the root of the git repository.
-func findGitRoot() (string, error) {
+// FindGitRoot finds the root of the git repository.
+func FindGitRoot() (string, error) {
 	cmd := exec.Command("git", "rev-parse", "--show-toplevel")
 	output, err := cmd.Output()
 	if err != nil {
@@ -59,7 +76,7 @@ func findGitRoot() (string, error) {
 
 // New creates and loads a state manager.
 func New() (*Manager, error) {
-	rootDir, err := findGitRoot()
+	rootDir, err := FindGitRoot()
 	if err != nil {
 		rootDir, err = os.Getwd()
 		if err != nil {
@@ -67,10 +84,9 @@ func New() (*Manager, error) {
 		}
 	}
 
+	// The state directory is created when something is first written to it,
+	// so that a dry run leaves no trace.
 	stateDir := filepath.Join(rootDir, stateDirName)
-	if err := os.MkdirAll(stateDir, 0755); err != nil {
-		return nil, fmt.Errorf("could not create state directory: %w", err)
-	}
 	m := &Manager{
 		statePath: filepath.Join(stateDir, stateFileName),
 		StateDir:  stateDir,
@@ -151,6 +167,18 @@ func (m *Manager) load() error {
 				op.NewPath = opLines[i]
 				i++
 			}
+			// Optional fields are prefixed lines, which can never be
+			// mistaken for the action line of the next operation.
+			if i < len(opLines) && strings.HasPrefix(opLines[i], prevHashPrefix) {
+				op.PrevHash = strings.TrimPrefix(opLines[i], prevHashPrefix)
+				i++
+			}
+			if i < len(opLines) && strings.HasPrefix(opLines[i], modePrefix) {
+				if _, err := fmt.Sscanf(opLines[i], modePrefix+"%o:%o", &op.OldMode, &op.NewMode); err != nil {
+					return fmt.Errorf("invalid state file: could not parse mode from '%s': %w", opLines[i], err)
+				}
+				i++
+			}
 			entry.Operations = append(entry.Operations, op)
 		}
 		m.state.History = append(m.state.History, entry)
@@ -178,6 +206,12 @@ func (m *Manager) save() {
 			if op.Action == "rename" {
 				opLines = append(opLines, op.NewPath)
 			}
+			if op.PrevHash != "" {
+				opLines = append(opLines, prevHashPrefix+op.PrevHash)
+			}
+			if op.OldMode != 0 || op.NewMode != 0 {
+				opLines = append(opLines, fmt.Sprintf("%s%o:%o", modePrefix, op.OldMode, op.NewMode))
+			}
 		}
 		entryBuilder.WriteString(strings.Join(opLines, "\n"))
 		blocks = append(blocks, entryBuilder.String())
@@ -185,6 +219,9 @@ func (m *Manager) save() {
 
 	content := strings.Join(blocks, "\n\n")
 
+	if err := os.MkdirAll(m.StateDir, 0755); err != nil {
+		return
+	}
 	if err := os.WriteFile(m.statePath, []byte(content), 0644); err != nil {
 		// TODO: Propagate this error. For now, it fails silently.
 	}
@@ -203,33 +240,15 @@ func (m *Manager) Write(operations []Operation) {
 	m.state.History = append(m.state.History, newEntry)
 	m.state.CurrentIndex++
 	m.save()
-}
-
-// GetOperationsToUndo gets the last operations and moves the history pointer.
-func (m *Manager) GetOperationsToUndo() []Operation {
-	if m.state.CurrentIndex < 0 {
-		return nil
-	}
-	ops := m.state.History[m.state.CurrentIndex].Operations
-	m.state.CurrentIndex--
-	m.save()
-	return ops
-}
-
-// GetOperationsToRedo gets the next operations and moves the history pointer.
-func (m *Manager) GetOperationsToRedo() []Operation {
-	nextIndex := m.state.CurrentIndex + 1
-	if nextIndex >= len(m.state.History) {
-		return nil
-	}
-	m.state.CurrentIndex = nextIndex
-	ops := m.state.History[m.state.CurrentIndex].Operations
-	m.save()
-	return ops
+	m.PruneObjects()
 }
 
 // CreateOperations prepares a list of operations from file changes.
-func (m *Manager) CreateOperations(updatedFiles []string, fileActions map[string]string, renames []model.FileRename) []Operation {
+// prevHashes maps paths to the hashes of their snapshots taken before the
+// changes were applied, and modes maps paths to their permission changes.
+// The new content of created, modified and rewritten renamed files is stored
+// in the object store so that the operation can be redone.
+func (m *Manager) CreateOperations(updatedFiles []string, fileActions map[string]string, renames []model.FileRename, prevHashes map[string]string, modes map[string]ModeChange) []Operation {
 	ops := make([]Operation, 0, len(updatedFiles))
 	trashPath := filepath.Join(m.StateDir, TrashDir)
 	wd, err := os.Getwd()
@@ -257,11 +276,16 @@ func (m *Manager) CreateOperations(updatedFiles []string, fileActions map[string
 		case "rename":
 			newPath = renameMap[f]
 			pathForHash = newPath // hash the new file
-		default: // create, modify
+		default: // create, modify, chmod
 			pathForHash = f
 		}
 
-		hash, opErr = fs.GetFileSHA256(pathForHash)
+		_, rewritten := prevHashes[f]
+		if action == "create" || action == "modify" || (action == "rename" && rewritten) {
+			hash, opErr = StoreObject(m.StateDir, pathForHash)
+		} else {
+			hash, opErr = fs.GetFileSHA256(pathForHash)
+		}
 		if opErr != nil {
 			// If hashing fails, the hash will be empty, revert will likely fail the check.
 			hash = ""
@@ -270,7 +294,10 @@ func (m *Manager) CreateOperations(updatedFiles []string, fileActions map[string
 			Path:        f,
 			Action:      action,
 			ContentHash: hash,
+			PrevHash:    prevHashes[f],
 			NewPath:     newPath,
+			OldMode:     modes[f].Old,
+			NewMode:     modes[f].New,
 		})
 	}
 	sort.Slice(ops, func(i, j int) bool {
@@ -0,0 +1,297 @@
+package tui
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/sokinpui/itf.go/model"
+)
+
+var (
+	selectedStyle = lipgloss.NewStyle().Bold(true).Foreground(lipgloss.Color("220")) // Yellow
+	hunkStyle     = lipgloss.NewStyle().Foreground(lipgloss.Color("63"))             // Mauve
+)
+
+const reviewHelp = "↑/↓ move • space toggle • tab hunks • a/n all/none • pgup/pgdn scroll • enter apply • q cancel"
+
+// runReview shows the interactive review screen and returns the items with
+// the user's decisions. If the review is cancelled, nothing is accepted.
+func runReview(items []model.ReviewItem) ([]model.ReviewItem, error) {
+	// Input is read from the TTY since stdin may be the piped source content.
+	p := tea.NewProgram(newReviewModel(items), tea.WithAltScreen(), tea.WithInputTTY())
+	final, err := p.Run()
+	if err != nil {
+		return nil, err
+	}
+
+	m := final.(reviewModel)
+	if !m.confirmed {
+		for i := range m.items {
+			m.items[i].Accepted = false
+		}
+	}
+	return m.items, nil
+}
+
+// reviewModel is the bubbletea model of the review screen.
+type reviewModel struct {
+	items      []model.ReviewItem
+	wd         string
+	cursor     int  // Selected item
+	hunk       int  // Selected hunk of the selected item
+	focusHunks bool // Whether space toggles hunks instead of items
+	scroll     int  // First visible line of the diff
+	width      int
+	height     int
+	confirmed  bool
+}
+
+func newReviewModel(items []model.ReviewItem) reviewModel {
+	wd, _ := os.Getwd()
+	return reviewModel{items: items, wd: wd, height: 24}
+}
+
+func (m reviewModel) Init() tea.Cmd {
+	return nil
+}
+
+func (m reviewModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tea.WindowSizeMsg:
+		m.width = msg.Width
+		m.height = msg.Height
+	case tea.KeyMsg:
+		return m.handleKey(msg)
+	}
+	return m, nil
+}
+
+func (m reviewModel) handleKey(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	if len(m.items) == 0 {
+		return m, tea.Quit
+	}
+	item := &m.items[m.cursor]
+
+	switch msg.String() {
+	case "ctrl+c", "q":
+		return m, tea.Quit
+	case "esc":
+		if !m.focusHunks {
+			return m, tea.Quit
+		}
+		m.focusHunks = false
+	case "enter":
+		m.confirmed = true
+		return m, tea.Quit
+	case "up", "k":
+		if m.focusHunks {
+			m.hunk = max(m.hunk-1, 0)
+			m.scrollToHunk()
+		} else if m.cursor > 0 {
+			m.cursor--
+			m.hunk, m.scroll = 0, 0
+		}
+	case "down", "j":
+		if m.focusHunks {
+			m.hunk = min(m.hunk+1, len(item.Hunks)-1)
+			m.scrollToHunk()
+		} else if m.cursor < len(m.items)-1 {
+			m.cursor++
+			m.hunk, m.scroll = 0, 0
+		}
+	case "tab":
+		if len(item.Hunks) > 0 {
+			m.focusHunks = !m.focusHunks
+			m.scrollToHunk()
+		}
+	case " ", "x":
+		if m.focusHunks {
+			item.Hunks[m.hunk].Accepted = !item.Hunks[m.hunk].Accepted
+			if item.Hunks[m.hunk].Accepted {
+				item.Accepted = true
+			}
+		} else {
+			item.Accepted = !item.Accepted
+		}
+	case "a", "n":
+		for i := range m.items {
+			m.items[i].Accepted = msg.String() == "a"
+		}
+	case "pgdown", "ctrl+d":
+		m.scroll = min(m.scroll+m.diffHeight()/2, max(len(m.diffLines())-m.diffHeight(), 0))
+	case "pgup", "ctrl+u":
+		m.scroll = max(m.scroll-m.diffHeight()/2, 0)
+	}
+	return m, nil
+}
+
+// scrollToHunk scrolls the diff so the selected hunk starts at the top.
+func (m *reviewModel) scrollToHunk() {
+	if !m.focusHunks {
+		return
+	}
+	for i, line := range m.diffLines() {
+		if line.hunk == m.hunk && line.isHeader {
+			m.scroll = i
+			return
+		}
+	}
+}
+
+// listHeight is the number of item lines shown above the diff.
+func (m reviewModel) listHeight() int {
+	return min(len(m.items), max(m.height/3, 3))
+}
+
+// diffHeight is the number of diff lines that fit below the item list.
+func (m reviewModel) diffHeight() int {
+	// Title, blank line, separator and help take four lines.
+	return max(m.height-m.listHeight()-4, 3)
+}
+
+func (m reviewModel) View() string {
+	var b strings.Builder
+	b.WriteString(headerStyle.Render(fmt.Sprintf("Review %d planned operation(s)", len(m.items))))
+	b.WriteString("\n\n")
+
+	// Keep the cursor inside the visible window of the list.
+	listHeight := m.listHeight()
+	first := max(min(m.cursor-listHeight/2, len(m.items)-listHeight), 0)
+	for i := first; i < first+listHeight && i < len(m.items); i++ {
+		b.WriteString(m.renderItem(i))
+		b.WriteString("\n")
+	}
+
+	b.WriteString(faintStyle.Render(strings.Repeat("─", max(m.width, 20))))
+	b.WriteString("\n")
+
+	lines := m.diffLines()
+	end := min(m.scroll+m.diffHeight(), len(lines))
+	for _, line := range lines[min(m.scroll, end):end] {
+		b.WriteString(m.renderDiffLine(line))
+		b.WriteString("\n")
+	}
+
+	b.WriteString(faintStyle.Render(reviewHelp))
+	return b.String()
+}
+
+func (m reviewModel) renderItem(i int) string {
+	item := m.items[i]
+	check := "[ ]"
+	if item.Accepted {
+		check = "[x]"
+	}
+
+	path := m.relative(item.Path)
+	if item.Action == "rename" {
+		path = fmt.Sprintf("%s -> %s", path, m.relative(item.NewPath))
+	}
+
+	style := pathStyle
+	switch item.Action {
+	case "create":
+		style = createdStyle
+	case "modify":
+		style = successStyle
+	case "rename":
+		style = renamedStyle
+	case "delete":
+		style = deletedStyle
+	}
+
+	line := fmt.Sprintf("%s %s %s", check, style.Render(fmt.Sprintf("%-7s", item.Action)), path)
+	if len(item.Hunks) > 0 {
+		accepted := 0
+		for _, h := range item.Hunks {
+			if h.Accepted {
+				accepted++
+			}
+		}
+		line += faintStyle.Render(fmt.Sprintf(" (%d/%d hunks)", accepted, len(item.Hunks)))
+	}
+
+	if i == m.cursor {
+		return selectedStyle.Render("> ") + line
+	}
+	return "  " + line
+}
+
+// reviewLine is a single line of the diff view.
+type reviewLine struct {
+	text     string
+	hunk     int // Index of the hunk the line belongs to, or -1
+	isHeader bool
+}
+
+// diffLines returns the diff of the selected item split into lines. Items
+// with hunks are shown hunk by hunk so each hunk can be selected.
+func (m reviewModel) diffLines() []reviewLine {
+	if len(m.items) == 0 {
+		return nil
+	}
+	item := m.items[m.cursor]
+
+	if len(item.Hunks) == 0 {
+		if item.Diff == "" {
+			return []reviewLine{{text: "(no content changes)", hunk: -1}}
+		}
+		var lines []reviewLine
+		for _, text := range strings.Split(strings.TrimSuffix(item.Diff, "\n"), "\n") {
+			lines = append(lines, reviewLine{text: text, hunk: -1})
+		}
+		return lines
+	}
+
+	var lines []reviewLine
+	for i, h := range item.Hunks {
+		for j, text := range strings.Split(strings.TrimSuffix(h.Content, "\n"), "\n") {
+			lines = append(lines, reviewLine{text: text, hunk: i, isHeader: j == 0})
+		}
+	}
+	return lines
+}
+
+func (m reviewModel) renderDiffLine(line reviewLine) string {
+	if line.hunk >= 0 {
+		h := m.items[m.cursor].Hunks[line.hunk]
+		if line.isHeader {
+			check := "[ ]"
+			if h.Accepted {
+				check = "[x]"
+			}
+			marker := "  "
+			if m.focusHunks && line.hunk == m.hunk {
+				marker = selectedStyle.Render("> ")
+			}
+			return marker + check + " " + hunkStyle.Render(line.text)
+		}
+		if !h.Accepted {
+			return faintStyle.Render(line.text)
+		}
+	}
+
+	switch {
+	case strings.HasPrefix(line.text, "+++"), strings.HasPrefix(line.text, "---"):
+		return faintStyle.Render(line.text)
+	case strings.HasPrefix(line.text, "@@"):
+		return hunkStyle.Render(line.text)
+	case strings.HasPrefix(line.text, "+"):
+		return successStyle.Render(line.text)
+	case strings.HasPrefix(line.text, "-"):
+		return errorStyle.Render(line.text)
+	}
+	return line.text
+}
+
+func (m reviewModel) relative(path string) string {
+	rel, err := filepath.Rel(m.wd, path)
+	if err != nil {
+		return path
+	}
+	return rel
+}
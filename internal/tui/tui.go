@@ -20,10 +20,14 @@ var (
 	successStyle = lipgloss.NewStyle().Foreground(lipgloss.Color("78"))            // Green
 	deletedStyle = lipgloss.NewStyle().Foreground(lipgloss.Color("204"))           // Pink
 	errorStyle   = lipgloss.NewStyle().Foreground(lipgloss.Color("197"))           // Red
+	fuzzyStyle   = lipgloss.NewStyle().Foreground(lipgloss.Color("214"))           // Orange
 	pathStyle    = lipgloss.NewStyle()
 	faintStyle   = lipgloss.NewStyle().Faint(true)
 )
 
+// hookOutputLines is the number of trailing output lines shown for a hook.
+const hookOutputLines = 10
+
 // --- Spinner ---
 type spinner struct {
 	frames []string
@@ -48,6 +52,7 @@ func (s spinner) View() string {
 type TUI struct {
 	app             *itf.App
 	noAnimation     bool
+	interactive     bool
 	spinner         spinner
 	mu              sync.Mutex
 	progressCurrent int
@@ -55,26 +60,34 @@ type TUI struct {
 }
 
 // New creates a new TUI.
-func New(app *itf.App, noAnimation bool) *TUI {
+func New(app *itf.App, noAnimation, interactive bool) *TUI {
 	return &TUI{
 		app:         app,
 		noAnimation: noAnimation,
+		interactive: interactive,
 		spinner:     newSpinner(),
 	}
 }
 
-// Run starts the TUI, executes the application logic, and displays the results.
-func (t *TUI) Run() error {
-	if t.noAnimation {
+// Run starts the TUI, executes the application logic, and displays the
+// results. It returns the summary it displayed.
+func (t *TUI) Run() (model.Summary, error) {
+	if t.interactive {
+		t.app.SetReviewer(runReview)
+	}
+
+	// The spinner would draw over the review screen, so it is disabled in
+	// interactive mode.
+	if t.noAnimation || t.interactive {
 		summary, err := t.app.Execute()
 		if err != nil {
 			if e, ok := err.(*itf.DetailedError); ok {
 				fmt.Fprintf(os.Stderr, "\n--- Stack Trace ---\n%s\n", e.Stack)
 			}
-			return err
+			return model.Summary{}, err
 		}
 		fmt.Print(t.renderSummary(summary))
-		return nil
+		return summary, nil
 	}
 
 	t.app.SetProgressCallback(func(current, total int) {
@@ -106,11 +119,11 @@ func (t *TUI) Run() error {
 		if e, ok := err.(*itf.DetailedError); ok {
 			fmt.Fprintf(os.Stderr, "\n--- Stack Trace ---\n%s\n", e.Stack)
 		}
-		return err
+		return model.Summary{}, err
 	}
 
 	fmt.Print(t.renderSummary(summary))
-	return nil
+	return summary, nil
 }
 
 func (t *TUI) renderProgress() {
@@ -169,12 +182,90 @@ func (t *TUI) renderSummary(summary model.Summary) string {
 		}
 	}
 
+	if len(summary.Chmodded) > 0 {
+		hasContent = true
+		b.WriteString(successStyle.Render("Mode changed:"))
+		b.WriteString("\n")
+		for _, c := range summary.Chmodded {
+			b.WriteString(fmt.Sprintf("  %s  %s\n", pathStyle.Render(c.Path), faintStyle.Render(fmt.Sprintf("mode %o", c.Mode))))
+		}
+	}
+
+	if len(summary.Partial) > 0 {
+		hasContent = true
+		b.WriteString(fuzzyStyle.Render("Partially applied:"))
+		b.WriteString("\n")
+		for _, p := range summary.Partial {
+			detail := fmt.Sprintf("%d of %d hunks", p.Applied, p.Total)
+			if p.RejectFile != "" {
+				detail += ", rejects in " + p.RejectFile
+			}
+			b.WriteString(fmt.Sprintf("  %s  %s\n", pathStyle.Render(p.Path), faintStyle.Render(detail)))
+		}
+	}
+	if len(summary.Fuzzy) > 0 {
+		hasContent = true
+		b.WriteString(fuzzyStyle.Render("Fuzzy matched:"))
+		b.WriteString("\n")
+		for _, f := range summary.Fuzzy {
+			detail := fmt.Sprintf("hunk #%d at line %d (%.0f%% similar)", f.Hunk, f.Line, f.Score*100)
+			b.WriteString(fmt.Sprintf("  %s  %s\n", pathStyle.Render(f.Path), faintStyle.Render(detail)))
+		}
+	}
+	if len(summary.Offsets) > 0 {
+		hasContent = true
+		b.WriteString(fuzzyStyle.Render("Offset:"))
+		b.WriteString("\n")
+		for _, o := range summary.Offsets {
+			detail := fmt.Sprintf("hunk #%d at line %d (offset %+d)", o.Hunk, o.Line, o.Offset)
+			b.WriteString(fmt.Sprintf("  %s  %s\n", pathStyle.Render(o.Path), faintStyle.Render(detail)))
+		}
+	}
+
+	if len(summary.Warnings) > 0 {
+		hasContent = true
+		b.WriteString(fuzzyStyle.Render("Invalid:"))
+		b.WriteString("\n")
+		for _, f := range summary.Warnings {
+			b.WriteString(fmt.Sprintf("  %s  %s\n", pathStyle.Render(f.Path), faintStyle.Render(f.Err.Error())))
+		}
+	}
+
+	if len(summary.Hooks) > 0 {
+		hasContent = true
+		b.WriteString(headerStyle.Render("Hooks:"))
+		b.WriteString("\n")
+		for _, h := range summary.Hooks {
+			if h.ExitCode == 0 {
+				b.WriteString(fmt.Sprintf("  %s %s\n", successStyle.Render("✓"), pathStyle.Render(h.Command)))
+			} else {
+				b.WriteString(fmt.Sprintf("  %s %s  %s\n", errorStyle.Render("✗"), pathStyle.Render(h.Command),
+					errorStyle.Render(fmt.Sprintf("exit %d", h.ExitCode))))
+			}
+			if h.Output == "" {
+				continue
+			}
+			lines := strings.Split(h.Output, "\n")
+			if len(lines) > hookOutputLines {
+				b.WriteString(faintStyle.Render(fmt.Sprintf("    ... %d more lines", len(lines)-hookOutputLines)) + "\n")
+				lines = lines[len(lines)-hookOutputLines:]
+			}
+			for _, line := range lines {
+				b.WriteString(faintStyle.Render("    "+line) + "\n")
+			}
+		}
+	}
+
 	if len(summary.Failed) > 0 {
 		hasContent = true
 		b.WriteString(errorStyle.Render("Failed:"))
 		b.WriteString("\n")
 		for _, f := range summary.Failed {
-			b.WriteString(fmt.Sprintf("  %s\n", pathStyle.Render(f)))
+			b.WriteString(fmt.Sprintf("  %s  %s", pathStyle.Render(f.Path), faintStyle.Render(string(f.Stage))))
+			if f.Err != nil {
+				b.WriteString(" " + errorStyle.Render(f.Err.Error()))
+			}
+			b.WriteString("\n")
 		}
 	}
 
@@ -184,3 +275,48 @@ func (t *TUI) renderSummary(summary model.Summary) string {
 
 	return b.String()
 }
+
+// RenderHistory formats history entries for display, with the files each
+// entry touched.
+func RenderHistory(entries []model.HistoryEntry) string {
+	if len(entries) == 0 {
+		return faintStyle.Render("No history.") + "\n"
+	}
+
+	var b strings.Builder
+	for _, entry := range entries {
+		header := fmt.Sprintf("#%d  %s", entry.ID, entry.Timestamp.Local().Format("2006-01-02 15:04:05"))
+		switch {
+		case entry.Current:
+			b.WriteString(headerStyle.Render(header + "  (current)"))
+		case entry.Undone:
+			b.WriteString(faintStyle.Render(header + "  (undone)"))
+		default:
+			b.WriteString(headerStyle.Render(header))
+		}
+		b.WriteString("\n")
+
+		for _, op := range entry.Operations {
+			path := op.Path
+			if op.NewPath != "" {
+				path = fmt.Sprintf("%s -> %s", op.Path, op.NewPath)
+			}
+			b.WriteString(fmt.Sprintf("  %s %s\n", actionStyle(op.Action).Render(fmt.Sprintf("%-6s", op.Action)), pathStyle.Render(path)))
+		}
+	}
+	return b.String()
+}
+
+// actionStyle returns the style used for an action in summaries.
+func actionStyle(action string) lipgloss.Style {
+	switch action {
+	case "create":
+		return createdStyle
+	case "rename":
+		return renamedStyle
+	case "delete":
+		return deletedStyle
+	default:
+		return successStyle
+	}
+}
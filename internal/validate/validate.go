@@ -0,0 +1,129 @@
+// Package validate checks that the new content of a file is still valid
+// before it is written.
+package validate
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"go/parser"
+	"go/token"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// commandTimeout is how long a validator command may run.
+const commandTimeout = 30 * time.Second
+
+// syntaxCheckers check the syntax of a file's content, by file extension.
+var syntaxCheckers = map[string]func(path string, src []byte) error{
+	".go":   checkGo,
+	".json": checkJSON,
+	".yaml": checkYAML,
+	".yml":  checkYAML,
+	".toml": checkTOML,
+}
+
+// Content checks the content of the file at path with the built-in syntax
+// checker for its extension, if any, and then with the validator command
+// configured for it in commands, keyed by extension (e.g., ".py"). It
+// returns nil if the content is valid or there is nothing to check it with.
+// Cancelling ctx stops the validator command.
+func Content(ctx context.Context, path string, content []string, commands map[string]string) error {
+	src := []byte(strings.Join(content, "\n") + "\n")
+	ext := strings.ToLower(filepath.Ext(path))
+	if check, found := syntaxCheckers[ext]; found {
+		if err := check(path, src); err != nil {
+			return err
+		}
+	}
+	if command := commands[ext]; command != "" {
+		return runCommand(ctx, command, path, src)
+	}
+	return nil
+}
+
+func checkGo(path string, src []byte) error {
+	_, err := parser.ParseFile(token.NewFileSet(), filepath.Base(path), src, parser.SkipObjectResolution)
+	return err
+}
+
+func checkJSON(_ string, src []byte) error {
+	var v any
+	err := json.Unmarshal(src, &v)
+	var syntaxErr *json.SyntaxError
+	if errors.As(err, &syntaxErr) {
+		line := 1 + bytes.Count(src[:syntaxErr.Offset], []byte("\n"))
+		return fmt.Errorf("line %d: %w", line, err)
+	}
+	return err
+}
+
+func checkYAML(_ string, src []byte) error {
+	decoder := yaml.NewDecoder(bytes.NewReader(src))
+	for {
+		var v any
+		if err := decoder.Decode(&v); err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+	}
+}
+
+func checkTOML(_ string, src []byte) error {
+	var v any
+	_, err := toml.Decode(string(src), &v)
+	return err
+}
+
+// runCommand runs a validator command through the shell on a copy of the
+// content. The copy has the same name as the file, in a temporary directory,
+// and its path replaces "{}" in the command, or is appended to it. The
+// content is invalid if the command exits with a non-zero status.
+func runCommand(ctx context.Context, command, path string, src []byte) error {
+	dir, err := os.MkdirTemp("", "itf-validate-")
+	if err != nil {
+		return fmt.Errorf("failed to create temporary directory: %w", err)
+	}
+	defer os.RemoveAll(dir)
+
+	copyPath := filepath.Join(dir, filepath.Base(path))
+	if err := os.WriteFile(copyPath, src, 0644); err != nil {
+		return fmt.Errorf("failed to write temporary file: %w", err)
+	}
+	quoted := "'" + strings.ReplaceAll(copyPath, "'", `'\''`) + "'"
+	if strings.Contains(command, "{}") {
+		command = strings.ReplaceAll(command, "{}", quoted)
+	} else {
+		command += " " + quoted
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, commandTimeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, "sh", "-c", command)
+	cmd.WaitDelay = time.Second
+	output, err := cmd.CombinedOutput()
+	if err == nil {
+		return nil
+	}
+	if ctx.Err() != nil {
+		return fmt.Errorf("validator stopped: %w", ctx.Err())
+	}
+	// Refer to the file by its name rather than its temporary copy.
+	message := strings.TrimSpace(strings.ReplaceAll(string(output), copyPath, filepath.Base(path)))
+	if message == "" {
+		message = err.Error()
+	}
+	return fmt.Errorf("validator failed: %s", message)
+}
@@ -0,0 +1,85 @@
+package validate
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestContent(t *testing.T) {
+	tests := []struct {
+		name     string
+		path     string
+		content  string
+		commands map[string]string
+		wantErr  string
+	}{
+		{name: "valid Go", path: "main.go", content: "package main\n\nfunc main() {}"},
+		{name: "invalid Go", path: "main.go", content: "package main\n\nfunc main() {", wantErr: "main.go:3:"},
+		{name: "valid JSON", path: "a.json", content: `{"a": 1}`},
+		{name: "invalid JSON", path: "a.json", content: "{\n\"a\": 1,\n}", wantErr: "line 3:"},
+		{name: "valid YAML", path: "a.yaml", content: "a: 1\n---\nb: 2"},
+		{name: "invalid YAML", path: "a.yml", content: "a: [1", wantErr: "yaml:"},
+		{name: "valid TOML", path: "a.toml", content: "a = 1"},
+		{name: "invalid TOML", path: "a.toml", content: "a = ", wantErr: "toml:"},
+		{name: "extension in upper case", path: "A.JSON", content: "{", wantErr: "unexpected end"},
+		{name: "unknown extension", path: "a.py", content: "def f(:"},
+		{
+			name:     "passing command",
+			path:     "a.py",
+			content:  "ok",
+			commands: map[string]string{".py": "grep -q ok"},
+		},
+		{
+			name:     "failing command",
+			path:     "a.py",
+			content:  "bad",
+			commands: map[string]string{".py": "echo error in {}; exit 1"},
+			wantErr:  "validator failed: error in a.py",
+		},
+		{
+			name:     "failing command without output",
+			path:     "a.py",
+			content:  "bad",
+			commands: map[string]string{".py": "grep -q ok {}"},
+			wantErr:  "validator failed: exit status 1",
+		},
+		{
+			name:     "command for another extension",
+			path:     "a.py",
+			content:  "bad",
+			commands: map[string]string{".rb": "false"},
+		},
+		{
+			name:     "syntax checked before the command",
+			path:     "a.json",
+			content:  "{",
+			commands: map[string]string{".json": "true"},
+			wantErr:  "unexpected end",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := Content(context.Background(), tt.path, strings.Split(tt.content, "\n"), tt.commands)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("Content() error = %v, want nil", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Content() error = %v, want one containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestContentCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err := Content(ctx, "a.py", []string{"x"}, map[string]string{".py": "sleep 5"})
+	if err == nil || !strings.Contains(err.Error(), "validator stopped") {
+		t.Errorf("Content() error = %v, want the validator stopped", err)
+	}
+}
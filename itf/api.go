@@ -0,0 +1,244 @@
+package itf
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/sokinpui/itf.go/internal/parser"
+	"github.com/sokinpui/itf.go/model"
+)
+
+// Options configures Parse, ApplyPlan, Undo and Redo. The settings have the
+// same meaning as in Config. The zero value uses every block in the content,
+// picks the backend automatically, turns fuzzy matching off and skips
+// changes that fail validation.
+type Options struct {
+	Extensions     []string // With the leading dot, e.g., ".go"; ".diff" for diff blocks only
+	FuzzyThreshold float64
+	Partial        bool
+	MergeGo        bool
+	Include        []string
+	Exclude        []string
+	PathHints      []string // Sources of the paths of file blocks in order of precedence; nil for all but PathHintHeading
+	Backend        string
+	Buffer         bool
+	Validate       string
+	Validators     map[string]string
+	Hooks          []Hook
+	Progress       ProgressUpdate // Called as files are written, may be nil
+}
+
+func (o Options) config() *Config {
+	return &Config{
+		Extensions:     o.Extensions,
+		FuzzyThreshold: o.FuzzyThreshold,
+		Partial:        o.Partial,
+		MergeGo:        o.MergeGo,
+		Include:        o.Include,
+		Exclude:        o.Exclude,
+		PathHints:      o.PathHints,
+		Backend:        o.Backend,
+		Buffer:         o.Buffer,
+		Validate:       o.Validate,
+		Validators:     o.Validators,
+		Hooks:          o.Hooks,
+	}
+}
+
+// newApp creates an App for the library API. It never reads stdin or the
+// clipboard.
+func newApp(ctx context.Context, opts Options) (*App, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	app, err := New(opts.config())
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize itf app: %w", err)
+	}
+	app.SetProgressCallback(opts.Progress)
+	return app, nil
+}
+
+// Plan holds the operations parsed from content, before they are applied.
+// Paths are absolute.
+type Plan struct {
+	plan *parser.ExecutionPlan
+}
+
+// Parse parses content into a plan. Diffs and edits are resolved against
+// the files as they are on disk, but nothing is written and Neovim is not
+// started.
+func Parse(ctx context.Context, content string, opts Options) (*Plan, error) {
+	app, err := newApp(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+	if content == "" {
+		return &Plan{plan: parser.NewExecutionPlan(nil, nil, nil, nil, nil)}, nil
+	}
+	plan, err := app.createPlan(content)
+	if err != nil {
+		return nil, err
+	}
+	return &Plan{plan: plan}, ctx.Err()
+}
+
+// Entries describes the planned operations, each with a diff against the
+// current file.
+func (p *Plan) Entries() []model.PlanEntry {
+	return describePlan(p.plan)
+}
+
+// Failed returns the blocks that could not be turned into operations, such
+// as diffs whose hunks were not found.
+func (p *Plan) Failed() []model.Failure {
+	return slices.Clone(p.plan.Failed)
+}
+
+// Filter returns a plan with only the operations for which keep returns
+// true. keep is called with the entry describing each operation, as
+// returned by Entries. Failures are kept.
+func (p *Plan) Filter(keep func(entry model.PlanEntry) bool) *Plan {
+	wd, _ := os.Getwd()
+	changes := slices.DeleteFunc(slices.Clone(p.plan.Changes), func(c model.FileChange) bool {
+		return !keep(describeChange(wd, c, p.plan.FileActions[c.Path]))
+	})
+	deletes := slices.DeleteFunc(slices.Clone(p.plan.Deletes), func(path string) bool {
+		return !keep(describeDelete(wd, path))
+	})
+	renames := slices.DeleteFunc(slices.Clone(p.plan.Renames), func(r model.FileRename) bool {
+		return !keep(describeRename(wd, r))
+	})
+	chmods := slices.DeleteFunc(slices.Clone(p.plan.Chmods), func(c model.FileChmod) bool {
+		return !keep(describeChmod(c))
+	})
+	return &Plan{plan: parser.NewExecutionPlan(changes, deletes, renames, chmods, slices.Clone(p.plan.Failed))}
+}
+
+// Result is the outcome of applying a plan, or of an undo or redo. Paths
+// are relative to the current working directory.
+type Result struct {
+	Created      []string
+	Modified     []string
+	Renamed      []Rename
+	Deleted      []string
+	Chmodded     []model.FileChmod // Files whose permission bits were the only change
+	Failed       []model.Failure
+	Fuzzy        []model.FuzzyMatch
+	Offsets      []model.OffsetMatch
+	Partial      []model.PartialPatch
+	Invalid      []model.Failure // Applied even though they failed validation
+	Hooks        []model.HookResult
+	HistoryEntry int // ID of the current history entry afterwards, 0 if none
+	Message      string
+}
+
+// Rename is a renamed file of a Result.
+type Rename struct {
+	From string
+	To   string
+}
+
+// HasFailures reports whether any file failed or any hook exited with a
+// non-zero status.
+func (r *Result) HasFailures() bool {
+	return model.Summary{Failed: r.Failed, Hooks: r.Hooks}.HasFailures()
+}
+
+func newResult(summary model.Summary) *Result {
+	result := &Result{
+		Created:      summary.Created,
+		Modified:     summary.Modified,
+		Deleted:      summary.Deleted,
+		Chmodded:     summary.Chmodded,
+		Failed:       summary.Failed,
+		Fuzzy:        summary.Fuzzy,
+		Offsets:      summary.Offsets,
+		Partial:      summary.Partial,
+		Invalid:      summary.Warnings,
+		Hooks:        summary.Hooks,
+		HistoryEntry: summary.HistoryEntry,
+		Message:      summary.Message,
+	}
+	for _, r := range summary.Renamed {
+		from, to, _ := strings.Cut(r, " -> ")
+		result.Renamed = append(result.Renamed, Rename{From: from, To: to})
+	}
+	return result
+}
+
+// ApplyPlan validates and applies a plan and records it in the history, so
+// that it can be undone. ctx is checked until the first file is written,
+// and stops the validator and hook commands; a run that has started
+// writing files is completed so that it is recorded.
+func ApplyPlan(ctx context.Context, plan *Plan, opts Options) (*Result, error) {
+	app, err := newApp(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+	if !hasOperations(plan.plan) {
+		summary := model.Summary{Failed: plan.Failed(), Message: "No valid changes were generated. Nothing to do."}
+		app.relativizeSummaryPaths(&summary)
+		return newResult(summary), nil
+	}
+	// Validation can set warnings on the plan, which must not leak into
+	// the caller's Plan.
+	execPlan := *plan.plan
+	summary, err := app.applyPlan(ctx, &execPlan)
+	if err != nil {
+		return nil, err
+	}
+	return newResult(summary), nil
+}
+
+// Undo undoes the last steps history entries, or the last one if steps is
+// 0. If ctx is cancelled, it stops before the next entry and returns the
+// result so far along with ctx's error.
+func Undo(ctx context.Context, steps int, opts Options) (*Result, error) {
+	app, err := newApp(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+	app.cfg.Steps = steps
+	summary, err := app.undoOperations(ctx)
+	if err != nil && ctx.Err() == nil {
+		return nil, err
+	}
+	return newResult(summary), err
+}
+
+// Redo redoes the next steps undone history entries, or the next one if
+// steps is 0. Cancellation works as for Undo.
+func Redo(ctx context.Context, steps int, opts Options) (*Result, error) {
+	app, err := newApp(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+	app.cfg.Steps = steps
+	summary, err := app.redoOperations(ctx)
+	if err != nil && ctx.Err() == nil {
+		return nil, err
+	}
+	return newResult(summary), err
+}
+
+// RegisterBlockHandler registers a handler for the code blocks whose
+// language, the first word of the fence's info string, is lang, e.g.,
+// "sql-migration". Registered handlers take precedence over the built-in
+// ones, including those for "diff", "delete", "rename" and "tool", and over
+// the handlers registered before them. Blocks that no handler claims are
+// file blocks. It is safe to call concurrently with Parse.
+func RegisterBlockHandler(lang string, h model.BlockHandler) {
+	parser.RegisterHandler(lang, h)
+}
+
+// RegisterBlockPattern registers a handler for the code blocks whose whole
+// info string matches pattern, with the same precedence as
+// RegisterBlockHandler.
+func RegisterBlockPattern(pattern *regexp.Regexp, h model.BlockHandler) {
+	parser.RegisterHandlerPattern(pattern, h)
+}
@@ -0,0 +1,130 @@
+package itf
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/atotto/clipboard"
+
+	"github.com/sokinpui/itf.go/internal/fs"
+	"github.com/sokinpui/itf.go/internal/parser"
+	"github.com/sokinpui/itf.go/internal/patcher"
+	"github.com/sokinpui/itf.go/model"
+)
+
+// Destinations accepted by Config.Feedback.
+const (
+	FeedbackStdout    = "stdout"
+	FeedbackClipboard = "clipboard"
+)
+
+// feedbackContext is the number of lines shown around the closest matching
+// region of a file.
+const feedbackContext = 2
+
+// stageExplanations explain each failure stage to the model that wrote the
+// change.
+var stageExplanations = map[model.FailureStage]string{
+	model.StagePlan:     "The change could not be parsed.",
+	model.StagePatch:    "The lines the change expects to find are not in the current file.",
+	model.StageValidate: "The file would no longer be valid after the change.",
+	model.StageApply:    "The file could not be written, deleted or renamed.",
+	model.StageSave:     "The file could not be saved to disk.",
+}
+
+// writeFeedback writes the feedback report for the failures of a summary to
+// the destination in Config.Feedback.
+func (a *App) writeFeedback(summary model.Summary) (model.Summary, error) {
+	report := a.FeedbackReport(summary.Failed)
+
+	switch a.cfg.Feedback {
+	case FeedbackStdout:
+		fmt.Print(report)
+	case FeedbackClipboard:
+		if report == "" {
+			summary.Message = "No failures to report."
+			return summary, nil
+		}
+		if err := clipboard.WriteAll(report); err != nil {
+			return summary, fmt.Errorf("failed to write feedback to clipboard: %w", err)
+		}
+		summary.Message = "Feedback report copied to clipboard."
+	default:
+		return summary, fmt.Errorf("unknown feedback destination: %s", a.cfg.Feedback)
+	}
+	return summary, nil
+}
+
+// FeedbackReport builds a markdown report of failures that can be pasted
+// back to the model that wrote the changes. For each failed hunk of a diff
+// or patch envelope, and each failed edit, it shows the hunk as given and
+// the region of the file that most resembles it. It returns an empty string
+// if there are no failures.
+func (a *App) FeedbackReport(failed []model.Failure) string {
+	if len(failed) == 0 {
+		return ""
+	}
+
+	wd, _ := os.Getwd()
+
+	var b strings.Builder
+	b.WriteString("# Patch feedback\n\n")
+	b.WriteString("Some changes could not be applied. Please resend them as corrected patches against the current file contents shown below.\n")
+
+	for _, f := range failed {
+		path := relativePath(wd, f.Path)
+		b.WriteString("\n## `" + path + "`")
+		if f.Hunk > 0 && f.Source == "edit" {
+			fmt.Fprintf(&b, ", edit #%d", f.Hunk)
+		} else if f.Hunk > 0 {
+			fmt.Fprintf(&b, ", hunk #%d", f.Hunk)
+		}
+		b.WriteString("\n\n")
+		if explanation := stageExplanations[f.Stage]; explanation != "" {
+			b.WriteString(explanation + " ")
+		}
+		if f.Err != nil {
+			fmt.Fprintf(&b, "Error: %v.", f.Err)
+		}
+		b.WriteString("\n")
+
+		hunk, ok := parser.FailedHunk(f)
+		if !ok {
+			continue
+		}
+		b.WriteString("\nThe hunk as given:\n\n```diff\n" + hunk + "\n```\n")
+		writeClosestRegion(&b, a.pathResolver, path, hunk)
+	}
+	return b.String()
+}
+
+// writeClosestRegion writes the lines of the file at path that most resemble
+// hunk, with line numbers.
+func writeClosestRegion(b *strings.Builder, resolver *fs.PathResolver, path, hunk string) {
+	existing := resolver.ResolveExisting(path)
+	if existing == "" {
+		fmt.Fprintf(b, "\nThe file `%s` does not exist.\n", path)
+		return
+	}
+	lines, err := fs.ReadLines(existing)
+	if err != nil {
+		return
+	}
+	start, end, ok := patcher.ClosestRegion(lines, hunk)
+	if !ok {
+		fmt.Fprintf(b, "\nNothing in `%s` resembles this hunk.\n", path)
+		return
+	}
+
+	fmt.Fprintf(b, "\nThe closest matching region of `%s` (lines %d-%d):\n\n", path, start, end)
+	b.WriteString("```" + strings.TrimPrefix(filepath.Ext(path), ".") + "\n")
+	first := max(start-feedbackContext, 1)
+	last := min(end+feedbackContext, len(lines))
+	width := len(fmt.Sprint(last))
+	for n := first; n <= last; n++ {
+		fmt.Fprintf(b, "%*d  %s\n", width, n, lines[n-1])
+	}
+	b.WriteString("```\n")
+}
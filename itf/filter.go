@@ -0,0 +1,47 @@
+package itf
+
+import (
+	"path/filepath"
+	"slices"
+
+	"github.com/sokinpui/itf.go/internal/fs"
+	"github.com/sokinpui/itf.go/internal/parser"
+	"github.com/sokinpui/itf.go/model"
+)
+
+// filterPlan removes the operations on files that are not matched by any of
+// the Config.Include globs, if there are any, or that are matched by one of
+// the Config.Exclude globs. Paths are matched relative to the project root.
+func (a *App) filterPlan(plan *parser.ExecutionPlan) *parser.ExecutionPlan {
+	if len(a.cfg.Include) == 0 && len(a.cfg.Exclude) == 0 {
+		return plan
+	}
+
+	excluded := func(path string) bool {
+		matches := func(pattern string) bool { return a.matchGlob(pattern, path) }
+		if len(a.cfg.Include) > 0 && !slices.ContainsFunc(a.cfg.Include, matches) {
+			return true
+		}
+		return slices.ContainsFunc(a.cfg.Exclude, matches)
+	}
+
+	changes := slices.DeleteFunc(slices.Clone(plan.Changes), func(c model.FileChange) bool { return excluded(c.Path) })
+	deletes := slices.DeleteFunc(slices.Clone(plan.Deletes), excluded)
+	renames := slices.DeleteFunc(slices.Clone(plan.Renames), func(r model.FileRename) bool {
+		return excluded(r.OldPath) || excluded(r.NewPath)
+	})
+	chmods := slices.DeleteFunc(slices.Clone(plan.Chmods), func(c model.FileChmod) bool { return excluded(c.Path) })
+	failed := slices.DeleteFunc(slices.Clone(plan.Failed), func(f model.Failure) bool { return excluded(f.Path) })
+	return parser.NewExecutionPlan(changes, deletes, renames, chmods, failed)
+}
+
+// matchGlob reports whether an absolute path matches a glob of
+// Config.Include, Config.Exclude or Hook.Pattern. Globs are matched against
+// the path relative to the project root, as described for fs.MatchGlob.
+func (a *App) matchGlob(pattern, path string) bool {
+	rel, err := filepath.Rel(filepath.Dir(a.stateManager.StateDir), path)
+	if err != nil {
+		rel = path
+	}
+	return fs.MatchGlob(pattern, rel)
+}
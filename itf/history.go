@@ -0,0 +1,219 @@
+package itf
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"slices"
+	"time"
+
+	"github.com/sokinpui/itf.go/internal/state"
+	"github.com/sokinpui/itf.go/model"
+)
+
+// stepFunc reverts or redoes the operations of one history entry.
+type stepFunc func(ops []state.Operation, stateDir string, progressCb func(int)) (succeeded []string, failed []model.Failure)
+
+// History returns the recorded history entries, most recent first.
+func (a *App) History() []model.HistoryEntry {
+	wd, _ := os.Getwd()
+	entries := a.stateManager.Entries()
+	current := a.stateManager.CurrentIndex()
+
+	history := make([]model.HistoryEntry, 0, len(entries))
+	for i := len(entries) - 1; i >= 0; i-- {
+		entry := model.HistoryEntry{
+			ID:        i + 1,
+			Timestamp: time.Unix(entries[i].Timestamp, 0),
+			Current:   i == current,
+			Undone:    i > current,
+		}
+		for _, op := range entries[i].Operations {
+			histOp := model.HistoryOperation{Action: op.Action, Path: relativePath(wd, op.Path)}
+			if op.NewPath != "" {
+				histOp.NewPath = relativePath(wd, op.NewPath)
+			}
+			entry.Operations = append(entry.Operations, histOp)
+		}
+		history = append(history, entry)
+	}
+	return history
+}
+
+// historySteps returns the number of entries to undo or redo, based on
+// Config.Steps and Config.ToEntry.
+func (a *App) historySteps(undo bool) (int, error) {
+	if a.cfg.ToEntry == 0 {
+		if a.cfg.Steps < 0 {
+			return 0, fmt.Errorf("invalid number of steps: %d", a.cfg.Steps)
+		}
+		return max(a.cfg.Steps, 1), nil
+	}
+
+	// Entry IDs are 1-based, so the current entry has ID current+1.
+	current := a.stateManager.CurrentIndex() + 1
+	total := len(a.stateManager.Entries())
+	if a.cfg.ToEntry < 0 || a.cfg.ToEntry > total {
+		return 0, fmt.Errorf("no history entry #%d", a.cfg.ToEntry)
+	}
+	if a.cfg.ToEntry == current {
+		return 0, fmt.Errorf("already at entry #%d", a.cfg.ToEntry)
+	}
+	if undo {
+		if a.cfg.ToEntry > current {
+			return 0, fmt.Errorf("entry #%d is undone; use redo to return to it", a.cfg.ToEntry)
+		}
+		return current - a.cfg.ToEntry, nil
+	}
+	if a.cfg.ToEntry < current {
+		return 0, fmt.Errorf("entry #%d is already applied; use undo to return to it", a.cfg.ToEntry)
+	}
+	return a.cfg.ToEntry - current, nil
+}
+
+// undoOperations handles the undo logic. Every file is checked before
+// anything is undone, so a conflict leaves the tree untouched.
+func (a *App) undoOperations(ctx context.Context) (model.Summary, error) {
+	steps, err := a.historySteps(true)
+	if err != nil {
+		return model.Summary{}, err
+	}
+	entries := a.stateManager.EntriesToUndo(steps)
+	if len(entries) == 0 {
+		return model.Summary{Message: "No operation to undo."}, nil
+	}
+
+	if conflicts := a.stateManager.VerifyUndo(entries); len(conflicts) > 0 {
+		summary := model.Summary{
+			Failed:  conflicts,
+			Message: "Nothing was undone: some files changed since they were recorded.",
+		}
+		a.relativizeSummaryPaths(&summary)
+		return summary, nil
+	}
+
+	manager, err := a.newBackend()
+	if err != nil {
+		return model.Summary{}, err
+	}
+	defer manager.Close()
+
+	undone, failed, count, err := a.walkHistory(ctx, entries, -1, manager.UndoFiles)
+
+	summary := model.Summary{
+		Modified:     undone,
+		Failed:       failed,
+		HistoryEntry: a.stateManager.CurrentIndex() + 1,
+		Message:      historyMessage("Undid", "last operation", count, len(entries)),
+	}
+	if err != nil {
+		summary.Message = fmt.Sprintf("Undid %d of %d operations before being cancelled.", count, len(entries))
+	}
+	a.relativizeSummaryPaths(&summary)
+	return summary, err
+}
+
+// redoOperations handles the redo logic. Like undo, every file is checked
+// before anything is redone.
+func (a *App) redoOperations(ctx context.Context) (model.Summary, error) {
+	steps, err := a.historySteps(false)
+	if err != nil {
+		return model.Summary{}, err
+	}
+	entries := a.stateManager.EntriesToRedo(steps)
+	if len(entries) == 0 {
+		return model.Summary{Message: "No operation to redo."}, nil
+	}
+
+	if conflicts := a.stateManager.VerifyRedo(entries); len(conflicts) > 0 {
+		summary := model.Summary{
+			Failed:  conflicts,
+			Message: "Nothing was redone: some files changed since they were undone.",
+		}
+		a.relativizeSummaryPaths(&summary)
+		return summary, nil
+	}
+
+	manager, err := a.newBackend()
+	if err != nil {
+		return model.Summary{}, err
+	}
+	defer manager.Close()
+
+	redone, failed, count, err := a.walkHistory(ctx, entries, 1, manager.RedoFiles)
+
+	summary := model.Summary{
+		Modified:     redone,
+		Failed:       failed,
+		HistoryEntry: a.stateManager.CurrentIndex() + 1,
+		Message:      historyMessage("Redid", "last undone operation", count, len(entries)),
+	}
+	if err != nil {
+		summary.Message = fmt.Sprintf("Redid %d of %d operations before being cancelled.", count, len(entries))
+	}
+	a.relativizeSummaryPaths(&summary)
+	return summary, err
+}
+
+// walkHistory runs step on each entry in order, moving the history pointer
+// by delta after each one. It stops after the first entry with failures,
+// since the entries after it depend on its files, and before the next entry
+// if ctx is cancelled, returning ctx's error.
+func (a *App) walkHistory(ctx context.Context, entries []state.HistoryEntry, delta int, step stepFunc) (succeeded []string, failed []model.Failure, count int, err error) {
+	total := 0
+	for _, entry := range entries {
+		total += len(entry.Operations)
+	}
+	if a.progressCallback != nil {
+		a.progressCallback(0, total)
+	}
+
+	offset := 0
+	for _, entry := range entries {
+		if err := ctx.Err(); err != nil {
+			return succeeded, failed, count, err
+		}
+		var progressCb func(int)
+		if a.progressCallback != nil {
+			base := offset
+			progressCb = func(current int) {
+				a.progressCallback(base+current, total)
+			}
+		}
+
+		done, stepFailed := step(entry.Operations, a.stateManager.StateDir, progressCb)
+		succeeded = appendUnique(succeeded, done)
+		failed = append(failed, stepFailed...)
+		offset += len(entry.Operations)
+		count++
+
+		a.stateManager.SetCurrentIndex(a.stateManager.CurrentIndex() + delta)
+		if len(stepFailed) > 0 {
+			break
+		}
+	}
+	return succeeded, failed, count, nil
+}
+
+// historyMessage describes how many entries an undo or redo went through.
+func historyMessage(verb, single string, count, requested int) string {
+	switch {
+	case requested == 1:
+		return fmt.Sprintf("%s %s.", verb, single)
+	case count < requested:
+		return fmt.Sprintf("%s %d of %d operations, stopped at a failure.", verb, count, requested)
+	default:
+		return fmt.Sprintf("%s %d operations.", verb, count)
+	}
+}
+
+// appendUnique appends the paths not already in list, so a file touched by
+// several entries is reported once.
+func appendUnique(list, paths []string) []string {
+	for _, p := range paths {
+		if !slices.Contains(list, p) {
+			list = append(list, p)
+		}
+	}
+	return list
+}
@@ -0,0 +1,92 @@
+package itf
+
+import (
+	"context"
+	"errors"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/sokinpui/itf.go/model"
+)
+
+// Hook is a command run through the shell after changes are saved to disk,
+// such as a formatter, a build or tests.
+type Hook struct {
+	// Pattern selects the files the hook runs for, as a glob matched against
+	// the path of each written file relative to the project root, like
+	// Config.Include, e.g., "*.go" or "cmd/**/*.go". The hook runs once for
+	// each matching file, with "{file}" in Command replaced by its path
+	// relative to the working directory. If Pattern is empty, the hook runs
+	// once per run that changed any file, with "{files}" replaced by the
+	// paths of all written files.
+	Pattern string
+	Command string
+}
+
+// runHooks runs the configured hooks for the files written by a run, in
+// order, and returns their results. Per-run hooks run if changed is set,
+// even if no file was written, e.g., for a run that only deletes files.
+// Cancelling ctx stops the running hook, and the hooks after it are not run.
+func (a *App) runHooks(ctx context.Context, files []string, changed bool) []model.HookResult {
+	if len(a.cfg.Hooks) == 0 || !changed {
+		return nil
+	}
+
+	wd, _ := os.Getwd()
+	relFiles := make([]string, len(files))
+	for i, path := range files {
+		relFiles[i] = relativePath(wd, path)
+	}
+
+	var results []model.HookResult
+	for _, hook := range a.cfg.Hooks {
+		if ctx.Err() != nil {
+			break
+		}
+		if hook.Pattern == "" {
+			quoted := make([]string, len(relFiles))
+			for i, path := range relFiles {
+				quoted[i] = shellQuote(path)
+			}
+			results = append(results, runHook(ctx, strings.ReplaceAll(hook.Command, "{files}", strings.Join(quoted, " "))))
+			continue
+		}
+		for i, path := range files {
+			if a.matchGlob(hook.Pattern, path) {
+				results = append(results, runHook(ctx, strings.ReplaceAll(hook.Command, "{file}", shellQuote(relFiles[i]))))
+			}
+		}
+	}
+	return results
+}
+
+// hookWaitDelay is how long a cancelled hook's output is waited for after
+// the shell is killed, as commands it started may hold it open.
+const hookWaitDelay = time.Second
+
+// runHook runs a command through the shell and records its outcome.
+func runHook(ctx context.Context, command string) model.HookResult {
+	cmd := exec.CommandContext(ctx, "sh", "-c", command)
+	cmd.WaitDelay = hookWaitDelay
+	output, err := cmd.CombinedOutput()
+	result := model.HookResult{Command: command, Output: strings.TrimRight(string(output), "\n")}
+	var exitErr *exec.ExitError
+	switch {
+	case ctx.Err() != nil:
+		result.ExitCode = -1
+		result.Output = strings.TrimLeft(result.Output+"\n"+ctx.Err().Error(), "\n")
+	case errors.As(err, &exitErr):
+		result.ExitCode = exitErr.ExitCode()
+	case err != nil:
+		result.ExitCode = -1
+		result.Output = err.Error()
+	}
+	return result
+}
+
+// shellQuote quotes s as a single shell word.
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
@@ -1,29 +1,54 @@
 package itf
 
 import (
+	"context"
 	"fmt"
+	"slices"
 )
 
 // Apply parses the given content string and applies the changes to files.
 // It returns a summary of the operations in a map.
+//
+// Deprecated: Use Parse and ApplyPlan, which report renames, deletions and
+// the other results, and take a context.
 func Apply(content string, config Config) (map[string][]string, error) {
-	app, err := New(&config)
+	ctx := context.Background()
+	opts := Options{
+		Extensions:     config.Extensions,
+		FuzzyThreshold: config.FuzzyThreshold,
+		Partial:        config.Partial,
+		MergeGo:        config.MergeGo,
+		Include:        config.Include,
+		Exclude:        config.Exclude,
+		PathHints:      config.PathHints,
+		Backend:        config.Backend,
+		Buffer:         config.Buffer,
+		Validate:       config.Validate,
+		Validators:     config.Validators,
+		Hooks:          config.Hooks,
+	}
+	plan, err := Parse(ctx, content, opts)
 	if err != nil {
-		return nil, fmt.Errorf("failed to initialize itf app: %w", err)
+		return nil, err
 	}
-
-	summary, err := app.processAndApply(content)
+	result, err := ApplyPlan(ctx, plan, opts)
 	if err != nil {
 		return nil, err
 	}
 
-	result := map[string][]string{
-		"Created":  summary.Created,
-		"Modified": summary.Modified,
-		"Failed":   summary.Failed,
+	// Failed holds paths, once each, as it did before failures had reasons.
+	var failed []string
+	for _, f := range result.Failed {
+		if !slices.Contains(failed, f.Path) {
+			failed = append(failed, f.Path)
+		}
 	}
 
-	return result, nil
+	return map[string][]string{
+		"Created":  result.Created,
+		"Modified": result.Modified,
+		"Failed":   failed,
+	}, nil
 }
 
 func GetToolCall(content string, config Config) (string, error) {
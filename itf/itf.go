@@ -1,12 +1,17 @@
 package itf
 
 import (
+	"context"
 	"fmt"
 	"os"
+	"os/exec"
 	"path/filepath"
 	"runtime/debug"
+	"slices"
+	"sort"
 	"strings"
 
+	"github.com/sokinpui/itf.go/internal/backend"
 	"github.com/sokinpui/itf.go/internal/fs"
 	"github.com/sokinpui/itf.go/internal/nvim"
 	"github.com/sokinpui/itf.go/internal/parser"
@@ -18,17 +23,55 @@ import (
 
 // Config holds the core application configuration.
 type Config struct {
-	Buffer        bool
-	OutputTool    bool
-	OutputDiffFix bool
-	Undo          bool
-	Redo          bool
-	Extensions    []string
+	Buffer         bool
+	OutputTool     bool
+	OutputDiffFix  bool
+	DryRun         bool
+	Interactive    bool
+	Undo           bool
+	Redo           bool
+	Steps          int // Number of history entries to undo or redo; 0 means 1
+	ToEntry        int // History entry ID to undo or redo to; 0 means use Steps
+	Extensions     []string
+	Backend        string            // "nvim", "fs", or empty to pick automatically
+	Feedback       string            // Where to write a report of failures: "stdout", "clipboard", or empty for none
+	FuzzyThreshold float64           // Minimum similarity (0 to 1) to place a hunk not found verbatim; 0 disables fuzzy matching
+	Partial        bool              // Apply the hunks of a diff that match even if others do not
+	MergeGo        bool              // Merge every block for an existing .go file by declaration instead of replacing the file
+	Validate       string            // What to do with changes that fail validation: "skip" (default), "warn" or "off"
+	Validators     map[string]string // Validator commands by file extension, e.g., ".py": "python -m py_compile {}"
+	Hooks          []Hook            // Commands run after the changes are saved
+	Include        []string          // Globs of the files that may be changed; empty for all files
+	Exclude        []string          // Globs of the files that must not be changed
+	PathHints      []string          // Sources of the paths of file blocks in order of precedence, e.g., PathHintInfo; nil for all but PathHintHeading
+	Output         string            // Format of printed results: "text" (default), "json" or "ndjson"
 }
 
+// Backend names accepted by Config.Backend.
+const (
+	BackendAuto       = ""
+	BackendNeovim     = "nvim"
+	BackendFilesystem = "fs"
+)
+
+// Sources of the paths of file blocks accepted by Config.PathHints. When
+// several name a path, the first one in Config.PathHints is used. Without
+// Config.PathHints, all but PathHintHeading are used, in this order.
+const (
+	PathHintInfo      = parser.HintInfo      // The info string: ```go title="main.go"```, ```go:main.go``` or ```go main.go```
+	PathHintParagraph = parser.HintParagraph // The paragraph before the block: `main.go` or **main.go**
+	PathHintHeading   = parser.HintHeading   // The heading before the block: ### main.go
+	PathHintComment   = parser.HintComment   // A comment on the first line of the block: // File: main.go
+)
+
 // ProgressUpdate is a callback function to report progress.
 type ProgressUpdate func(current, total int)
 
+// Reviewer lets the user decide which planned operations to apply. It is
+// called with every item accepted and returns the items with the user's
+// decisions.
+type Reviewer func(items []model.ReviewItem) ([]model.ReviewItem, error)
+
 // App orchestrates the entire application logic.
 type App struct {
 	cfg              *Config
@@ -36,6 +79,7 @@ type App struct {
 	pathResolver     *fs.PathResolver
 	sourceProvider   *source.SourceProvider
 	progressCallback ProgressUpdate
+	reviewer         Reviewer
 }
 
 // DetailedError enhances a standard error with a stack trace.
@@ -65,11 +109,22 @@ func New(cfg *Config) (*App, error) {
 	}, nil
 }
 
+// patchOptions returns the options for locating and merging changes.
+func (a *App) patchOptions() patcher.Options {
+	return patcher.Options{FuzzyThreshold: a.cfg.FuzzyThreshold, Partial: a.cfg.Partial, MergeGo: a.cfg.MergeGo}
+}
+
 // SetProgressCallback sets a function to be called for progress updates.
 func (a *App) SetProgressCallback(cb ProgressUpdate) {
 	a.progressCallback = cb
 }
 
+// SetReviewer sets a function to review the plan before it is applied.
+// It is only called when Config.Interactive is set.
+func (a *App) SetReviewer(r Reviewer) {
+	a.reviewer = r
+}
+
 // Execute executes the main application logic based on parsed flags.
 func (a *App) Execute() (summary model.Summary, err error) {
 	// Centralized panic recovery.
@@ -82,59 +137,297 @@ func (a *App) Execute() (summary model.Summary, err error) {
 		}
 	}()
 
+	ctx := context.Background()
 	switch {
 	case a.cfg.Undo:
-		return a.undoLastOperation()
+		return a.undoOperations(ctx)
 	case a.cfg.Redo:
-		return a.redoLastOperation()
+		return a.redoOperations(ctx)
 	case a.cfg.OutputTool:
 		return a.printTools()
 	case a.cfg.OutputDiffFix:
 		return a.fixAndPrintDiffs()
+	case a.cfg.DryRun:
+		return a.printPlan()
 	default:
-		return a.processContent()
+		return a.processContent(ctx)
 	}
 }
 
 // processContent handles the core logic of parsing source, planning changes,
 // and applying them in Neovim.
-func (a *App) processContent() (model.Summary, error) {
+func (a *App) processContent(ctx context.Context) (model.Summary, error) {
 	content, err := a.sourceProvider.GetContent()
 	if err != nil {
 		return model.Summary{}, err
 	}
-	return a.processAndApply(content)
+	summary, err := a.processAndApply(ctx, content)
+	if err != nil || a.cfg.Feedback == "" {
+		return summary, err
+	}
+	return a.writeFeedback(summary)
 }
 
 // processAndApply is the core logic of processing content and applying changes.
-func (a *App) processAndApply(content string) (model.Summary, error) {
+func (a *App) processAndApply(ctx context.Context, content string) (model.Summary, error) {
 	if content == "" {
 		return model.Summary{Message: "Source is empty. Nothing to process."}, nil
 	}
 
-	plan, err := parser.CreatePlan(content, a.pathResolver, a.cfg.Extensions)
+	plan, err := a.createPlan(content)
 	if err != nil {
-		return model.Summary{}, fmt.Errorf("failed to create execution plan: %w", err)
+		return model.Summary{}, err
 	}
-	if len(plan.Changes) == 0 && len(plan.Failed) == 0 && len(plan.Deletes) == 0 && len(plan.Renames) == 0 {
+	if !hasOperations(plan) && len(plan.Failed) == 0 {
 		return model.Summary{Message: "No valid changes were generated. Nothing to do."}, nil
 	}
 
+	if a.cfg.Interactive && a.reviewer != nil {
+		plan, err = a.reviewPlan(plan)
+		if err != nil {
+			return model.Summary{}, err
+		}
+		if !hasOperations(plan) {
+			summary := model.Summary{Failed: plan.Failed, Message: "No changes were accepted. Nothing to do."}
+			a.relativizeSummaryPaths(&summary)
+			return summary, nil
+		}
+	}
+
+	return a.applyPlan(ctx, plan)
+}
+
+// createPlan parses content into an execution plan, without the operations
+// excluded by Config.Include and Config.Exclude.
+func (a *App) createPlan(content string) (*parser.ExecutionPlan, error) {
+	plan, err := parser.CreatePlan(content, a.pathResolver, a.cfg.Extensions, a.cfg.PathHints, a.patchOptions())
+	if err != nil {
+		return nil, fmt.Errorf("failed to create execution plan: %w", err)
+	}
+	return a.filterPlan(plan), nil
+}
+
+// applyPlan validates the plan, creates the directories it needs and applies
+// it. ctx is only checked before anything is written; once files are being
+// changed, the run is completed so that it is recorded in the history.
+func (a *App) applyPlan(ctx context.Context, plan *parser.ExecutionPlan) (model.Summary, error) {
+	plan = a.validatePlan(ctx, plan)
+	if err := ctx.Err(); err != nil {
+		return model.Summary{}, err
+	}
 	if err := fs.CreateDirs(plan.DirsToCreate); err != nil {
 		return model.Summary{}, err
 	}
 
-	return a.applyChanges(plan)
+	return a.applyChanges(ctx, plan)
+}
+
+// hasOperations reports whether the plan changes any file.
+func hasOperations(plan *parser.ExecutionPlan) bool {
+	return len(plan.Changes) > 0 || len(plan.Deletes) > 0 || len(plan.Renames) > 0 || len(plan.Chmods) > 0
+}
+
+// Plan parses content and describes the changes it would make, without
+// creating directories, touching files, starting Neovim or writing state.
+// It returns the planned entries and the files that failed during planning.
+func (a *App) Plan(content string) ([]model.PlanEntry, []model.Failure, error) {
+	if content == "" {
+		return nil, nil, nil
+	}
+
+	plan, err := a.createPlan(content)
+	if err != nil {
+		return nil, nil, err
+	}
+	return describePlan(plan), plan.Failed, nil
+}
+
+// describePlan converts an execution plan into entries with a diff against
+// the current contents of each file.
+func describePlan(plan *parser.ExecutionPlan) []model.PlanEntry {
+	wd, _ := os.Getwd()
+	var entries []model.PlanEntry
+
+	changes := append([]model.FileChange(nil), plan.Changes...)
+	sort.Slice(changes, func(i, j int) bool {
+		return changes[i].Path < changes[j].Path
+	})
+	for _, change := range changes {
+		entries = append(entries, describeChange(wd, change, plan.FileActions[change.Path]))
+	}
+	for _, path := range plan.Deletes {
+		entries = append(entries, describeDelete(wd, path))
+	}
+	for _, r := range plan.Renames {
+		entries = append(entries, describeRename(wd, r))
+	}
+	for _, c := range plan.Chmods {
+		entries = append(entries, describeChmod(c))
+	}
+	return entries
+}
+
+func describeChange(wd string, change model.FileChange, action string) model.PlanEntry {
+	relPath := relativePath(wd, change.Path)
+	oldName := "a/" + relPath
+	oldLines, err := fs.ReadLines(change.Path)
+	if err != nil {
+		oldName = "/dev/null"
+		oldLines = nil
+	}
+	return model.PlanEntry{
+		Action: action,
+		Path:   change.Path,
+		Source: change.Source,
+		Diff:   patcher.UnifiedDiff(oldName, "b/"+relPath, oldLines, change.Content),
+	}
+}
+
+func describeDelete(wd, path string) model.PlanEntry {
+	entry := model.PlanEntry{Action: "delete", Path: path}
+	if oldLines, err := fs.ReadLines(path); err == nil {
+		entry.Diff = patcher.UnifiedDiff("a/"+relativePath(wd, path), "/dev/null", oldLines, nil)
+	}
+	return entry
+}
+
+func describeRename(wd string, r model.FileRename) model.PlanEntry {
+	entry := model.PlanEntry{
+		Action:  "rename",
+		Path:    r.OldPath,
+		NewPath: r.NewPath,
+	}
+	if r.Content != nil {
+		if oldLines, err := fs.ReadLines(r.OldPath); err == nil {
+			entry.Diff = patcher.UnifiedDiff("a/"+relativePath(wd, r.OldPath), "b/"+relativePath(wd, r.NewPath), oldLines, r.Content)
+		}
+	}
+	return entry
+}
+
+func describeChmod(c model.FileChmod) model.PlanEntry {
+	entry := model.PlanEntry{Action: "chmod", Path: c.Path}
+	if info, err := os.Stat(c.Path); err == nil {
+		entry.Diff = fmt.Sprintf("old mode %o\n", info.Mode().Perm())
+	}
+	entry.Diff += fmt.Sprintf("new mode %o\n", c.Mode)
+	return entry
 }
 
-func (a *App) deleteFiles(paths []string) (succeeded, failed []string) {
+// reviewPlan passes the plan to the reviewer and returns a new plan with only
+// the accepted operations. Changes sourced from diffs can be reviewed hunk by
+// hunk; their content is rebuilt from the accepted hunks.
+func (a *App) reviewPlan(plan *parser.ExecutionPlan) (*parser.ExecutionPlan, error) {
+	changesByPath := make(map[string]model.FileChange, len(plan.Changes))
+	for _, change := range plan.Changes {
+		changesByPath[change.Path] = change
+	}
+	renamesByPath := make(map[string]model.FileRename, len(plan.Renames))
+	for _, rename := range plan.Renames {
+		renamesByPath[rename.OldPath] = rename
+	}
+	chmodsByPath := make(map[string]model.FileChmod, len(plan.Chmods))
+	for _, chmod := range plan.Chmods {
+		chmodsByPath[chmod.Path] = chmod
+	}
+
+	entries := describePlan(plan)
+	items := make([]model.ReviewItem, len(entries))
+	for i, entry := range entries {
+		items[i] = model.ReviewItem{PlanEntry: entry, Accepted: true}
+		if !isPatchSource(entry.Source) || entry.Action != "modify" {
+			continue
+		}
+		oldLines, err := fs.ReadLines(entry.Path)
+		if err != nil {
+			continue
+		}
+		for _, h := range patcher.DiffHunks(oldLines, changesByPath[entry.Path].Content) {
+			items[i].Hunks = append(items[i].Hunks, model.ReviewHunk{Content: h, Accepted: true})
+		}
+	}
+
+	reviewed, err := a.reviewer(items)
+	if err != nil {
+		return nil, fmt.Errorf("review failed: %w", err)
+	}
+
+	var changes []model.FileChange
+	var deletes []string
+	var renames []model.FileRename
+	var chmods []model.FileChmod
+	failed := plan.Failed
+	for _, item := range reviewed {
+		if !item.Accepted {
+			continue
+		}
+		switch item.Action {
+		case "delete":
+			deletes = append(deletes, item.Path)
+		case "rename":
+			renames = append(renames, renamesByPath[item.Path])
+		case "chmod":
+			chmods = append(chmods, chmodsByPath[item.Path])
+		default:
+			change := changesByPath[item.Path]
+			if len(item.Hunks) > 0 {
+				content, err := applyAcceptedHunks(change.Path, item.Hunks)
+				if err != nil {
+					failed = append(failed, patcher.Failures(change.Path, err)...)
+					continue
+				}
+				if content == nil {
+					continue // No hunk was accepted.
+				}
+				change.Content = content
+			}
+			changes = append(changes, change)
+		}
+	}
+	return parser.NewExecutionPlan(changes, deletes, renames, chmods, failed), nil
+}
+
+// isPatchSource reports whether a change was produced by patching the
+// current file, rather than by replacing its whole content.
+func isPatchSource(source string) bool {
+	return source == "diff" || source == "patch" || source == "edit"
+}
+
+// applyAcceptedHunks applies the accepted hunks to the current content of a
+// file. It returns nil if no hunk was accepted.
+func applyAcceptedHunks(path string, hunks []model.ReviewHunk) ([]string, error) {
+	var accepted []string
+	for _, h := range hunks {
+		if h.Accepted {
+			accepted = append(accepted, h.Content)
+		}
+	}
+	if len(accepted) == 0 {
+		return nil, nil
+	}
+
+	oldLines, err := fs.ReadLines(path)
+	if err != nil {
+		return nil, err
+	}
+	patched, _, err := patcher.ApplyHunks(oldLines, strings.Join(accepted, ""))
+	if err != nil {
+		return nil, err
+	}
+	return patched, nil
+}
+
+func (a *App) deleteFiles(paths []string) (succeeded []string, failed []model.Failure) {
 	if len(paths) == 0 {
 		return nil, nil
 	}
 
 	trashPath := filepath.Join(a.stateManager.StateDir, state.TrashDir)
 	if err := os.MkdirAll(trashPath, 0755); err != nil {
-		return nil, paths
+		for _, path := range paths {
+			failed = append(failed, model.Failure{Path: path, Stage: model.StageApply, Err: err})
+		}
+		return nil, failed
 	}
 
 	wd, _ := os.Getwd()
@@ -144,7 +437,7 @@ func (a *App) deleteFiles(paths []string) (succeeded, failed []string) {
 			continue
 		}
 		if err := fs.TrashFile(path, trashPath, wd); err != nil {
-			failed = append(failed, path)
+			failed = append(failed, model.Failure{Path: path, Stage: model.StageApply, Err: err})
 		} else {
 			succeeded = append(succeeded, path)
 		}
@@ -152,41 +445,165 @@ func (a *App) deleteFiles(paths []string) (succeeded, failed []string) {
 	return succeeded, failed
 }
 
-func (a *App) renameFiles(renames []model.FileRename) (map[string]string, []string) {
+// renameFiles renames files on disk, writing the new content of renames
+// that also change it through the backend. A rename whose content cannot be
+// written is rolled back.
+func (a *App) renameFiles(renames []model.FileRename, manager backend.Backend) (map[string]string, []model.Failure) {
 	if len(renames) == 0 {
 		return nil, nil
 	}
 
 	succeeded := make(map[string]string)
-	var failed []string
+	var failed []model.Failure
+	wd, _ := os.Getwd()
 
 	for _, r := range renames {
-		if _, err := os.Stat(r.OldPath); os.IsNotExist(err) {
-			failed = append(failed, fmt.Sprintf("%s -> %s (source not found)", r.OldPath, r.NewPath))
+		fail := func(err error) {
+			failed = append(failed, model.Failure{
+				Path:  r.OldPath,
+				Stage: model.StageApply,
+				Err:   fmt.Errorf("rename to %s: %w", relativePath(wd, r.NewPath), err),
+			})
+		}
+		if _, err := os.Stat(r.OldPath); err != nil {
+			fail(err)
 			continue
 		}
 		if err := os.Rename(r.OldPath, r.NewPath); err != nil {
-			failed = append(failed, fmt.Sprintf("%s -> %s", r.OldPath, r.NewPath))
-		} else {
-			succeeded[r.OldPath] = r.NewPath
+			fail(err)
+			continue
+		}
+		if r.Content != nil {
+			change := model.FileChange{Path: r.NewPath, Content: r.Content}
+			if _, writeFailed := manager.ApplyChanges([]model.FileChange{change}, nil); len(writeFailed) > 0 {
+				os.Rename(r.NewPath, r.OldPath)
+				fail(writeFailed[0].Err)
+				continue
+			}
 		}
+		succeeded[r.OldPath] = r.NewPath
 	}
 	return succeeded, failed
 }
 
-// applyChanges connects to Neovim and applies the planned file changes.
-func (a *App) applyChanges(plan *parser.ExecutionPlan) (model.Summary, error) {
-	manager, err := nvim.New()
+// chmodFiles sets the permission bits of files whose other changes, if any,
+// succeeded. It returns the mode change of each file, keyed by the path its
+// history operation is recorded under, the files whose only change is their
+// mode, and the failures.
+func (a *App) chmodFiles(plan *parser.ExecutionPlan, updated []string, renamed map[string]string) (map[string]state.ModeChange, []string, []model.Failure) {
+	if len(plan.Chmods) == 0 {
+		return nil, nil, nil
+	}
+
+	done := make(map[string]string, len(updated)+len(renamed))
+	for _, path := range updated {
+		done[path] = path
+	}
+	for oldPath, newPath := range renamed {
+		done[newPath] = oldPath
+	}
+
+	modes := make(map[string]state.ModeChange)
+	var chmodded []string
+	var failed []model.Failure
+	for _, c := range plan.Chmods {
+		action := plan.FileActions[c.Path]
+		opPath, ok := done[c.Path]
+		if action == "chmod" {
+			opPath, ok = c.Path, true
+		}
+		if !ok {
+			continue // The content change of the file failed.
+		}
+
+		info, err := os.Stat(c.Path)
+		if err == nil {
+			err = os.Chmod(c.Path, c.Mode)
+		}
+		if err != nil {
+			failed = append(failed, model.Failure{Path: c.Path, Stage: model.StageApply, Err: err})
+			continue
+		}
+
+		change := state.ModeChange{Old: info.Mode().Perm(), New: c.Mode}
+		if action == "create" {
+			change.Old = 0
+		}
+		modes[opPath] = change
+		if action == "chmod" {
+			chmodded = append(chmodded, c.Path)
+		}
+	}
+	return modes, chmodded, failed
+}
+
+// newBackend creates the backend selected in the config. When none is
+// selected, Neovim is used if it is running or on the PATH, and the
+// filesystem otherwise.
+func (a *App) newBackend() (backend.Backend, error) {
+	name := a.cfg.Backend
+	if name == BackendAuto {
+		name = BackendFilesystem
+		if os.Getenv("NVIM_LISTEN_ADDRESS") != "" {
+			name = BackendNeovim
+		} else if _, err := exec.LookPath("nvim"); err == nil {
+			name = BackendNeovim
+		}
+	}
+
+	switch name {
+	case BackendNeovim:
+		manager, err := nvim.New()
+		if err != nil {
+			return nil, err
+		}
+		return manager, nil
+	case BackendFilesystem:
+		if a.cfg.Buffer {
+			return nil, fmt.Errorf("--buffer requires the Neovim backend")
+		}
+		return backend.NewFilesystem(), nil
+	default:
+		return nil, fmt.Errorf("unknown backend: %s", name)
+	}
+}
+
+// applyChanges applies the planned file changes through the backend.
+func (a *App) applyChanges(ctx context.Context, plan *parser.ExecutionPlan) (model.Summary, error) {
+	manager, err := a.newBackend()
 	if err != nil {
 		return model.Summary{}, err
 	}
 	defer manager.Close()
 
+	// Snapshot modified files, and renamed files whose content changes, so
+	// they can be restored on undo.
+	var prevHashes map[string]string
+	if !a.cfg.Buffer {
+		var modified []string
+		for _, change := range plan.Changes {
+			if plan.FileActions[change.Path] == "modify" {
+				modified = append(modified, change.Path)
+			}
+		}
+		for _, rename := range plan.Renames {
+			if rename.Content != nil {
+				modified = append(modified, rename.OldPath)
+			}
+		}
+		prevHashes = a.stateManager.Snapshot(modified)
+	}
+
 	deletedFiles, failedDeletes := a.deleteFiles(plan.Deletes)
-	renamedFilesMap, failedRenames := a.renameFiles(plan.Renames)
+	renamedFilesMap, failedRenames := a.renameFiles(plan.Renames, manager)
+	// Renames are listed in plan order, so that the summary is stable.
 	renamedFilesForSummary := []string{}
-	for old, new := range renamedFilesMap {
-		renamedFilesForSummary = append(renamedFilesForSummary, fmt.Sprintf("%s -> %s", old, new))
+	successfulRenameOldPaths := []string{}
+	for _, rename := range plan.Renames {
+		if newPath, renamed := renamedFilesMap[rename.OldPath]; renamed && !slices.Contains(successfulRenameOldPaths, rename.OldPath) {
+			renamedFilesForSummary = append(renamedFilesForSummary, fmt.Sprintf("%s -> %s", rename.OldPath, newPath))
+			successfulRenameOldPaths = append(successfulRenameOldPaths, rename.OldPath)
+		}
 	}
 
 	total := len(plan.Changes)
@@ -199,21 +616,40 @@ func (a *App) applyChanges(plan *parser.ExecutionPlan) (model.Summary, error) {
 	}
 
 	updatedFiles, failedFromNvim := manager.ApplyChanges(plan.Changes, nvimProgressCb)
-	allFailedFiles := append(plan.Failed, append(failedFromNvim, append(failedDeletes, failedRenames...)...)...)
+	allFailedFiles := slices.Concat(plan.Failed, failedFromNvim, failedDeletes, failedRenames)
 
 	// Categorize files for the summary.
 	diffApplied := []string{}
 	modifiedByExt := []string{}
 	created := []string{}
 
-	changeSourceMap := make(map[string]string, len(plan.Changes))
+	changesByPath := make(map[string]model.FileChange, len(plan.Changes))
 	for _, change := range plan.Changes {
-		changeSourceMap[change.Path] = change.Source
+		changesByPath[change.Path] = change
 	}
 
+	var fuzzy []model.FuzzyMatch
+	var offsets []model.OffsetMatch
+	var partial []model.PartialPatch
+	addPartial := func(p model.PartialPatch) {
+		rejectFile, err := a.writeRejects(p)
+		if err != nil {
+			allFailedFiles = append(allFailedFiles, model.Failure{Path: p.Path, Stage: model.StageApply, Err: err})
+		}
+		p.RejectFile = rejectFile
+		partial = append(partial, p)
+	}
 	for _, path := range updatedFiles {
 		action := plan.FileActions[path]
-		source := changeSourceMap[path]
+		change := changesByPath[path]
+		source := change.Source
+		fuzzy = append(fuzzy, change.Fuzzy...)
+		offsets = append(offsets, change.Offsets...)
+
+		if change.Partial != nil {
+			addPartial(*change.Partial)
+			continue
+		}
 
 		if action == "create" {
 			created = append(created, path)
@@ -226,55 +662,185 @@ func (a *App) applyChanges(plan *parser.ExecutionPlan) (model.Summary, error) {
 		}
 	}
 
-	successfulRenameOldPaths := []string{}
-	for oldPath := range renamedFilesMap {
-		successfulRenameOldPaths = append(successfulRenameOldPaths, oldPath)
+	for _, rename := range plan.Renames {
+		if _, renamed := renamedFilesMap[rename.OldPath]; renamed && rename.Partial != nil {
+			addPartial(*rename.Partial)
+		}
 	}
+
 	allUpdatedFiles := append(append(updatedFiles, deletedFiles...), successfulRenameOldPaths...)
 
-	if len(allUpdatedFiles) > 0 {
-		if !a.cfg.Buffer { // Save by default
-			manager.SaveAllBuffers()
-			ops := a.stateManager.CreateOperations(allUpdatedFiles, plan.FileActions, plan.Renames)
+	var chmodded []string
+	var modes map[string]state.ModeChange
+	var hooks []model.HookResult
+	var historyEntry int
+	if !a.cfg.Buffer && (len(allUpdatedFiles) > 0 || len(plan.Chmods) > 0) {
+		// Modes are set on disk, so the buffers are saved first.
+		if err := manager.SaveAllBuffers(); err != nil {
+			// Unsaved files are not on disk, so they are left out of the
+			// history.
+			for _, path := range updatedFiles {
+				allFailedFiles = append(allFailedFiles, model.Failure{Path: path, Stage: model.StageSave, Err: err})
+			}
+			created, diffApplied, modifiedByExt, fuzzy, offsets, partial = nil, nil, nil, nil, nil, nil
+			allUpdatedFiles = slices.DeleteFunc(allUpdatedFiles, func(path string) bool {
+				return slices.Contains(updatedFiles, path)
+			})
+			updatedFiles = nil
+		}
+		var failedChmods []model.Failure
+		modes, chmodded, failedChmods = a.chmodFiles(plan, updatedFiles, renamedFilesMap)
+		allFailedFiles = append(allFailedFiles, failedChmods...)
+		allUpdatedFiles = append(allUpdatedFiles, chmodded...)
+
+		// Hooks run before the history is written, so the files they rewrite
+		// are recorded with their final content and undone together.
+		written := slices.Clone(updatedFiles)
+		for _, rename := range plan.Renames {
+			if newPath, renamed := renamedFilesMap[rename.OldPath]; renamed && rename.Content != nil {
+				written = append(written, newPath)
+			}
+		}
+		hooks = a.runHooks(ctx, written, len(allUpdatedFiles) > 0)
+		if len(hooks) > 0 {
+			allFailedFiles = append(allFailedFiles, manager.ReloadFiles(written)...)
+		}
+
+		if len(allUpdatedFiles) > 0 {
+			ops := a.stateManager.CreateOperations(allUpdatedFiles, plan.FileActions, plan.Renames, prevHashes, modes)
 			a.stateManager.Write(ops)
-		} else {
-			// TODO: Add this info to the summary message if needed.
+			historyEntry = a.stateManager.CurrentIndex() + 1
 		}
 	}
+	if historyEntry == 0 && len(prevHashes) > 0 {
+		// Nothing was recorded, so the snapshots are not needed.
+		a.stateManager.PruneObjects()
+	}
+	var chmods []model.FileChmod
+	for _, path := range chmodded {
+		chmods = append(chmods, model.FileChmod{Path: path, Mode: modes[path].New})
+	}
 
 	summary := model.Summary{
-		Created:  created,
-		Modified: append(diffApplied, modifiedByExt...),
-		Renamed:  renamedFilesForSummary,
-		Deleted:  deletedFiles,
-		Failed:   allFailedFiles,
+		Created:      created,
+		Modified:     append(diffApplied, modifiedByExt...),
+		Renamed:      renamedFilesForSummary,
+		Deleted:      deletedFiles,
+		Chmodded:     chmods,
+		Failed:       allFailedFiles,
+		Fuzzy:        fuzzy,
+		Offsets:      offsets,
+		Partial:      partial,
+		Warnings:     plan.Warnings,
+		Hooks:        hooks,
+		HistoryEntry: historyEntry,
 	}
 	a.relativizeSummaryPaths(&summary)
 	return summary, nil
 }
 
+// writeRejects writes the rejected hunks of a partially applied diff to
+// .itf/rejects/<path>.rej and returns the path of the reject file.
+func (a *App) writeRejects(p model.PartialPatch) (string, error) {
+	wd, _ := os.Getwd()
+	rejectFile := filepath.Join(a.stateManager.StateDir, state.RejectsDir, relativePath(wd, p.Path)+".rej")
+	if err := os.MkdirAll(filepath.Dir(rejectFile), 0755); err != nil {
+		return "", fmt.Errorf("could not write rejects: %w", err)
+	}
+	if err := fs.WriteFileAtomic(rejectFile, []byte(p.Rejects)); err != nil {
+		return "", fmt.Errorf("could not write rejects: %w", err)
+	}
+	return rejectFile, nil
+}
+
 // fixAndPrintDiffs corrects diffs from the source and prints them to stdout.
+// The diffs that could not be corrected are returned as failures and, in
+// text output, reported on stderr.
 func (a *App) fixAndPrintDiffs() (model.Summary, error) {
 	content, err := a.sourceProvider.GetContent()
 	if err != nil {
 		return model.Summary{}, err
 	}
-	if content == "" {
+	if content == "" && !a.machineOutput() {
 		return model.Summary{}, nil
 	}
 
-	diffs := parser.ExtractDiffBlocks(content)
-	for _, diff := range diffs {
-		corrected, err := patcher.CorrectDiff(diff, a.pathResolver, a.cfg.Extensions)
+	wd, _ := os.Getwd()
+	var results []diffJSON
+	var failed []model.Failure
+	for _, diff := range parser.ExtractDiffBlocks(content) {
+		corrected, fuzzy, err := patcher.CorrectDiff(diff, a.pathResolver, a.cfg.Extensions, a.patchOptions())
 		if err != nil {
-			// Silently skip failures for this mode.
+			failed = append(failed, model.Failure{Path: relativePath(wd, diff.FilePath), Stage: model.StagePatch, Err: err})
 			continue
 		}
-		if corrected != "" {
+		if corrected == "" {
+			continue
+		}
+		if !a.machineOutput() {
 			fmt.Print(corrected)
+			continue
+		}
+		for i := range fuzzy {
+			fuzzy[i].Path = relativePath(wd, fuzzy[i].Path)
 		}
+		results = append(results, diffJSON{Path: relativePath(wd, diff.FilePath), Diff: corrected, Fuzzy: fuzzyMatchesJSON(fuzzy)})
 	}
-	return model.Summary{}, nil
+
+	if a.machineOutput() {
+		if err := a.writeDiffs(os.Stdout, results, failed); err != nil {
+			return model.Summary{}, err
+		}
+	} else {
+		for _, f := range failed {
+			fmt.Fprintf(os.Stderr, "failed %s\n", f)
+		}
+	}
+	return model.Summary{Failed: failed}, nil
+}
+
+// printPlan prints the planned changes from the source to stdout without
+// applying them.
+func (a *App) printPlan() (model.Summary, error) {
+	content, err := a.sourceProvider.GetContent()
+	if err != nil {
+		return model.Summary{}, err
+	}
+
+	entries, failed, err := a.Plan(content)
+	if err != nil {
+		return model.Summary{}, err
+	}
+
+	wd, _ := os.Getwd()
+	for i := range failed {
+		failed[i].Path = relativePath(wd, failed[i].Path)
+	}
+	if a.machineOutput() {
+		for i := range entries {
+			entries[i].Path = relativePath(wd, entries[i].Path)
+			if entries[i].NewPath != "" {
+				entries[i].NewPath = relativePath(wd, entries[i].NewPath)
+			}
+		}
+		if err := a.writePlan(os.Stdout, entries, failed); err != nil {
+			return model.Summary{}, err
+		}
+		return model.Summary{Failed: failed}, nil
+	}
+
+	for _, entry := range entries {
+		if entry.Action == "rename" {
+			fmt.Printf("rename %s -> %s\n", relativePath(wd, entry.Path), relativePath(wd, entry.NewPath))
+		} else {
+			fmt.Printf("%s %s\n", entry.Action, relativePath(wd, entry.Path))
+		}
+		fmt.Print(entry.Diff)
+	}
+	for _, f := range failed {
+		fmt.Printf("failed %s\n", f)
+	}
+	return model.Summary{Failed: failed}, nil
 }
 
 // printTools extracts tool blocks from the source and prints them to stdout.
@@ -283,7 +849,7 @@ func (a *App) printTools() (model.Summary, error) {
 	if err != nil {
 		return model.Summary{}, err
 	}
-	if content == "" {
+	if content == "" && !a.machineOutput() {
 		return model.Summary{}, nil
 	}
 
@@ -292,6 +858,9 @@ func (a *App) printTools() (model.Summary, error) {
 		return model.Summary{}, fmt.Errorf("failed to extract tool blocks: %w", err)
 	}
 
+	if a.machineOutput() {
+		return model.Summary{}, a.writeTools(os.Stdout, tools)
+	}
 	for _, tool := range tools {
 		fmt.Println(tool.Content)
 	}
@@ -317,72 +886,6 @@ func (a *App) GetToolCalls(content string) (string, error) {
 	return strings.Join(toolContents, "\n"), nil
 }
 
-// undoLastOperation handles the undo logic.
-func (a *App) undoLastOperation() (model.Summary, error) {
-	ops := a.stateManager.GetOperationsToUndo()
-	if len(ops) == 0 {
-		return model.Summary{Message: "No operation to undo."}, nil
-	}
-
-	manager, err := nvim.New()
-	if err != nil {
-		return model.Summary{}, err
-	}
-	defer manager.Close()
-
-	total := len(ops)
-	var nvimProgressCb func(int)
-	if a.progressCallback != nil {
-		a.progressCallback(0, total)
-		nvimProgressCb = func(current int) {
-			a.progressCallback(current, total)
-		}
-	}
-
-	undone, failed := manager.UndoFiles(ops, a.stateManager.StateDir, nvimProgressCb)
-
-	summary := model.Summary{
-		Modified: undone,
-		Failed:   failed,
-		Message:  "Undid last operation.",
-	}
-	a.relativizeSummaryPaths(&summary)
-	return summary, nil
-}
-
-// redoLastOperation handles the redo logic.
-func (a *App) redoLastOperation() (model.Summary, error) {
-	ops := a.stateManager.GetOperationsToRedo()
-	if len(ops) == 0 {
-		return model.Summary{Message: "No operation to redo."}, nil
-	}
-
-	manager, err := nvim.New()
-	if err != nil {
-		return model.Summary{}, err
-	}
-	defer manager.Close()
-
-	total := len(ops)
-	var nvimProgressCb func(int)
-	if a.progressCallback != nil {
-		a.progressCallback(0, total)
-		nvimProgressCb = func(current int) {
-			a.progressCallback(current, total)
-		}
-	}
-
-	redone, failed := manager.RedoFiles(ops, a.stateManager.StateDir, nvimProgressCb)
-
-	summary := model.Summary{
-		Modified: redone,
-		Failed:   failed,
-		Message:  "Redid last undone operation.",
-	}
-	a.relativizeSummaryPaths(&summary)
-	return summary, nil
-}
-
 // relativizeSummaryPaths converts absolute file paths in a summary to be
 // relative to the current working directory for cleaner display.
 func (a *App) relativizeSummaryPaths(summary *model.Summary) {
@@ -396,12 +899,7 @@ func (a *App) relativizeSummaryPaths(summary *model.Summary) {
 	makeRelative := func(absPaths []string) []string {
 		relPaths := make([]string, len(absPaths))
 		for i, p := range absPaths {
-			rel, err := filepath.Rel(wd, p)
-			if err != nil {
-				relPaths[i] = p // Fallback to absolute path
-			} else {
-				relPaths[i] = rel
-			}
+			relPaths[i] = relativePath(wd, p)
 		}
 		return relPaths
 	}
@@ -414,15 +912,7 @@ func (a *App) relativizeSummaryPaths(summary *model.Summary) {
 				relRenames[i] = r // fallback
 				continue
 			}
-			oldRel, err1 := filepath.Rel(wd, parts[0])
-			newRel, err2 := filepath.Rel(wd, parts[1])
-			if err1 != nil {
-				oldRel = parts[0]
-			}
-			if err2 != nil {
-				newRel = parts[1]
-			}
-			relRenames[i] = fmt.Sprintf("%s -> %s", oldRel, newRel)
+			relRenames[i] = fmt.Sprintf("%s -> %s", relativePath(wd, parts[0]), relativePath(wd, parts[1]))
 		}
 		return relRenames
 	}
@@ -431,5 +921,34 @@ func (a *App) relativizeSummaryPaths(summary *model.Summary) {
 	summary.Modified = makeRelative(summary.Modified)
 	summary.Renamed = makeRelativeRenames(summary.Renamed)
 	summary.Deleted = makeRelative(summary.Deleted)
-	summary.Failed = makeRelative(summary.Failed)
+	for i := range summary.Chmodded {
+		summary.Chmodded[i].Path = relativePath(wd, summary.Chmodded[i].Path)
+	}
+	for i := range summary.Failed {
+		summary.Failed[i].Path = relativePath(wd, summary.Failed[i].Path)
+	}
+	for i := range summary.Warnings {
+		summary.Warnings[i].Path = relativePath(wd, summary.Warnings[i].Path)
+	}
+	for i := range summary.Fuzzy {
+		summary.Fuzzy[i].Path = relativePath(wd, summary.Fuzzy[i].Path)
+	}
+	for i := range summary.Offsets {
+		summary.Offsets[i].Path = relativePath(wd, summary.Offsets[i].Path)
+	}
+	for i := range summary.Partial {
+		summary.Partial[i].Path = relativePath(wd, summary.Partial[i].Path)
+		if summary.Partial[i].RejectFile != "" {
+			summary.Partial[i].RejectFile = relativePath(wd, summary.Partial[i].RejectFile)
+		}
+	}
+}
+
+// relativePath returns path relative to wd, or path itself if that fails.
+func relativePath(wd, path string) string {
+	rel, err := filepath.Rel(wd, path)
+	if err != nil {
+		return path
+	}
+	return rel
 }
@@ -0,0 +1,380 @@
+package itf
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/sokinpui/itf.go/model"
+)
+
+// Formats accepted by Config.Output.
+const (
+	OutputText   = "text"   // Styled text for people (default)
+	OutputJSON   = "json"   // A single JSON object
+	OutputNDJSON = "ndjson" // A stream of JSON events, one per line
+)
+
+// The JSON representations of the results. Lists are never null, so that
+// scripts can iterate over them without checking.
+type (
+	summaryJSON struct {
+		Event        string        `json:"event,omitempty"`
+		Created      []string      `json:"created"`
+		Modified     []string      `json:"modified"`
+		Renamed      []renameJSON  `json:"renamed"`
+		Deleted      []string      `json:"deleted"`
+		Chmodded     []chmodJSON   `json:"chmodded"`
+		Failed       []failureJSON `json:"failed"`
+		Fuzzy        []fuzzyJSON   `json:"fuzzy"`
+		Offsets      []offsetJSON  `json:"offsets"`
+		Partial      []partialJSON `json:"partial"`
+		Invalid      []failureJSON `json:"invalid"`
+		Hooks        []hookJSON    `json:"hooks"`
+		HistoryEntry int           `json:"history_entry,omitempty"`
+		Message      string        `json:"message,omitempty"`
+	}
+	renameJSON struct {
+		Event string `json:"event,omitempty"`
+		From  string `json:"from"`
+		To    string `json:"to"`
+	}
+	pathJSON struct {
+		Event string `json:"event"`
+		Path  string `json:"path"`
+	}
+	chmodJSON struct {
+		Event string `json:"event,omitempty"`
+		Path  string `json:"path"`
+		Mode  string `json:"mode"` // Octal, e.g., "755"
+	}
+	failureJSON struct {
+		Event string `json:"event,omitempty"`
+		Path  string `json:"path"`
+		Stage string `json:"stage"`
+		Hunk  int    `json:"hunk,omitempty"`
+		Error string `json:"error,omitempty"`
+	}
+	fuzzyJSON struct {
+		Path  string  `json:"path"`
+		Hunk  int     `json:"hunk"`
+		Line  int     `json:"line"`
+		Score float64 `json:"score"`
+	}
+	offsetJSON struct {
+		Path   string `json:"path"`
+		Hunk   int    `json:"hunk"`
+		Line   int    `json:"line"`
+		Offset int    `json:"offset"`
+	}
+	partialJSON struct {
+		Path       string `json:"path"`
+		Applied    int    `json:"applied"`
+		Total      int    `json:"total"`
+		RejectFile string `json:"reject_file,omitempty"`
+	}
+	hookJSON struct {
+		Event    string `json:"event,omitempty"`
+		Command  string `json:"command"`
+		ExitCode int    `json:"exit_code"`
+		Output   string `json:"output"`
+	}
+	progressJSON struct {
+		Event   string `json:"event"`
+		Current int    `json:"current"`
+		Total   int    `json:"total"`
+	}
+	toolJSON struct {
+		Event   string `json:"event,omitempty"`
+		Content string `json:"content"`
+	}
+	diffJSON struct {
+		Event string      `json:"event,omitempty"`
+		Path  string      `json:"path"`
+		Diff  string      `json:"diff"`
+		Fuzzy []fuzzyJSON `json:"fuzzy,omitempty"`
+	}
+	planJSON struct {
+		Event   string `json:"event,omitempty"`
+		Action  string `json:"action"`
+		Path    string `json:"path"`
+		NewPath string `json:"new_path,omitempty"`
+		Source  string `json:"source,omitempty"`
+		Diff    string `json:"diff"`
+	}
+	historyJSON struct {
+		Event      string          `json:"event,omitempty"`
+		ID         int             `json:"id"`
+		Timestamp  int64           `json:"timestamp"`
+		Current    bool            `json:"current"`
+		Undone     bool            `json:"undone"`
+		Operations []operationJSON `json:"operations"`
+	}
+	operationJSON struct {
+		Action  string `json:"action"`
+		Path    string `json:"path"`
+		NewPath string `json:"new_path,omitempty"`
+	}
+)
+
+// machineOutput reports whether results are printed as JSON rather than
+// text.
+func (a *App) machineOutput() bool {
+	return a.cfg.Output == OutputJSON || a.cfg.Output == OutputNDJSON
+}
+
+// encoder writes values in the JSON or NDJSON format.
+type encoder struct {
+	format string
+	enc    *json.Encoder
+}
+
+func newEncoder(w io.Writer, format string) (*encoder, error) {
+	enc := json.NewEncoder(w)
+	switch format {
+	case OutputJSON:
+		enc.SetIndent("", "  ")
+	case OutputNDJSON:
+	default:
+		return nil, fmt.Errorf("unknown output format: %s", format)
+	}
+	return &encoder{format: format, enc: enc}, nil
+}
+
+// event writes v as an NDJSON event. It does nothing in the JSON format.
+func (e *encoder) event(v any) error {
+	if e.format != OutputNDJSON {
+		return nil
+	}
+	return e.enc.Encode(v)
+}
+
+// WriteSummary writes a summary in the JSON or NDJSON format. In NDJSON,
+// each file result and hook is written as an event of its own before the
+// summary.
+func WriteSummary(w io.Writer, format string, summary model.Summary) error {
+	e, err := newEncoder(w, format)
+	if err != nil {
+		return err
+	}
+
+	s := summaryJSON{
+		Created:      nonNil(summary.Created),
+		Modified:     nonNil(summary.Modified),
+		Renamed:      []renameJSON{},
+		Deleted:      nonNil(summary.Deleted),
+		Chmodded:     []chmodJSON{},
+		Failed:       failuresJSON(summary.Failed, ""),
+		Fuzzy:        fuzzyMatchesJSON(summary.Fuzzy),
+		Offsets:      []offsetJSON{},
+		Partial:      []partialJSON{},
+		Invalid:      failuresJSON(summary.Warnings, ""),
+		Hooks:        []hookJSON{},
+		HistoryEntry: summary.HistoryEntry,
+		Message:      summary.Message,
+	}
+	for _, r := range summary.Renamed {
+		from, to, _ := strings.Cut(r, " -> ")
+		s.Renamed = append(s.Renamed, renameJSON{From: from, To: to})
+	}
+	for _, c := range summary.Chmodded {
+		s.Chmodded = append(s.Chmodded, chmodJSON{Path: c.Path, Mode: fmt.Sprintf("%o", c.Mode)})
+	}
+	for _, o := range summary.Offsets {
+		s.Offsets = append(s.Offsets, offsetJSON{Path: o.Path, Hunk: o.Hunk, Line: o.Line, Offset: o.Offset})
+	}
+	for _, p := range summary.Partial {
+		s.Partial = append(s.Partial, partialJSON{Path: p.Path, Applied: p.Applied, Total: p.Total, RejectFile: p.RejectFile})
+	}
+	for _, h := range summary.Hooks {
+		s.Hooks = append(s.Hooks, hookJSON{Command: h.Command, ExitCode: h.ExitCode, Output: h.Output})
+	}
+
+	if format == OutputJSON {
+		return e.enc.Encode(s)
+	}
+
+	var events []any
+	for _, group := range []struct {
+		event string
+		paths []string
+	}{{"created", s.Created}, {"modified", s.Modified}, {"deleted", s.Deleted}} {
+		for _, path := range group.paths {
+			events = append(events, pathJSON{Event: group.event, Path: path})
+		}
+	}
+	for _, r := range s.Renamed {
+		events = append(events, renameJSON{Event: "renamed", From: r.From, To: r.To})
+	}
+	for _, c := range s.Chmodded {
+		c.Event = "chmodded"
+		events = append(events, c)
+	}
+	for _, f := range failuresJSON(summary.Failed, "failed") {
+		events = append(events, f)
+	}
+	for _, f := range failuresJSON(summary.Warnings, "invalid") {
+		events = append(events, f)
+	}
+	for _, h := range s.Hooks {
+		h.Event = "hook"
+		events = append(events, h)
+	}
+	for _, event := range events {
+		if err := e.event(event); err != nil {
+			return err
+		}
+	}
+	s.Event = "summary"
+	return e.enc.Encode(s)
+}
+
+// WriteProgress writes a progress event in the NDJSON format.
+func WriteProgress(w io.Writer, current, total int) error {
+	return json.NewEncoder(w).Encode(progressJSON{Event: "progress", Current: current, Total: total})
+}
+
+// WriteHistory writes history entries in the JSON or NDJSON format.
+func WriteHistory(w io.Writer, format string, entries []model.HistoryEntry) error {
+	e, err := newEncoder(w, format)
+	if err != nil {
+		return err
+	}
+	history := make([]historyJSON, 0, len(entries))
+	for _, entry := range entries {
+		h := historyJSON{
+			ID:         entry.ID,
+			Timestamp:  entry.Timestamp.Unix(),
+			Current:    entry.Current,
+			Undone:     entry.Undone,
+			Operations: []operationJSON{},
+		}
+		for _, op := range entry.Operations {
+			h.Operations = append(h.Operations, operationJSON{Action: op.Action, Path: op.Path, NewPath: op.NewPath})
+		}
+		if format == OutputNDJSON {
+			h.Event = "entry"
+			if err := e.event(h); err != nil {
+				return err
+			}
+			continue
+		}
+		history = append(history, h)
+	}
+	if format == OutputNDJSON {
+		return nil
+	}
+	return e.enc.Encode(struct {
+		History []historyJSON `json:"history"`
+	}{history})
+}
+
+// writeTools writes tool blocks in the format of Config.Output.
+func (a *App) writeTools(w io.Writer, tools []model.ToolBlock) error {
+	e, err := newEncoder(w, a.cfg.Output)
+	if err != nil {
+		return err
+	}
+	result := make([]toolJSON, 0, len(tools))
+	for _, tool := range tools {
+		if err := e.event(toolJSON{Event: "tool", Content: tool.Content}); err != nil {
+			return err
+		}
+		result = append(result, toolJSON{Content: tool.Content})
+	}
+	if e.format == OutputNDJSON {
+		return nil
+	}
+	return e.enc.Encode(struct {
+		Tools []toolJSON `json:"tools"`
+	}{result})
+}
+
+// writeDiffs writes corrected diffs and the diffs that could not be
+// corrected in the format of Config.Output.
+func (a *App) writeDiffs(w io.Writer, diffs []diffJSON, failed []model.Failure) error {
+	e, err := newEncoder(w, a.cfg.Output)
+	if err != nil {
+		return err
+	}
+	if e.format == OutputNDJSON {
+		for _, d := range diffs {
+			d.Event = "diff"
+			if err := e.event(d); err != nil {
+				return err
+			}
+		}
+		for _, f := range failuresJSON(failed, "failed") {
+			if err := e.event(f); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return e.enc.Encode(struct {
+		Diffs  []diffJSON    `json:"diffs"`
+		Failed []failureJSON `json:"failed"`
+	}{nonNil(diffs), failuresJSON(failed, "")})
+}
+
+// writePlan writes planned operations and planning failures in the format
+// of Config.Output.
+func (a *App) writePlan(w io.Writer, entries []model.PlanEntry, failed []model.Failure) error {
+	e, err := newEncoder(w, a.cfg.Output)
+	if err != nil {
+		return err
+	}
+	plan := make([]planJSON, 0, len(entries))
+	for _, entry := range entries {
+		p := planJSON{Action: entry.Action, Path: entry.Path, NewPath: entry.NewPath, Source: entry.Source, Diff: entry.Diff}
+		if e.format == OutputNDJSON {
+			p.Event = "plan"
+			if err := e.event(p); err != nil {
+				return err
+			}
+			continue
+		}
+		plan = append(plan, p)
+	}
+	if e.format == OutputNDJSON {
+		for _, f := range failuresJSON(failed, "failed") {
+			if err := e.event(f); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return e.enc.Encode(struct {
+		Plan   []planJSON    `json:"plan"`
+		Failed []failureJSON `json:"failed"`
+	}{plan, failuresJSON(failed, "")})
+}
+
+func failuresJSON(failures []model.Failure, event string) []failureJSON {
+	result := make([]failureJSON, 0, len(failures))
+	for _, f := range failures {
+		fj := failureJSON{Event: event, Path: f.Path, Stage: string(f.Stage), Hunk: f.Hunk}
+		if f.Err != nil {
+			fj.Error = f.Err.Error()
+		}
+		result = append(result, fj)
+	}
+	return result
+}
+
+func fuzzyMatchesJSON(matches []model.FuzzyMatch) []fuzzyJSON {
+	result := make([]fuzzyJSON, 0, len(matches))
+	for _, m := range matches {
+		result = append(result, fuzzyJSON{Path: m.Path, Hunk: m.Hunk, Line: m.Line, Score: m.Score})
+	}
+	return result
+}
+
+// nonNil returns s, or an empty slice if s is nil.
+func nonNil[T any](s []T) []T {
+	if s == nil {
+		return []T{}
+	}
+	return s
+}
@@ -0,0 +1,82 @@
+package itf
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/sokinpui/itf.go/model"
+)
+
+func testSummary() model.Summary {
+	return model.Summary{
+		Created:      []string{"new.go"},
+		Modified:     []string{"main.go"},
+		Deleted:      []string{"old.go"},
+		Renamed:      []string{"a.go -> b.go"},
+		Chmodded:     []model.FileChmod{{Path: "run.sh", Mode: 0o755}},
+		Failed:       []model.Failure{{Path: "bad.go", Stage: model.StagePatch, Hunk: 2, Err: errors.New("hunk not found")}},
+		Warnings:     []model.Failure{{Path: "main.go", Stage: model.StageValidate}},
+		Hooks:        []model.HookResult{{Command: "go vet", ExitCode: 1, Output: "vet: failed"}},
+		HistoryEntry: 3,
+	}
+}
+
+func TestWriteSummaryNDJSON(t *testing.T) {
+	var buf bytes.Buffer
+	if err := WriteSummary(&buf, OutputNDJSON, testSummary()); err != nil {
+		t.Fatalf("WriteSummary() error = %v", err)
+	}
+
+	var got []string
+	var last map[string]any
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		last = nil
+		if err := json.Unmarshal([]byte(line), &last); err != nil {
+			t.Fatalf("line %q is not JSON: %v", line, err)
+		}
+		got = append(got, last["event"].(string))
+	}
+	want := []string{"created", "modified", "deleted", "renamed", "chmodded", "failed", "invalid", "hook", "summary"}
+	if !slices.Equal(got, want) {
+		t.Errorf("events = %q, want %q", got, want)
+	}
+	if last["history_entry"] != float64(3) {
+		t.Errorf("summary history_entry = %v, want 3", last["history_entry"])
+	}
+	if !strings.Contains(buf.String(), `{"event":"renamed","from":"a.go","to":"b.go"}`) {
+		t.Errorf("output = %s, want the rename split into from and to", buf.String())
+	}
+	if !strings.Contains(buf.String(), `{"event":"chmodded","path":"run.sh","mode":"755"}`) {
+		t.Errorf("output = %s, want the mode in octal", buf.String())
+	}
+}
+
+func TestWriteSummaryJSON(t *testing.T) {
+	var buf bytes.Buffer
+	if err := WriteSummary(&buf, OutputJSON, model.Summary{Message: "Nothing to apply."}); err != nil {
+		t.Fatalf("WriteSummary() error = %v", err)
+	}
+
+	var got map[string]any
+	if err := json.Unmarshal(buf.Bytes(), &got); err != nil {
+		t.Fatalf("output is not a single JSON object: %v\n%s", err, buf.String())
+	}
+	if _, ok := got["event"]; ok {
+		t.Errorf("output has an event field: %s", buf.String())
+	}
+	for _, key := range []string{"created", "modified", "renamed", "deleted", "chmodded", "failed", "fuzzy", "offsets", "partial", "invalid", "hooks"} {
+		if list, ok := got[key].([]any); !ok || len(list) != 0 {
+			t.Errorf("%s = %v, want an empty list", key, got[key])
+		}
+	}
+}
+
+func TestWriteSummaryUnknownFormat(t *testing.T) {
+	if err := WriteSummary(&bytes.Buffer{}, OutputText, model.Summary{}); err == nil {
+		t.Error("WriteSummary() with the text format succeeded, want an error")
+	}
+}
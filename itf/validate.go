@@ -0,0 +1,56 @@
+package itf
+
+import (
+	"context"
+	"slices"
+
+	"github.com/sokinpui/itf.go/internal/parser"
+	"github.com/sokinpui/itf.go/internal/validate"
+	"github.com/sokinpui/itf.go/model"
+)
+
+// Policies accepted by Config.Validate.
+const (
+	ValidateSkip = "skip" // Skip changes that fail validation
+	ValidateWarn = "warn" // Apply them, with a warning
+	ValidateOff  = "off"  // Do not validate changes
+)
+
+// validatePlan checks the new content of every change and rewritten rename
+// of the plan. Depending on Config.Validate, the invalid ones are removed
+// from the plan and reported as failed, or kept and reported as warnings.
+func (a *App) validatePlan(ctx context.Context, plan *parser.ExecutionPlan) *parser.ExecutionPlan {
+	if a.cfg.Validate == ValidateOff {
+		return plan
+	}
+
+	var invalid []model.Failure
+	skipped := make(map[string]bool)
+	check := func(path, target string, content []string) {
+		if err := validate.Content(ctx, target, content, a.cfg.Validators); err != nil {
+			invalid = append(invalid, model.Failure{Path: path, Stage: model.StageValidate, Err: err})
+			skipped[path] = true
+			skipped[target] = true
+		}
+	}
+	for _, change := range plan.Changes {
+		check(change.Path, change.Path, change.Content)
+	}
+	for _, rename := range plan.Renames {
+		if rename.Content != nil {
+			check(rename.OldPath, rename.NewPath, rename.Content)
+		}
+	}
+	if len(invalid) == 0 {
+		return plan
+	}
+	if a.cfg.Validate == ValidateWarn {
+		plan.Warnings = invalid
+		return plan
+	}
+
+	changes := slices.DeleteFunc(slices.Clone(plan.Changes), func(c model.FileChange) bool { return skipped[c.Path] })
+	renames := slices.DeleteFunc(slices.Clone(plan.Renames), func(r model.FileRename) bool { return skipped[r.OldPath] })
+	chmods := slices.DeleteFunc(slices.Clone(plan.Chmods), func(c model.FileChmod) bool { return skipped[c.Path] })
+	return parser.NewExecutionPlan(changes, plan.Deletes, renames, chmods, slices.Concat(plan.Failed, invalid))
+}
@@ -0,0 +1,60 @@
+package itf
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/sokinpui/itf.go/internal/parser"
+	"github.com/sokinpui/itf.go/model"
+)
+
+func TestValidatePlan(t *testing.T) {
+	dir := t.TempDir()
+	valid := filepath.Join(dir, "valid.json")
+	invalid := filepath.Join(dir, "invalid.json")
+	renamed := filepath.Join(dir, "renamed.json")
+	newPlan := func() *parser.ExecutionPlan {
+		return parser.NewExecutionPlan(
+			[]model.FileChange{
+				{Path: valid, Content: []string{"{}"}},
+				{Path: invalid, Content: []string{"{"}},
+			},
+			nil,
+			[]model.FileRename{{OldPath: filepath.Join(dir, "old.json"), NewPath: renamed, Content: []string{"["}}},
+			nil, nil)
+	}
+
+	tests := []struct {
+		policy   string
+		changes  int
+		renames  int
+		failed   int
+		warnings int
+	}{
+		{policy: ValidateSkip, changes: 1, renames: 0, failed: 2},
+		{policy: ValidateWarn, changes: 2, renames: 1, warnings: 2},
+		{policy: ValidateOff, changes: 2, renames: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.policy, func(t *testing.T) {
+			app := &App{cfg: &Config{Validate: tt.policy}}
+			plan := app.validatePlan(context.Background(), newPlan())
+			if len(plan.Changes) != tt.changes || len(plan.Renames) != tt.renames ||
+				len(plan.Failed) != tt.failed || len(plan.Warnings) != tt.warnings {
+				t.Fatalf("validatePlan() = %d changes, %d renames, %d failed, %d warnings; want %d, %d, %d, %d",
+					len(plan.Changes), len(plan.Renames), len(plan.Failed), len(plan.Warnings),
+					tt.changes, tt.renames, tt.failed, tt.warnings)
+			}
+			if tt.changes == 1 && plan.Changes[0].Path != valid {
+				t.Errorf("validatePlan() kept %s, want %s", plan.Changes[0].Path, valid)
+			}
+			for _, f := range append(plan.Failed, plan.Warnings...) {
+				if f.Stage != model.StageValidate {
+					t.Errorf("failure %v has stage %s, want %s", f, f.Stage, model.StageValidate)
+				}
+			}
+		})
+	}
+}
@@ -1,11 +1,20 @@
 package model
 
+import (
+	"fmt"
+	"os"
+	"time"
+)
+
 // FileChange represents a single planned change to a file.
 type FileChange struct {
-	Path    string
-	Content []string
+	Path     string
+	Content  []string
 	Source   string
-	RawBlock string // The full original code block, e.g., "```go\n...\n```"
+	RawBlock string        // The full original code block, e.g., "```go\n...\n```"
+	Fuzzy    []FuzzyMatch  // Hunks of a diff placed by fuzzy matching
+	Offsets  []OffsetMatch // Hunks of a diff placed away from the line in their header
+	Partial  *PartialPatch // Set if some hunks of a diff were rejected
 }
 
 // DiffBlock represents a raw diff block from the source content.
@@ -14,6 +23,54 @@ type DiffBlock struct {
 	RawContent string
 }
 
+// CodeBlock is a fenced code block of the source content.
+type CodeBlock struct {
+	// Hint is the content of the paragraph immediately preceding the code block.
+	Hint string
+	// Lang is the info string of the code block (e.g., "go", "diff").
+	Lang string
+	// Content is the raw text inside the code block.
+	Content string
+	// Path is the path the block is for, from its info string, hint,
+	// heading or first-line comment, or "" if none names one.
+	Path string
+}
+
+// BlockHandler turns the code blocks it claims into planned operations.
+type BlockHandler interface {
+	HandleBlock(block CodeBlock, env BlockEnv) BlockOperations
+}
+
+// BlockHandlerFunc adapts a function to the BlockHandler interface.
+type BlockHandlerFunc func(block CodeBlock, env BlockEnv) BlockOperations
+
+// HandleBlock calls f(block, env).
+func (f BlockHandlerFunc) HandleBlock(block CodeBlock, env BlockEnv) BlockOperations {
+	return f(block, env)
+}
+
+// BlockEnv gives block handlers access to the files being planned.
+type BlockEnv interface {
+	// Resolve returns the absolute path of a path given in the content.
+	Resolve(path string) string
+	// Lines returns the lines of the file at an absolute path, as left by
+	// the blocks handled before, or as on disk. It reports false if the
+	// file does not exist.
+	Lines(path string) ([]string, bool)
+	// Allowed reports whether the extension filter allows changing a file.
+	Allowed(path string) bool
+}
+
+// BlockOperations are the operations planned for a code block. Paths are
+// absolute.
+type BlockOperations struct {
+	Changes []FileChange // New content of files; later blocks override earlier ones
+	Diffs   []DiffBlock  // Applied to the files after every block is handled
+	Deletes []string
+	Renames []FileRename
+	Failed  []Failure
+}
+
 // ToolBlock represents a raw tool block from the source content.
 type ToolBlock struct {
 	Content string
@@ -23,6 +80,124 @@ type ToolBlock struct {
 type FileRename struct {
 	OldPath string
 	NewPath string
+	Content []string      // New content of the renamed file, nil if unchanged
+	Partial *PartialPatch // Set if some hunks of the rename's diff were rejected
+}
+
+// FileChmod represents a change of a file's permission bits.
+type FileChmod struct {
+	Path string
+	Mode os.FileMode
+}
+
+// PlanEntry describes a single planned operation, for previewing a plan
+// before it is applied.
+type PlanEntry struct {
+	Action  string // "create", "modify", "delete", "rename" or "chmod"
+	Path    string
+	NewPath string // Only set for renames
+	Source  string // Where the change came from, e.g., "codeblock" or "diff"
+	Diff    string // Unified diff against the current file on disk
+}
+
+// ReviewItem is a planned operation presented for interactive review.
+type ReviewItem struct {
+	PlanEntry
+	Hunks    []ReviewHunk // Only set for changes sourced from diffs
+	Accepted bool
+}
+
+// ReviewHunk is a single hunk of a ReviewItem's diff.
+type ReviewHunk struct {
+	Content  string // The "@@" header followed by the hunk lines
+	Accepted bool
+}
+
+// HistoryEntry describes one recorded run of the tool, for listing the
+// undo history.
+type HistoryEntry struct {
+	ID         int // 1-based position in the history
+	Timestamp  time.Time
+	Current    bool // The most recently applied entry
+	Undone     bool // Undone, and can be redone
+	Operations []HistoryOperation
+}
+
+// HistoryOperation is a single file operation of a HistoryEntry.
+type HistoryOperation struct {
+	Action  string
+	Path    string
+	NewPath string // Only set for renames
+}
+
+// FuzzyMatch records a hunk that was placed by fuzzy matching because its
+// lines were not found verbatim.
+type FuzzyMatch struct {
+	Path  string
+	Hunk  int     // 1-based index of the hunk within its diff
+	Line  int     // 1-based line of the file where the hunk was placed
+	Score float64 // Similarity of the hunk to the file at Line, from 0 to 1
+}
+
+// OffsetMatch records a hunk that was found verbatim, but at a different
+// line than its header gave.
+type OffsetMatch struct {
+	Path   string
+	Hunk   int // 1-based index of the hunk within its diff
+	Line   int // 1-based line of the file where the hunk was placed
+	Offset int // Line minus the start line in the hunk header
+}
+
+// PartialPatch records a diff that was applied without the hunks that could
+// not be placed.
+type PartialPatch struct {
+	Path       string
+	Applied    int    // Number of hunks applied
+	Total      int    // Number of hunks in the diff
+	Rejects    string // The rejected hunks, as a diff
+	RejectFile string // Where the rejected hunks were written, if anywhere
+}
+
+// FailureStage is the stage of an operation at which a file failed.
+type FailureStage string
+
+const (
+	StagePlan     FailureStage = "plan"     // Parsing the input into planned changes
+	StagePatch    FailureStage = "patch"    // Correcting or applying a diff or edit
+	StageValidate FailureStage = "validate" // Checking the syntax of the new content
+	StageApply    FailureStage = "apply"    // Writing, deleting or renaming the file
+	StageSave     FailureStage = "save"     // Saving Neovim buffers to disk
+	StageHook     FailureStage = "hook"     // Reloading the file after a hook changed it
+	StageUndo     FailureStage = "undo"     // Undoing or redoing the file
+)
+
+// Failure describes why a file could not be changed.
+type Failure struct {
+	Path  string
+	Stage FailureStage
+	Hunk  int   // 1-based index of the failed hunk or edit, 0 if not relevant
+	Err   error // Underlying error, may be nil
+
+	// Source and Block are the kind of change that failed, as in
+	// FileChange.Source, and the block it came from, in which Hunk is
+	// counted. They are empty if not known.
+	Source string
+	Block  string
+}
+
+// String formats the failure as the path followed by the error, if any.
+func (f Failure) String() string {
+	if f.Err == nil {
+		return f.Path
+	}
+	return fmt.Sprintf("%s (%v)", f.Path, f.Err)
+}
+
+// HookResult is the outcome of a hook command run after changes were saved.
+type HookResult struct {
+	Command  string // The command as run, with placeholders replaced
+	ExitCode int    // -1 if the command could not be run
+	Output   string // Combined standard output and error
 }
 
 // Summary holds the results of an operation for display.
@@ -31,6 +206,30 @@ type Summary struct {
 	Modified []string
 	Renamed  []string
 	Deleted  []string
-	Failed   []string
+	Chmodded []FileChmod // Files whose permission bits were the only change
+	Failed   []Failure
+	Fuzzy    []FuzzyMatch   // Hunks of applied changes placed by fuzzy matching
+	Offsets  []OffsetMatch  // Hunks of applied changes placed away from their header's line
+	Partial  []PartialPatch // Diffs applied without some of their hunks
+	Warnings []Failure      // Changes applied even though they failed validation
+	Hooks    []HookResult   // Hook commands run after the changes were saved
 	Message  string
+
+	// HistoryEntry is the ID of the history entry that is current after the
+	// operation, or 0 if the operation left no entry current.
+	HistoryEntry int
+}
+
+// HasFailures reports whether any file failed or any hook exited with a
+// non-zero status.
+func (s Summary) HasFailures() bool {
+	if len(s.Failed) > 0 {
+		return true
+	}
+	for _, hook := range s.Hooks {
+		if hook.ExitCode != 0 {
+			return true
+		}
+	}
+	return false
 }